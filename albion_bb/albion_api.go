@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"time"
 
+	"pb-backend/settings"
+
 	"github.com/google/uuid"
 )
 
@@ -210,43 +212,42 @@ func NewAlbionAPI() *AlbionAPI {
 	}
 }
 
-func (a *AlbionAPI) FetchRecentBattles(offset, limit int) ([]BattleResponse, error) {
+func (a *AlbionAPI) FetchRecentBattles(ctx context.Context, offset, limit int) ([]BattleResponse, error) {
 	// Use a random UUID to prevent caching
 	url := fmt.Sprintf("%s/battles?offset=%d&limit=%d&sort=recent&guid=%s", a.baseUrl, offset, limit, uuid.New().String())
 	var resp []BattleResponse
-	if err := a.makeHttpGETCall(url, &resp); err != nil {
+	if err := a.makeHttpGETCall(ctx, url, &resp); err != nil {
 		return nil, err
 	}
 	return resp, nil
 }
 
-func (a *AlbionAPI) FetchBattle(battleId string) (*BattleResponse, error) {
+func (a *AlbionAPI) FetchBattle(ctx context.Context, battleId string) (*BattleResponse, error) {
 	url := fmt.Sprintf("%s/battles/%s", a.baseUrl, battleId)
 	var resp BattleResponse
-	if err := a.makeHttpGETCall(url, &resp); err != nil {
+	if err := a.makeHttpGETCall(ctx, url, &resp); err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
-func (a *AlbionAPI) FetchBattleKills(battleId, offset, limit int) ([]BattleKillResponse, error) {
+func (a *AlbionAPI) FetchBattleKills(ctx context.Context, battleId, offset, limit int) ([]BattleKillResponse, error) {
 	url := fmt.Sprintf("%s/events/battle/%d?offset=%d&limit=%d", a.baseUrl, battleId, offset, limit)
 	var resp []BattleKillResponse
-	if err := a.makeHttpGETCall(url, &resp); err != nil {
+	if err := a.makeHttpGETCall(ctx, url, &resp); err != nil {
 		return nil, err
 	}
 	return resp, nil
 }
 
-// maxPagesToFetch limits pagination to prevent infinite fetching on empty database
-const maxPagesToFetch = 5
-
 // FetchRecentKillsUntilOverlap fetches kills, paginating only when ALL results are new.
 // existingIds is a set of event IDs that already exist in the database (for fast lookup).
 // This ensures we catch up if we've fallen behind, but don't unnecessarily paginate.
 // Uses a consistent GUID across all pages and retries.
-// Limited to maxPagesToFetch pages to prevent infinite pagination on empty DB.
-func (a *AlbionAPI) FetchRecentKillsUntilOverlap(pageSize int, existingIds map[int]bool) ([]KillResponse, error) {
+// Limited to the max_pages_to_fetch setting to prevent infinite pagination on
+// an empty DB. Stops with the kills so far once ctx is done.
+func (a *AlbionAPI) FetchRecentKillsUntilOverlap(ctx context.Context, pageSize int, existingIds map[int]bool) ([]KillResponse, error) {
+	maxPagesToFetch := settings.Current().MaxPagesToFetch
 	guid := uuid.New().String()
 	allKills := make([]KillResponse, 0)
 	offset := 0
@@ -259,7 +260,11 @@ func (a *AlbionAPI) FetchRecentKillsUntilOverlap(pageSize int, existingIds map[i
 			break
 		}
 
-		kills, err := a.fetchKillsPage(offset, pageSize, guid)
+		if err := ctx.Err(); err != nil {
+			return allKills, err
+		}
+
+		kills, err := a.fetchKillsPage(ctx, offset, pageSize, guid)
 		if err != nil {
 			// Return what we have so far - partial results are better than none
 			return allKills, fmt.Errorf("failed at offset %d: %w", offset, err)
@@ -301,26 +306,28 @@ func (a *AlbionAPI) FetchRecentKillsUntilOverlap(pageSize int, existingIds map[i
 }
 
 // FetchRecentKills fetches a single page of recent kills
-func (a *AlbionAPI) FetchRecentKills(offset, limit int) ([]KillResponse, error) {
+func (a *AlbionAPI) FetchRecentKills(ctx context.Context, offset, limit int) ([]KillResponse, error) {
 	guid := uuid.New().String()
-	return a.fetchKillsPage(offset, limit, guid)
+	return a.fetchKillsPage(ctx, offset, limit, guid)
 }
 
 // fetchKillsPage fetches a single page of kills with retry logic
-func (a *AlbionAPI) fetchKillsPage(offset, limit int, guid string) ([]KillResponse, error) {
+func (a *AlbionAPI) fetchKillsPage(ctx context.Context, offset, limit int, guid string) ([]KillResponse, error) {
 	url := fmt.Sprintf("%s/events?offset=%d&limit=%d&guid=%s", a.baseUrl, offset, limit, guid)
 	var resp []KillResponse
-	if err := a.makeHttpGETCallWithRetry(url, &resp); err != nil {
+	if err := a.makeHttpGETCallWithRetry(ctx, url, &resp); err != nil {
 		return nil, err
 	}
 	return resp, nil
 }
 
-func (a *AlbionAPI) makeHttpGETCall(url string, v interface{}) error {
-	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+// makeHttpGETCall performs a GET request, giving up after the API timeout
+// or once ctx is done
+func (a *AlbionAPI) makeHttpGETCall(ctx context.Context, url string, v interface{}) error {
+	reqCtx, cancel := context.WithTimeout(ctx, a.timeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -328,7 +335,7 @@ func (a *AlbionAPI) makeHttpGETCall(url string, v interface{}) error {
 	fmt.Printf("GET %s\n", url)
 	resp, err := a.client.Do(req)
 	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
+		if ctx.Err() == nil && reqCtx.Err() == context.DeadlineExceeded {
 			return fmt.Errorf("request timed out after %s: %w", a.timeout, err)
 		}
 		return fmt.Errorf("request failed: %w", err)
@@ -344,23 +351,31 @@ func (a *AlbionAPI) makeHttpGETCall(url string, v interface{}) error {
 	return json.NewDecoder(resp.Body).Decode(v)
 }
 
-// makeHttpGETCallWithRetry performs a GET request with exponential backoff retry
-func (a *AlbionAPI) makeHttpGETCallWithRetry(url string, v interface{}) error {
+// makeHttpGETCallWithRetry performs a GET request with exponential backoff
+// retry. It stops retrying once ctx is done.
+func (a *AlbionAPI) makeHttpGETCallWithRetry(ctx context.Context, url string, v interface{}) error {
 	var lastErr error
 
 	for attempt := 1; attempt <= a.maxRetries; attempt++ {
-		err := a.makeHttpGETCall(url, v)
+		err := a.makeHttpGETCall(ctx, url, v)
 		if err == nil {
 			return nil
 		}
 
 		lastErr = err
+		if ctx.Err() != nil {
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, lastErr)
+		}
 
 		if attempt < a.maxRetries {
 			// Exponential backoff: 2s, 4s, 8s...
 			backoff := time.Duration(1<<uint(attempt)) * time.Second
 			fmt.Printf("Attempt %d failed: %v. Retrying in %v...\n", attempt, err, backoff)
-			time.Sleep(backoff)
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("gave up after %d attempts: %w", attempt, lastErr)
+			case <-time.After(backoff):
+			}
 		}
 	}
 
@@ -1,38 +1,36 @@
 package albion_bb
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
 
+	"pb-backend/jobs"
+	"pb-backend/settings"
+
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 )
 
-type queueItem struct {
-	queueId  string
-	battleId string
-}
+// Battles processed per queue run
+const battleQueueBatchSize = 100
 
 type Battleboards struct {
-	albionAPI     *AlbionAPI
-	app           *pocketbase.PocketBase
-	queue         chan queueItem
-	minIterations int
-	maxIterations int
+	albionAPI *AlbionAPI
+	app       *pocketbase.PocketBase
 }
 
 func NewBattleboards(app *pocketbase.PocketBase) *Battleboards {
 	return &Battleboards{
-		app:           app,
-		albionAPI:     NewAlbionAPI(),
-		queue:         make(chan queueItem, 100),
-		minIterations: 10,
-		maxIterations: 20,
+		app:       app,
+		albionAPI: NewAlbionAPI(),
 	}
 }
 
-func (b *Battleboards) FetchNewBattles() error {
+// FetchNewBattles queues the battles since the last one queued. It stops
+// between pages once ctx is done, queueing nothing.
+func (b *Battleboards) FetchNewBattles(ctx context.Context) error {
 	lastBattleId, err := b.getLastBattleFetched()
 	fmt.Println("Last fetched battle ID:", lastBattleId)
 	if err != nil {
@@ -48,11 +46,16 @@ func (b *Battleboards) FetchNewBattles() error {
 	iteration := 0
 	records := make([]*core.Record, 0)
 
-	// Collect at least b.minIterations pages
-	// Collect at maximum b.maxIterations pages
-	// If we reach the last fetched battle, we can stop after reaching b.minIterations and before b.maxIterations
-	for (!reachedLastBattle || iteration < b.minIterations) && iteration < b.maxIterations {
-		battles, err := b.albionAPI.FetchRecentBattles(iteration*51, 51)
+	// Collect at least minIterations pages
+	// Collect at maximum maxIterations pages
+	// If we reach the last fetched battle, we can stop after reaching minIterations and before maxIterations
+	minIterations, maxIterations := settings.Current().MinIterations, settings.Current().MaxIterations
+	for (!reachedLastBattle || iteration < minIterations) && iteration < maxIterations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		battles, err := b.albionAPI.FetchRecentBattles(ctx, iteration*51, 51)
 		if err != nil {
 			return err
 		}
@@ -103,48 +106,35 @@ func (b *Battleboards) FetchNewBattles() error {
 	return err
 }
 
-func (b *Battleboards) EnqueueNewBattles() error {
-	enqueuedBattlesToProcess, err := b.app.FindRecordsByFilter(
+// ProcessQueue processes queued and failed battles, newest first. It stops
+// between battles once ctx is done.
+func (b *Battleboards) ProcessQueue(ctx context.Context) (jobs.Counts, error) {
+	records, err := b.app.FindRecordsByFilter(
 		"battle_queue",
 		"status = 'queued' || status = 'failed'",
 		"-startTime",
-		100,
+		battleQueueBatchSize,
 		0)
 
 	if err != nil {
-		return err
-	}
-
-	if len(enqueuedBattlesToProcess) == 0 {
-		fmt.Println("No battles to enqueue.")
-		return nil
+		return nil, err
 	}
 
-	fmt.Println("Enqueuing", len(enqueuedBattlesToProcess), "battles for processing...")
-	go func() {
-		for _, record := range enqueuedBattlesToProcess {
-			queueId := record.Get("id").(string)
-			battleId := record.Get("battleId").(string)
-
-			b.queue <- queueItem{
-				queueId:  queueId,
-				battleId: battleId,
-			}
+	counts := jobs.Counts{"processed": 0, "failed": 0}
+	for _, record := range records {
+		if err := ctx.Err(); err != nil {
+			return counts, err
 		}
-	}()
 
-	return nil
-}
-
-func (b *Battleboards) ProcessQueue() {
-	fmt.Println("Starting battle processing queue...")
-	for job := range b.queue {
-		err := b.processBattle(job.queueId, job.battleId)
-		if err != nil {
-			fmt.Println("Error processing battle", job.battleId, ":", err)
+		battleId := record.GetString("battleId")
+		if err := b.processBattle(ctx, record.Id, battleId); err != nil {
+			fmt.Println("Error processing battle", battleId, ":", err)
+			counts["failed"]++
 			continue
 		}
+		counts["processed"]++
 	}
+	return counts, nil
 }
 
 func (b *Battleboards) getLastBattleFetched() (string, error) {
@@ -175,7 +165,7 @@ func mapBattleQueue(collection *core.Collection, battle BattleResponse) *core.Re
 	return record
 }
 
-func (b *Battleboards) processBattle(queueId string, battleId string) error {
+func (b *Battleboards) processBattle(ctx context.Context, queueId string, battleId string) error {
 	fmt.Println("Processing battle:", battleId)
 
 	queue, err := b.app.FindRecordById("battle_queue", queueId)
@@ -186,7 +176,7 @@ func (b *Battleboards) processBattle(queueId string, battleId string) error {
 	queue.Set("status", "processing")
 	err = b.app.Save(queue)
 
-	battle, err := b.albionAPI.FetchBattle(battleId)
+	battle, err := b.albionAPI.FetchBattle(ctx, battleId)
 	if err != nil {
 		return err
 	}
@@ -196,7 +186,7 @@ func (b *Battleboards) processBattle(queueId string, battleId string) error {
 
 	allKills := make([]BattleKillResponse, 0)
 	for offset < battle.TotalKills {
-		kills, err := b.albionAPI.FetchBattleKills(battle.Id, offset, limit)
+		kills, err := b.albionAPI.FetchBattleKills(ctx, battle.Id, offset, limit)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,32 @@
+package albion_bb
+
+import (
+	"pb-backend/export"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// RegisterExportRoutes mounts the streaming kill and battle exports for
+// superusers. Each takes format (csv, jsonl or xlsx), filter, from and to;
+// the date range applies to the kill or battle start time.
+//
+//	GET /api/export/kills?format=xlsx&filter=killer_guild='Foo'&from=2025-06-01
+//	GET /api/export/battles?format=jsonl&from=2025-06-01T00:00:00Z
+//	GET /api/export/battle_participants_players?filter=battle='123'
+func RegisterExportRoutes(se *core.ServeEvent) {
+	group := se.Router.Group("/api/export")
+	group.Bind(apis.RequireSuperuserAuth())
+
+	datasets := []export.Dataset{
+		{Collection: "kills", DateField: "timestamp"},
+		{Collection: "battles", DateField: "startTime"},
+		{Collection: "battle_kills", DateField: "timestamp"},
+		{Collection: "battle_participants_alliances", DateField: "startTime"},
+		{Collection: "battle_participants_guilds", DateField: "startTime"},
+		{Collection: "battle_participants_players", DateField: "startTime"},
+	}
+	for _, dataset := range datasets {
+		group.GET("/"+dataset.Collection, export.Handler(dataset))
+	}
+}
@@ -5,99 +5,12 @@ import (
 	"log"
 	"time"
 
+	"pb-backend/settings"
+
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 )
 
-const KillsRetentionDays = 14
-
-// CreateKillsSchema creates the kills collection if it doesn't exist
-func CreateKillsSchema(app *pocketbase.PocketBase) error {
-	return createKillsCollection(app)
-}
-
-func createKillsCollection(app *pocketbase.PocketBase) error {
-	existing, _ := app.FindCollectionByNameOrId("kills")
-	if existing != nil {
-		return nil // Already exists
-	}
-
-	collection := core.NewBaseCollection("kills")
-
-	// Event info
-	collection.Fields.Add(&core.NumberField{
-		Name:     "event_id",
-		Required: true,
-	})
-	collection.Fields.Add(&core.DateField{
-		Name:     "timestamp",
-		Required: true,
-	})
-
-	// Killer info
-	collection.Fields.Add(&core.TextField{
-		Name:     "killer_name",
-		Required: true,
-	})
-	collection.Fields.Add(&core.TextField{
-		Name: "killer_guild",
-	})
-	collection.Fields.Add(&core.TextField{
-		Name: "killer_alliance",
-	})
-	collection.Fields.Add(&core.TextField{
-		Name: "killer_weapon",
-	})
-	collection.Fields.Add(&core.NumberField{
-		Name: "killer_ip",
-	})
-
-	// Victim info
-	collection.Fields.Add(&core.TextField{
-		Name:     "victim_name",
-		Required: true,
-	})
-	collection.Fields.Add(&core.TextField{
-		Name: "victim_guild",
-	})
-	collection.Fields.Add(&core.TextField{
-		Name: "victim_alliance",
-	})
-	collection.Fields.Add(&core.TextField{
-		Name: "victim_weapon",
-	})
-	collection.Fields.Add(&core.NumberField{
-		Name: "victim_ip",
-	})
-
-	// Participant count
-	collection.Fields.Add(&core.NumberField{
-		Name: "participant_count",
-	})
-
-	// Fame
-	collection.Fields.Add(&core.NumberField{
-		Name: "fame",
-	})
-
-	// Indexes for query patterns:
-	// 1. Find top 50 latest kills - ORDER BY timestamp DESC
-	// 2. Find top 50 latest kills where guild/alliance starts with 'ABC'
-	// 3. Find top 50 latest kills where player name starts with 'ABC'
-	collection.Indexes = []string{
-		"CREATE UNIQUE INDEX idx_kills_event_id ON kills (event_id)",
-		"CREATE INDEX idx_kills_timestamp ON kills (timestamp DESC)",
-		"CREATE INDEX idx_kills_killer_name ON kills (killer_name COLLATE NOCASE)",
-		"CREATE INDEX idx_kills_victim_name ON kills (victim_name COLLATE NOCASE)",
-		"CREATE INDEX idx_kills_killer_guild ON kills (killer_guild COLLATE NOCASE)",
-		"CREATE INDEX idx_kills_victim_guild ON kills (victim_guild COLLATE NOCASE)",
-		"CREATE INDEX idx_kills_killer_alliance ON kills (killer_alliance COLLATE NOCASE)",
-		"CREATE INDEX idx_kills_victim_alliance ON kills (victim_alliance COLLATE NOCASE)",
-	}
-
-	return app.Save(collection)
-}
-
 // SaveKills saves multiple kill records in a single transaction, skipping duplicates.
 // existingIds is a set of event IDs that already exist in the database.
 func SaveKills(app *pocketbase.PocketBase, kills []KillResponse, existingIds map[int]bool) (saved int, skipped int, errCount int) {
@@ -210,9 +123,11 @@ func getWeaponType(equipment KillEquipmentResponse) string {
 	return ""
 }
 
-// CleanupOldKills deletes kills older than the retention period (14 days)
+// CleanupOldKills deletes kills older than the retention period in the
+// settings (14 days by default)
 func CleanupOldKills(app *pocketbase.PocketBase) (deleted int, err error) {
-	cutoff := time.Now().UTC().AddDate(0, 0, -KillsRetentionDays)
+	retentionDays := settings.Current().KillsRetentionDays
+	cutoff := time.Now().UTC().AddDate(0, 0, -retentionDays)
 	cutoffStr := cutoff.Format("2006-01-02 15:04:05.000Z")
 
 	records, err := app.FindRecordsByFilter(
@@ -244,6 +159,6 @@ func CleanupOldKills(app *pocketbase.PocketBase) (deleted int, err error) {
 		return 0, err
 	}
 
-	log.Printf("Cleaned up %d kills older than %d days", len(records), KillsRetentionDays)
+	log.Printf("Cleaned up %d kills older than %d days", len(records), retentionDays)
 	return len(records), nil
 }
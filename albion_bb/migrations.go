@@ -0,0 +1,12 @@
+package albion_bb
+
+import (
+	"pb-backend/albion_bb/migrations"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Migrations implements modules.Module
+func (m *Module) Migrations() core.MigrationsList {
+	return migrations.List
+}
@@ -0,0 +1,92 @@
+package migrations
+
+import (
+	"pb-backend/modules"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func init() {
+	List.Register(createKillsCollection, func(app core.App) error {
+		return modules.DeleteCollections(app, "kills")
+	}, "1792356232_albion_create_kills")
+}
+
+// createKillsCollection creates the kills collection
+func createKillsCollection(app core.App) error {
+	collection := core.NewBaseCollection("kills")
+
+	// Event info
+	collection.Fields.Add(&core.NumberField{
+		Name:     "event_id",
+		Required: true,
+	})
+	collection.Fields.Add(&core.DateField{
+		Name:     "timestamp",
+		Required: true,
+	})
+
+	// Killer info
+	collection.Fields.Add(&core.TextField{
+		Name:     "killer_name",
+		Required: true,
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "killer_guild",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "killer_alliance",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "killer_weapon",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "killer_ip",
+	})
+
+	// Victim info
+	collection.Fields.Add(&core.TextField{
+		Name:     "victim_name",
+		Required: true,
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "victim_guild",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "victim_alliance",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "victim_weapon",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "victim_ip",
+	})
+
+	// Participant count
+	collection.Fields.Add(&core.NumberField{
+		Name: "participant_count",
+	})
+
+	// Fame
+	collection.Fields.Add(&core.NumberField{
+		Name: "fame",
+	})
+
+	// Indexes for query patterns:
+	// 1. Find top 50 latest kills - ORDER BY timestamp DESC
+	// 2. Find top 50 latest kills where guild/alliance starts with 'ABC'
+	// 3. Find top 50 latest kills where player name starts with 'ABC'
+	collection.Indexes = []string{
+		"CREATE UNIQUE INDEX idx_kills_event_id ON kills (event_id)",
+		"CREATE INDEX idx_kills_timestamp ON kills (timestamp DESC)",
+		"CREATE INDEX idx_kills_killer_name ON kills (killer_name COLLATE NOCASE)",
+		"CREATE INDEX idx_kills_victim_name ON kills (victim_name COLLATE NOCASE)",
+		"CREATE INDEX idx_kills_killer_guild ON kills (killer_guild COLLATE NOCASE)",
+		"CREATE INDEX idx_kills_victim_guild ON kills (victim_guild COLLATE NOCASE)",
+		"CREATE INDEX idx_kills_killer_alliance ON kills (killer_alliance COLLATE NOCASE)",
+		"CREATE INDEX idx_kills_victim_alliance ON kills (victim_alliance COLLATE NOCASE)",
+	}
+
+	_, err := modules.EnsureCollection(app, collection)
+	return err
+}
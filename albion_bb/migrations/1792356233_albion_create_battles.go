@@ -0,0 +1,151 @@
+package migrations
+
+import (
+	"pb-backend/modules"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	List.Register(createBattleCollections, func(app core.App) error {
+		return modules.DeleteCollections(app, battleCollections...)
+	}, "1792356233_albion_create_battles")
+}
+
+// battleCollections lists the battleboard collections, dependents first
+var battleCollections = []string{
+	"battle_kills",
+	"battle_participants_alliances",
+	"battle_participants_guilds",
+	"battle_participants_players",
+	"battles",
+	"battle_queue",
+}
+
+// createBattleCollections creates the battleboard collections, which were
+// first set up by importing a schema export in the dashboard. Battles and
+// the alliance and guild standings are publicly listable.
+func createBattleCollections(app core.App) error {
+	// Battles fetched from the API, waiting to be processed
+	queue := core.NewBaseCollection("battle_queue")
+	addTextFields(queue, "battleId", "region", "status")
+	queue.Fields.Add(&core.DateField{
+		Name: "startTime",
+	})
+	queue.Indexes = []string{
+		"CREATE INDEX idx_battle_queue_status ON battle_queue (status, startTime)",
+		"CREATE INDEX idx_battle_queue_start ON battle_queue (startTime)",
+		"CREATE UNIQUE INDEX idx_battle_queue_battle ON battle_queue (battleId)",
+	}
+	if _, err := modules.EnsureCollection(app, queue); err != nil {
+		return err
+	}
+
+	// Battles keep the API's battle ID as their record ID
+	battles := core.NewBaseCollection("battles")
+	battles.ListRule = types.Pointer("")
+	if id, ok := battles.Fields.GetByName("id").(*core.TextField); ok {
+		id.Min = 10
+		id.Max = 10
+		id.AutogeneratePattern = "[a-z0-9]{10}"
+	}
+	battles.Fields.Add(&core.DateField{
+		Name:     "startTime",
+		Required: true,
+	})
+	battles.Fields.Add(&core.DateField{
+		Name:     "endTime",
+		Required: true,
+	})
+	addNumberFields(battles, "totalFame", "totalKills")
+	// Top guilds and alliances by participation
+	addTextFields(battles, "guilds", "alliances")
+	addNumberFields(battles, "numPlayers")
+	battles, err := modules.EnsureCollection(app, battles)
+	if err != nil {
+		return err
+	}
+
+	// Per-battle records relate to their battle
+	newBattleCollection := func(name string) *core.Collection {
+		collection := core.NewBaseCollection(name)
+		addTextFields(collection, "region")
+		collection.Fields.Add(&core.RelationField{
+			Name:         "battle",
+			CollectionId: battles.Id,
+			MaxSelect:    1,
+		})
+		return collection
+	}
+
+	kills := newBattleCollection("battle_kills")
+	kills.Fields.Add(&core.DateField{
+		Name: "timestamp",
+	})
+	addNumberFields(kills, "killFame")
+	addTextFields(kills, "killerId", "killerName", "killerNameLower", "killerAlliance", "killerAllianceLower",
+		"killerGuild", "killerGuildLower", "killerWeapon")
+	addNumberFields(kills, "killerAverageIp")
+	addTextFields(kills, "victimId", "victimName", "victimNameLower", "victimAlliance", "victimAllianceLower",
+		"victimGuild", "victimGuildLower", "victimWeapon")
+	addNumberFields(kills, "victimAverageIp")
+
+	alliances := newBattleCollection("battle_participants_alliances")
+	alliances.ListRule = types.Pointer("")
+	alliances.Fields.Add(&core.DateField{
+		Name: "startTime",
+	})
+	addTextFields(alliances, "allianceId", "allianceName", "allianceNameLower")
+	addNumberFields(alliances, "kills", "killFame", "deaths", "deathFame", "players", "averageIp")
+	alliances.Indexes = []string{
+		"CREATE INDEX idx_battle_alliances_name ON battle_participants_alliances (allianceNameLower, startTime)",
+	}
+
+	guilds := newBattleCollection("battle_participants_guilds")
+	guilds.ListRule = types.Pointer("")
+	guilds.Fields.Add(&core.DateField{
+		Name: "startTime",
+	})
+	addTextFields(guilds, "guildId", "guildName", "guildNameLower", "allianceId", "allianceName")
+	addNumberFields(guilds, "kills", "killFame", "deaths", "deathFame", "players", "averageIp")
+	guilds.Indexes = []string{
+		"CREATE INDEX idx_battle_guilds_name ON battle_participants_guilds (guildNameLower, startTime)",
+	}
+
+	players := newBattleCollection("battle_participants_players")
+	players.Fields.Add(&core.DateField{
+		Name: "startTime",
+	})
+	addTextFields(players, "playerId", "playerName", "playerNameLower", "guildId", "guildName",
+		"allianceId", "allianceName")
+	addNumberFields(players, "kills", "killFame", "deaths", "deathFame")
+	addTextFields(players, "weaponName")
+	addNumberFields(players, "averageIp", "damage", "healing", "players")
+	players.Indexes = []string{
+		"CREATE INDEX idx_battle_players_name ON battle_participants_players (playerNameLower, startTime)",
+	}
+
+	for _, collection := range []*core.Collection{kills, alliances, guilds, players} {
+		if _, err := modules.EnsureCollection(app, collection); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addTextFields(collection *core.Collection, names ...string) {
+	for _, name := range names {
+		collection.Fields.Add(&core.TextField{
+			Name: name,
+		})
+	}
+}
+
+func addNumberFields(collection *core.Collection, names ...string) {
+	for _, name := range names {
+		collection.Fields.Add(&core.NumberField{
+			Name: name,
+		})
+	}
+}
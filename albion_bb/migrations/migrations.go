@@ -0,0 +1,10 @@
+// Package migrations holds the battleboard module's schema history, one
+// numbered file per migration. Each migration defines the schema it creates
+// in full, so it produces the same result whenever it runs. Add changes as
+// new numbered files; never edit one that has shipped.
+package migrations
+
+import "github.com/pocketbase/pocketbase/core"
+
+// List is the module's migrations, applied in file name order
+var List core.MigrationsList
@@ -0,0 +1,105 @@
+package albion_bb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pb-backend/jobs"
+	"pb-backend/modules"
+	"pb-backend/settings"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ModuleName is the name used for the module and its enable_ setting
+const ModuleName = "albion"
+
+// Kills older than this many fetch intervals mean the feed has stalled
+const staleKillIntervals = 30
+
+// New battles are fetched every minute
+const (
+	battleboardsTimeout = 5 * time.Minute
+	battleboardsJitter  = 15 * time.Second
+
+	battleQueueJob      = "albion_battle_queue"
+	battleQueueInterval = 1 * time.Minute
+)
+
+// Module tracks Albion Online kills and battleboards
+type Module struct{}
+
+// NewModule creates the Albion module
+func NewModule() *Module {
+	return &Module{}
+}
+
+// Name implements modules.Module
+func (m *Module) Name() string {
+	return ModuleName
+}
+
+// RegisterHooks is a no-op; the module has no record hooks
+func (m *Module) RegisterHooks(app *pocketbase.PocketBase) {}
+
+// StartJobs adds the kills, battleboards and battle queue jobs
+func (m *Module) StartJobs(app *pocketbase.PocketBase, runner *jobs.Runner) {
+	NewScheduler(app).AddJobs(runner)
+
+	battleboards := NewBattleboards(app)
+	runner.MustAdd(jobs.Job{
+		Name:     "albion_battleboards",
+		Schedule: "* * * * *",
+		Timeout:  battleboardsTimeout,
+		Jitter:   battleboardsJitter,
+		Enabled:  moduleEnabled,
+		Run: func(ctx context.Context) (jobs.Counts, error) {
+			// Process whatever is pending even if fetching failed
+			err := battleboards.FetchNewBattles(ctx)
+			_ = runner.Wake(battleQueueJob)
+			if err != nil {
+				return nil, fmt.Errorf("fetching new battles: %w", err)
+			}
+			return nil, nil
+		},
+	})
+	runner.MustAdd(jobs.Job{
+		Name:       battleQueueJob,
+		Every:      func() time.Duration { return battleQueueInterval },
+		RunAtStart: true,
+		Enabled:    moduleEnabled,
+		Run:        battleboards.ProcessQueue,
+	})
+}
+
+// RegisterRoutes registers the kill and battle exports
+func (m *Module) RegisterRoutes(app *pocketbase.PocketBase, se *core.ServeEvent) {
+	RegisterExportRoutes(se)
+}
+
+// Health is degraded when no kill has been saved for a while
+func (m *Module) Health(app *pocketbase.PocketBase) modules.Health {
+	details := map[string]any{}
+	if kills, err := app.CountRecords("kills"); err == nil {
+		details["kills"] = kills
+	}
+
+	latest, err := app.FindRecordsByFilter("kills", "", "-timestamp", 1, 0)
+	if err != nil {
+		return modules.Health{Status: modules.StatusDown, Details: map[string]any{"error": err.Error()}}
+	}
+	if len(latest) == 0 {
+		return modules.Health{Status: modules.StatusOK, Details: details}
+	}
+
+	lastKill := latest[0].GetDateTime("timestamp").Time()
+	details["last_kill"] = lastKill
+
+	status := modules.StatusOK
+	if time.Since(lastKill) > staleKillIntervals*settings.Current().FetchInterval {
+		status = modules.StatusDegraded
+	}
+	return modules.Health{Status: status, Details: details}
+}
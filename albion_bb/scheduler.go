@@ -1,17 +1,23 @@
 package albion_bb
 
 import (
+	"context"
 	"log"
 	"time"
 
+	"pb-backend/jobs"
+	"pb-backend/settings"
+
 	"github.com/pocketbase/pocketbase"
 )
 
+// Fetch and cleanup intervals come from the settings package
 const (
-	fetchInterval   = 10 * time.Second
-	cleanupInterval = 1 * time.Hour
-	pageSize        = 51
-	recentIdsLimit  = 500
+	pageSize       = 51
+	recentIdsLimit = 500
+
+	fetchTimeout = 2 * time.Minute
+	fetchJitter  = 2 * time.Second
 )
 
 // Scheduler handles periodic fetching and cleanup of kills.
@@ -28,47 +34,51 @@ func NewScheduler(app *pocketbase.PocketBase) *Scheduler {
 	}
 }
 
-// Start begins the scheduler goroutines for fetching and cleanup.
-func (s *Scheduler) Start() {
-	go s.runFetchLoop()
-	go s.runCleanupLoop()
+// AddJobs registers the fetch and cleanup jobs. Both run only while the
+// module is enabled and pick up interval changes from the settings.
+func (s *Scheduler) AddJobs(runner *jobs.Runner) {
+	runner.MustAdd(jobs.Job{
+		Name:    "albion_kills_fetch",
+		Every:   func() time.Duration { return settings.Current().FetchInterval },
+		Timeout: fetchTimeout,
+		Jitter:  fetchJitter,
+		Enabled: moduleEnabled,
+		Run:     s.fetchAndSaveKills,
+	})
+	runner.MustAdd(jobs.Job{
+		Name:  "albion_kills_cleanup",
+		Every: func() time.Duration { return settings.Current().CleanupInterval },
+		// Clean up immediately on startup
+		RunAtStart: true,
+		Enabled:    moduleEnabled,
+		Run: func(ctx context.Context) (jobs.Counts, error) {
+			deleted, err := CleanupOldKills(s.app)
+			return jobs.Counts{"deleted": deleted}, err
+		},
+	})
 }
 
-func (s *Scheduler) runFetchLoop() {
-	ticker := time.NewTicker(fetchInterval)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		s.fetchAndSaveKills()
-	}
-}
-
-func (s *Scheduler) fetchAndSaveKills() {
+func (s *Scheduler) fetchAndSaveKills(ctx context.Context) (jobs.Counts, error) {
 	// Get recent event IDs from DB (single query)
 	existingIds := GetRecentEventIds(s.app, recentIdsLimit)
 
 	// Fetch kills, using existingIds to determine pagination
-	kills, err := s.api.FetchRecentKillsUntilOverlap(pageSize, existingIds)
-	if err != nil {
-		log.Printf("Error fetching recent kills: %v", err)
+	kills, fetchErr := s.api.FetchRecentKillsUntilOverlap(ctx, pageSize, existingIds)
+	if fetchErr != nil {
+		log.Printf("Error fetching recent kills: %v", fetchErr)
 		// Continue anyway - we may have partial results
 	}
 
+	counts := jobs.Counts{"fetched": len(kills)}
 	if len(kills) > 0 {
 		// Save kills, reusing the same existingIds
 		saved, skipped, errors := SaveKills(s.app, kills, existingIds)
+		counts["saved"], counts["skipped"], counts["errors"] = saved, skipped, errors
 		log.Printf("Kills: %d fetched, %d saved, %d skipped (duplicates), %d errors", len(kills), saved, skipped, errors)
 	}
+	return counts, fetchErr
 }
 
-func (s *Scheduler) runCleanupLoop() {
-	// Run cleanup immediately on startup
-	CleanupOldKills(s.app)
-
-	ticker := time.NewTicker(cleanupInterval)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		CleanupOldKills(s.app)
-	}
+func moduleEnabled() bool {
+	return settings.Current().ModuleEnabled(ModuleName)
 }
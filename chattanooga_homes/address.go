@@ -0,0 +1,88 @@
+package chattanooga_homes
+
+import (
+	"strings"
+	"unicode"
+)
+
+// streetAbbreviations maps common street suffixes and directionals to their
+// USPS abbreviation so "123 Lookout Mountain Road" and "123 Lookout Mtn Rd" match
+var streetAbbreviations = map[string]string{
+	"avenue":    "ave",
+	"av":        "ave",
+	"boulevard": "blvd",
+	"circle":    "cir",
+	"court":     "ct",
+	"cove":      "cv",
+	"drive":     "dr",
+	"highway":   "hwy",
+	"lane":      "ln",
+	"mountain":  "mtn",
+	"parkway":   "pkwy",
+	"place":     "pl",
+	"point":     "pt",
+	"road":      "rd",
+	"street":    "st",
+	"terrace":   "ter",
+	"trail":     "trl",
+	"way":       "way",
+	"north":     "n",
+	"south":     "s",
+	"east":      "e",
+	"west":      "w",
+	"northeast": "ne",
+	"northwest": "nw",
+	"southeast": "se",
+	"southwest": "sw",
+}
+
+// unitDesignators start the unit part of an address, which is dropped
+var unitDesignators = map[string]bool{
+	"apt":   true,
+	"unit":  true,
+	"ste":   true,
+	"suite": true,
+	"lot":   true,
+	"#":     true,
+}
+
+// NormalizeStreet lowercases a street address, strips punctuation and unit
+// numbers, and abbreviates suffixes and directionals
+func NormalizeStreet(street string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '#':
+			return unicode.ToLower(r)
+		default:
+			return ' '
+		}
+	}, street)
+
+	words := strings.Fields(cleaned)
+	out := make([]string, 0, len(words))
+	for _, w := range words {
+		if unitDesignators[w] || strings.HasPrefix(w, "#") {
+			break
+		}
+		if abbr, ok := streetAbbreviations[w]; ok {
+			w = abbr
+		}
+		out = append(out, w)
+	}
+	return strings.Join(out, " ")
+}
+
+// AddressKey returns a stable key for a property from its street and zip,
+// or "" when the street is empty
+func AddressKey(street, zip string) string {
+	normalized := NormalizeStreet(street)
+	if normalized == "" {
+		return ""
+	}
+
+	zip = strings.TrimSpace(zip)
+	if len(zip) > 5 {
+		zip = zip[:5]
+	}
+	return normalized + "|" + zip
+}
@@ -0,0 +1,48 @@
+package chattanooga_homes
+
+import "testing"
+
+func TestAddressKey(t *testing.T) {
+	tests := []struct {
+		street, zip string
+		expected    string
+	}{
+		{"123 Lookout Mountain Road", "37350", "123 lookout mtn rd|37350"},
+		{"123 Lookout Mtn. Rd", "37350-1234", "123 lookout mtn rd|37350"},
+		{"45 North Main Street Apt 2", "37402", "45 n main st|37402"},
+		{"45 N Main St #2", "37402", "45 n main st|37402"},
+		{"  ", "37402", ""},
+	}
+
+	for _, tt := range tests {
+		if got := AddressKey(tt.street, tt.zip); got != tt.expected {
+			t.Errorf("AddressKey(%q, %q) = %q, expected %q", tt.street, tt.zip, got, tt.expected)
+		}
+	}
+}
+
+func TestDedupeHomes(t *testing.T) {
+	homes := []Home{
+		{ListingID: "a1", Street: "10 Signal Road", Zip: "37377", Price: 300000},
+		{ListingID: "b7", Street: "10 Signal Rd", Zip: "37377", Price: 310000, Description: "Creek view", Acres: 2},
+		{ListingID: "c3", Street: "", Zip: "37377"},
+		{ListingID: "c3", Street: "", Zip: "37377"},
+		{ListingID: "d4", Street: "12 Signal Rd", Zip: "37377"},
+	}
+
+	deduped := DedupeHomes(homes)
+	if len(deduped) != 3 {
+		t.Fatalf("Expected 3 homes, got %d: %+v", len(deduped), deduped)
+	}
+
+	merged := deduped[0]
+	if merged.ListingID != "a1" || merged.Price != 300000 {
+		t.Errorf("Expected the first listing to win, got %+v", merged)
+	}
+	if merged.Description != "Creek view" || merged.Acres != 2 {
+		t.Errorf("Expected empty fields filled from the duplicate, got %+v", merged)
+	}
+	if deduped[1].ListingID != "c3" || deduped[2].ListingID != "d4" {
+		t.Errorf("Expected c3 then d4, got %s then %s", deduped[1].ListingID, deduped[2].ListingID)
+	}
+}
@@ -0,0 +1,248 @@
+package chattanooga_homes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"pb-backend/notify"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Alert delivery methods
+const (
+	DeliveryDiscordChannel = notify.KindDiscordChannel
+	DeliveryDiscordDM      = notify.KindDiscordDM
+	DeliveryDiscordWebhook = notify.KindDiscordWebhook
+	DeliverySlack          = notify.KindSlack
+	DeliveryEmail          = notify.KindEmail
+	DeliveryNtfy           = notify.KindNtfy
+	DeliveryWebhook        = notify.KindWebhook
+)
+
+// HomeAlert is a user's saved search criteria and where to send matches.
+// Zero-valued criteria are ignored.
+type HomeAlert struct {
+	ID          string
+	UserID      string
+	Name        string
+	MinPrice    int
+	MaxPrice    int
+	MinBeds     int
+	MinBaths    float64
+	MinAcres    float64
+	MaxAcres    float64
+	Counties    []string
+	Subdivision string
+	Keywords    []string
+	Delivery    string
+	Target      string
+}
+
+// checkAlertTarget reports whether a user's alert may be sent to target.
+// Users can alert their own email address and linked Discord account;
+// anything else, such as channels and webhooks, must be in alert_targets.
+func checkAlertTarget(app core.App, userID, delivery, target string) error {
+	target = strings.TrimSpace(target)
+	approved, _ := app.FindFirstRecordByFilter("alert_targets", "delivery = {:delivery} && target = {:target}",
+		map[string]any{"delivery": delivery, "target": target})
+	if approved != nil {
+		return nil
+	}
+
+	switch delivery {
+	case DeliveryEmail:
+		user, err := app.FindRecordById("users", userID)
+		if err == nil && user.Email() != "" && strings.EqualFold(target, user.Email()) {
+			return nil
+		}
+		return errors.New("email alerts can only be sent to your own address")
+
+	case DeliveryDiscordDM:
+		user, err := app.FindRecordById("users", userID)
+		if err != nil {
+			return err
+		}
+		auths, err := app.FindAllExternalAuthsByRecord(user)
+		if err != nil {
+			return err
+		}
+		for _, auth := range auths {
+			if auth.Provider() == "discord" && auth.ProviderId() == target {
+				return nil
+			}
+		}
+		return errors.New("Discord DMs can only be sent to your linked Discord account")
+	}
+
+	return fmt.Errorf("%s target %q has not been approved by an admin", delivery, target)
+}
+
+// registerAlertHooks rejects alerts whose target the user may not use
+func registerAlertHooks(app *pocketbase.PocketBase) {
+	app.OnRecordValidate("home_alerts").BindFunc(func(e *core.RecordEvent) error {
+		record := e.Record
+		if err := checkAlertTarget(e.App, record.GetString("user"), record.GetString("delivery"), record.GetString("target")); err != nil {
+			return fmt.Errorf("invalid alert target: %w", err)
+		}
+		return e.Next()
+	})
+}
+
+// LoadHomeAlerts returns all enabled alerts
+func LoadHomeAlerts(app core.App) ([]*HomeAlert, error) {
+	records, err := app.FindRecordsByFilter("home_alerts", "enabled = true", "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts := make([]*HomeAlert, 0, len(records))
+	for _, record := range records {
+		alerts = append(alerts, homeAlertFromRecord(record))
+	}
+	return alerts, nil
+}
+
+func homeAlertFromRecord(record *core.Record) *HomeAlert {
+	alert := &HomeAlert{
+		ID:          record.Id,
+		UserID:      record.GetString("user"),
+		Name:        record.GetString("name"),
+		MinPrice:    record.GetInt("min_price"),
+		MaxPrice:    record.GetInt("max_price"),
+		MinBeds:     record.GetInt("min_beds"),
+		MinBaths:    record.GetFloat("min_baths"),
+		MinAcres:    record.GetFloat("min_acres"),
+		MaxAcres:    record.GetFloat("max_acres"),
+		Subdivision: record.GetString("subdivision"),
+		Delivery:    record.GetString("delivery"),
+		Target:      strings.TrimSpace(record.GetString("target")),
+	}
+	if err := record.UnmarshalJSONField("counties", &alert.Counties); err != nil {
+		log.Printf("[ALERTS] Invalid counties on alert %s: %v", record.Id, err)
+	}
+	if err := record.UnmarshalJSONField("keywords", &alert.Keywords); err != nil {
+		log.Printf("[ALERTS] Invalid keywords on alert %s: %v", record.Id, err)
+	}
+	return alert
+}
+
+// Matches reports whether a homes record satisfies every criterion of the alert
+func (a *HomeAlert) Matches(record *core.Record) bool {
+	price := record.GetInt("price")
+	acres := record.GetFloat("acres")
+
+	if a.MinPrice > 0 && price < a.MinPrice {
+		return false
+	}
+	if a.MaxPrice > 0 && price > a.MaxPrice {
+		return false
+	}
+	if a.MinBeds > 0 && record.GetInt("beds_total") < a.MinBeds {
+		return false
+	}
+	if a.MinBaths > 0 && record.GetFloat("baths_total") < a.MinBaths {
+		return false
+	}
+	if a.MinAcres > 0 && acres < a.MinAcres {
+		return false
+	}
+	if a.MaxAcres > 0 && acres > a.MaxAcres {
+		return false
+	}
+
+	if len(a.Counties) > 0 {
+		county := record.GetString("county")
+		found := false
+		for _, c := range a.Counties {
+			if strings.EqualFold(strings.TrimSpace(c), county) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if a.Subdivision != "" && !strings.Contains(strings.ToLower(record.GetString("subdivision")), strings.ToLower(a.Subdivision)) {
+		return false
+	}
+
+	// Any keyword may match any of the descriptive text fields
+	if len(a.Keywords) > 0 {
+		haystack := strings.ToLower(strings.Join([]string{
+			record.GetString("street"),
+			record.GetString("city"),
+			record.GetString("sub_type"),
+			record.GetString("area"),
+			record.GetString("subdivision"),
+			record.GetString("description"),
+		}, " "))
+		found := false
+		for _, kw := range a.Keywords {
+			kw = strings.ToLower(strings.TrimSpace(kw))
+			if kw != "" && strings.Contains(haystack, kw) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// deliverHomeAlert sends a matching listing to the alert's destination. The
+// target is checked again, since approvals and linked accounts can change
+// after the alert was saved.
+func deliverHomeAlert(app *pocketbase.PocketBase, alert *HomeAlert, record *core.Record, changes []FieldChange) error {
+	if err := checkAlertTarget(app, alert.UserID, alert.Delivery, alert.Target); err != nil {
+		return err
+	}
+
+	notifier, err := notify.ForTarget(app, alert.Delivery, alert.Target)
+	if err != nil {
+		return err
+	}
+
+	_, err = notifier.Send(alertMessage(app, alert, record, changes))
+	return err
+}
+
+// alertMessage is the listing (and its changes, for updates) with the alert
+// headline. JSON webhooks also receive the full listing record.
+func alertMessage(app core.App, alert *HomeAlert, record *core.Record, changes []FieldChange) notify.Message {
+	event := "created"
+	msg := homeMessage(app, record, changes != nil)
+	if changes != nil {
+		event = "updated"
+		msg.Sections = []notify.Message{updateMessage(record, changes)}
+	}
+
+	msg.Summary = alertHeadline(alert, changes)
+	msg.Data = map[string]any{
+		"alert":   alert.Name,
+		"event":   event,
+		"listing": record.PublicExport(),
+		"changes": changes,
+	}
+	return msg
+}
+
+// alertHeadline is the one-line summary shown above an alert notification
+func alertHeadline(alert *HomeAlert, changes []FieldChange) string {
+	name := alert.Name
+	if name == "" {
+		name = "Home alert"
+	}
+	if changes != nil {
+		return fmt.Sprintf("🔔 %s: listing updated", name)
+	}
+	return fmt.Sprintf("🔔 %s: new listing", name)
+}
@@ -0,0 +1,127 @@
+package chattanooga_homes
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func newAlertTestRecord() *core.Record {
+	collection := core.NewBaseCollection("homes")
+	for _, name := range []string{"price", "beds_total", "baths_total", "acres"} {
+		collection.Fields.Add(&core.NumberField{Name: name})
+	}
+	for _, name := range []string{"street", "city", "county", "sub_type", "area", "subdivision", "description"} {
+		collection.Fields.Add(&core.TextField{Name: name})
+	}
+
+	record := core.NewRecord(collection)
+	record.Load(map[string]any{
+		"price":       350000,
+		"beds_total":  3,
+		"baths_total": 2.5,
+		"acres":       5.2,
+		"street":      "1234 Lookout Ridge Road",
+		"city":        "Signal Mountain",
+		"county":      "Hamilton",
+		"sub_type":    "Single Family Residence",
+		"area":        "Signal Mtn",
+		"subdivision": "Fox Run Estates",
+		"description": "Brick ranch with a creek",
+	})
+	return record
+}
+
+func TestHomeAlertMatches(t *testing.T) {
+	record := newAlertTestRecord()
+
+	tests := []struct {
+		name  string
+		alert HomeAlert
+		want  bool
+	}{
+		{"no criteria", HomeAlert{}, true},
+
+		{"min price below", HomeAlert{MinPrice: 300000}, true},
+		{"min price equal", HomeAlert{MinPrice: 350000}, true},
+		{"min price above", HomeAlert{MinPrice: 400000}, false},
+		{"max price above", HomeAlert{MaxPrice: 400000}, true},
+		{"max price equal", HomeAlert{MaxPrice: 350000}, true},
+		{"max price below", HomeAlert{MaxPrice: 300000}, false},
+
+		{"min beds met", HomeAlert{MinBeds: 3}, true},
+		{"min beds unmet", HomeAlert{MinBeds: 4}, false},
+		{"min baths met", HomeAlert{MinBaths: 2.5}, true},
+		{"min baths unmet", HomeAlert{MinBaths: 3}, false},
+
+		{"min acres met", HomeAlert{MinAcres: 5}, true},
+		{"min acres unmet", HomeAlert{MinAcres: 10}, false},
+		{"max acres met", HomeAlert{MaxAcres: 10}, true},
+		{"max acres unmet", HomeAlert{MaxAcres: 5}, false},
+
+		{"county listed", HomeAlert{Counties: []string{"Marion", "Hamilton"}}, true},
+		{"county ignores case and spaces", HomeAlert{Counties: []string{" hamilton "}}, true},
+		{"county not listed", HomeAlert{Counties: []string{"Marion", "Sequatchie"}}, false},
+		{"empty counties", HomeAlert{Counties: []string{}}, true},
+
+		{"subdivision part", HomeAlert{Subdivision: "fox run"}, true},
+		{"subdivision other", HomeAlert{Subdivision: "Stonecrest"}, false},
+
+		{"keyword in description", HomeAlert{Keywords: []string{"CREEK"}}, true},
+		{"keyword in street", HomeAlert{Keywords: []string{"lookout"}}, true},
+		{"keyword in city", HomeAlert{Keywords: []string{"signal"}}, true},
+		{"keyword in sub type", HomeAlert{Keywords: []string{"single family"}}, true},
+		{"keyword in area", HomeAlert{Keywords: []string{"mtn"}}, true},
+		{"any keyword", HomeAlert{Keywords: []string{"pool", " ranch "}}, true},
+		{"no keyword", HomeAlert{Keywords: []string{"pool", "barn"}}, false},
+		{"blank keywords", HomeAlert{Keywords: []string{"", "  "}}, false},
+
+		{"all criteria met", HomeAlert{
+			MinPrice: 300000, MaxPrice: 400000, MinBeds: 3, MinBaths: 2, MinAcres: 5, MaxAcres: 10,
+			Counties: []string{"Hamilton"}, Subdivision: "Fox", Keywords: []string{"brick"},
+		}, true},
+		{"one criterion unmet", HomeAlert{
+			MinPrice: 300000, MaxPrice: 400000, MinBeds: 4, MinAcres: 5,
+			Counties: []string{"Hamilton"}, Keywords: []string{"brick"},
+		}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.alert.Matches(record); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestHomeAlertMatchesUnsetFields(t *testing.T) {
+	// A listing missing a value fails the criteria that need it
+	collection := core.NewBaseCollection("homes")
+	for _, name := range []string{"price", "beds_total", "baths_total", "acres"} {
+		collection.Fields.Add(&core.NumberField{Name: name})
+	}
+	for _, name := range []string{"county", "subdivision"} {
+		collection.Fields.Add(&core.TextField{Name: name})
+	}
+	record := core.NewRecord(collection)
+
+	tests := []struct {
+		name  string
+		alert HomeAlert
+		want  bool
+	}{
+		{"no criteria", HomeAlert{}, true},
+		{"max price", HomeAlert{MaxPrice: 400000}, true},
+		{"max acres", HomeAlert{MaxAcres: 10}, true},
+		{"min price", HomeAlert{MinPrice: 1}, false},
+		{"min beds", HomeAlert{MinBeds: 1}, false},
+		{"min baths", HomeAlert{MinBaths: 1}, false},
+		{"min acres", HomeAlert{MinAcres: 1}, false},
+		{"county", HomeAlert{Counties: []string{"Hamilton"}}, false},
+		{"subdivision", HomeAlert{Subdivision: "Fox"}, false},
+		{"keyword", HomeAlert{Keywords: []string{"creek"}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.alert.Matches(record); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,540 @@
+package chattanooga_homes
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pb-backend/export"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// Limits on the inventory series and absorption window
+	maxInventoryPeriods = 366
+	maxAbsorptionDays   = 365
+
+	// analyticsBatchSize is how many listings are loaded at a time
+	analyticsBatchSize = 500
+)
+
+// Fields listings can be grouped by
+var analyticsGroups = []string{"county", "area", "subdivision"}
+
+// Quartiles summarizes a distribution of values
+type Quartiles struct {
+	Count  int     `json:"count"`
+	Min    float64 `json:"min"`
+	Q1     float64 `json:"q1"`
+	Median float64 `json:"median"`
+	Q3     float64 `json:"q3"`
+	Max    float64 `json:"max"`
+}
+
+// PriceStats is the price distribution of a group of listings
+type PriceStats struct {
+	Group        string     `json:"group"`
+	Listings     int        `json:"listings"`
+	Price        *Quartiles `json:"price"`
+	PricePerSqft *Quartiles `json:"price_per_sqft"`
+	PricePerAcre *Quartiles `json:"price_per_acre"`
+}
+
+// InventoryPoint counts listings on the market during one interval, by the
+// status they had at its end
+type InventoryPoint struct {
+	Start       time.Time      `json:"start"`
+	End         time.Time      `json:"end"`
+	Total       int            `json:"total"`
+	NewListings int            `json:"new_listings"`
+	Statuses    map[string]int `json:"statuses"`
+}
+
+// AbsorptionStats compares how fast listings go under contract with the
+// active inventory. Listings count as absorbed the first time they go
+// pending or sold during the window.
+type AbsorptionStats struct {
+	Group    string `json:"group"`
+	Active   int    `json:"active"`
+	Absorbed int    `json:"absorbed"`
+	// Absorbed listings per 30 days
+	MonthlyAbsorbed float64 `json:"monthly_absorbed"`
+	// Percent of active inventory absorbed per 30 days
+	AbsorptionRate *float64 `json:"absorption_rate"`
+	// Months to absorb the active inventory at the current pace
+	MonthsOfInventory *float64 `json:"months_of_inventory"`
+}
+
+// RegisterAnalyticsRoutes mounts the market analytics endpoints. Each
+// accepts a `filter` query parameter in PocketBase filter syntax to narrow
+// the listings (without hidden, @collection or @request fields, as in the
+// records API), and most accept `group_by` (county, area or subdivision).
+//
+//	GET /api/homes/analytics/prices?group_by=county&status=active
+//	GET /api/homes/analytics/inventory?interval=week&periods=12
+//	GET /api/homes/analytics/absorption?days=30&group_by=county
+func RegisterAnalyticsRoutes(se *core.ServeEvent) {
+	group := se.Router.Group("/api/homes/analytics")
+	group.Bind(apis.RequireAuth())
+	group.GET("/prices", handlePriceAnalytics)
+	group.GET("/inventory", handleInventoryAnalytics)
+	group.GET("/absorption", handleAbsorptionAnalytics)
+}
+
+func handlePriceAnalytics(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+
+	groupBy, err := analyticsGroupBy(query.Get("group_by"))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	statuses, err := analyticsStatuses(query.Get("status"))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	scan, err := newAnalyticsScan(e, query.Get("filter"), groupBy)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	overall := &priceValues{}
+	groups := map[string]*priceValues{}
+	err = scan.each(func(batch []analyticsListing) {
+		for _, listing := range batch {
+			if statuses != nil && !statuses[statusCategory(listing.Status)] {
+				continue
+			}
+			overall.add(listing)
+			if groupBy != "" {
+				group := listing.group()
+				if groups[group] == nil {
+					groups[group] = &priceValues{}
+				}
+				groups[group].add(listing)
+			}
+		}
+	})
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	stats := make([]PriceStats, 0, len(groups))
+	for _, name := range slices.Sorted(maps.Keys(groups)) {
+		stats = append(stats, groups[name].stats(name))
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"group_by": groupBy,
+		"overall":  overall.stats("all"),
+		"groups":   stats,
+	})
+}
+
+func handleInventoryAnalytics(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = "week"
+	}
+	if interval != "day" && interval != "week" && interval != "month" {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "interval must be day, week or month"})
+	}
+	periods, err := analyticsInt(query.Get("periods"), 12, maxInventoryPeriods)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid periods: " + err.Error()})
+	}
+	scan, err := newAnalyticsScan(e, query.Get("filter"), "")
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	points := inventoryBuckets(now, interval, periods)
+	changes, err := loadStatusChanges(e.App, points[0].Start)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	err = scan.each(func(batch []analyticsListing) {
+		for i := range points {
+			point := &points[i]
+			for _, listing := range batch {
+				firstSeen := listing.FirstSeen.Time()
+				lastSeen := listing.LastSeen.Time()
+				if !firstSeen.Before(point.End) || lastSeen.Before(point.Start) {
+					continue
+				}
+				point.Total++
+				if !firstSeen.Before(point.Start) {
+					point.NewListings++
+				}
+				status := statusAt(listing.Status, changes[listing.Id], point.End)
+				point.Statuses[statusCategory(status)]++
+			}
+		}
+	})
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"interval": interval,
+		"points":   points,
+	})
+}
+
+func handleAbsorptionAnalytics(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+
+	groupBy, err := analyticsGroupBy(query.Get("group_by"))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	days, err := analyticsInt(query.Get("days"), 30, maxAbsorptionDays)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid days: " + err.Error()})
+	}
+	scan, err := newAnalyticsScan(e, query.Get("filter"), groupBy)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -days)
+	changes, err := loadStatusChanges(e.App, since)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	overall := &AbsorptionStats{Group: "all"}
+	groups := map[string]*AbsorptionStats{}
+	err = scan.each(func(batch []analyticsListing) {
+		for _, listing := range batch {
+			overall.add(listing, changes[listing.Id])
+			if groupBy != "" {
+				group := listing.group()
+				if groups[group] == nil {
+					groups[group] = &AbsorptionStats{Group: group}
+				}
+				groups[group].add(listing, changes[listing.Id])
+			}
+		}
+	})
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	stats := make([]AbsorptionStats, 0, len(groups))
+	for _, name := range slices.Sorted(maps.Keys(groups)) {
+		stats = append(stats, groups[name].finish(days))
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"group_by": groupBy,
+		"days":     days,
+		"overall":  overall.finish(days),
+		"groups":   stats,
+	})
+}
+
+// analyticsListing is the part of a listing the analytics use
+type analyticsListing struct {
+	Id         string         `db:"id"`
+	Status     string         `db:"status"`
+	Group      string         `db:"group_name"`
+	Price      float64        `db:"price"`
+	LivingArea float64        `db:"living_area"`
+	Acres      float64        `db:"acres"`
+	FirstSeen  types.DateTime `db:"first_seen"`
+	LastSeen   types.DateTime `db:"last_seen"`
+}
+
+// group returns the value of the group_by field
+func (l analyticsListing) group() string {
+	if name := strings.TrimSpace(l.Group); name != "" {
+		return name
+	}
+	return "Unknown"
+}
+
+// analyticsScan pages through the listings matching a caller's filter, so
+// the aggregates don't need every listing in memory at once
+type analyticsScan struct {
+	app        core.App
+	collection *core.Collection
+	resolver   *core.RecordFieldResolver
+	filter     dbx.Expression
+	groupBy    string
+}
+
+func newAnalyticsScan(e *core.RequestEvent, filter, groupBy string) (*analyticsScan, error) {
+	collection, err := e.App.FindCollectionByNameOrId("homes")
+	if err != nil {
+		return nil, err
+	}
+	expr, resolver, err := export.UserFilter(e, collection, filter)
+	if err != nil {
+		return nil, err
+	}
+	return &analyticsScan{
+		app:        e.App,
+		collection: collection,
+		resolver:   resolver,
+		filter:     expr,
+		groupBy:    groupBy,
+	}, nil
+}
+
+// each calls fn with batches of listings in ID order
+func (s *analyticsScan) each(fn func([]analyticsListing)) error {
+	// groupBy is one of analyticsGroups
+	group := "''"
+	if s.groupBy != "" {
+		group = "[[homes." + s.groupBy + "]]"
+	}
+
+	last := ""
+	for {
+		query := s.app.RecordQuery(s.collection).
+			Select("[[homes.id]]", "[[homes.status]]", group+" AS [[group_name]]", "[[homes.price]]",
+				"[[homes.living_area]]", "[[homes.acres]]", "[[homes.first_seen]]", "[[homes.last_seen]]").
+			AndWhere(dbx.NewExp("[[homes.id]] > {:last}", dbx.Params{"last": last})).
+			OrderBy("[[homes.id]] ASC").
+			Limit(analyticsBatchSize)
+		if s.filter != nil {
+			query.AndWhere(s.filter)
+		}
+		if err := s.resolver.UpdateQuery(query); err != nil {
+			return err
+		}
+
+		batch := []analyticsListing{}
+		if err := query.All(&batch); err != nil {
+			return fmt.Errorf("failed to load listings: %w", err)
+		}
+		fn(batch)
+		if len(batch) < analyticsBatchSize {
+			return nil
+		}
+		last = batch[len(batch)-1].Id
+	}
+}
+
+func analyticsGroupBy(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	for _, field := range analyticsGroups {
+		if value == field {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("group_by must be one of %s", strings.Join(analyticsGroups, ", "))
+}
+
+// analyticsStatuses parses a comma separated list of status categories.
+// It defaults to active listings; "all" disables the status filter.
+func analyticsStatuses(value string) (map[string]bool, error) {
+	if value == "" {
+		value = statusActive
+	}
+	if value == "all" {
+		return nil, nil
+	}
+
+	statuses := map[string]bool{}
+	for _, status := range strings.Split(value, ",") {
+		status = strings.TrimSpace(status)
+		switch status {
+		case statusActive, statusPending, statusSold, statusOffMarket:
+			statuses[status] = true
+		default:
+			return nil, fmt.Errorf("unknown status %q (use active, pending, sold, off_market or all)", status)
+		}
+	}
+	return statuses, nil
+}
+
+func analyticsInt(value string, fallback, max int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 || n > max {
+		return 0, fmt.Errorf("must be between 1 and %d", max)
+	}
+	return n, nil
+}
+
+// priceValues collects the prices of a group of listings
+type priceValues struct {
+	listings                 int
+	prices, perSqft, perAcre []float64
+}
+
+func (v *priceValues) add(listing analyticsListing) {
+	v.listings++
+	if listing.Price <= 0 {
+		return
+	}
+	v.prices = append(v.prices, listing.Price)
+	if listing.LivingArea > 0 {
+		v.perSqft = append(v.perSqft, listing.Price/listing.LivingArea)
+	}
+	if listing.Acres > 0 {
+		v.perAcre = append(v.perAcre, listing.Price/listing.Acres)
+	}
+}
+
+func (v *priceValues) stats(group string) PriceStats {
+	return PriceStats{
+		Group:        group,
+		Listings:     v.listings,
+		Price:        newQuartiles(v.prices),
+		PricePerSqft: newQuartiles(v.perSqft),
+		PricePerAcre: newQuartiles(v.perAcre),
+	}
+}
+
+// add counts a listing and whether it went under contract
+func (s *AbsorptionStats) add(listing analyticsListing, changes []statusChange) {
+	if statusCategory(listing.Status) == statusActive {
+		s.Active++
+	}
+	for _, change := range changes {
+		if isUnderContract(change.to) && !isUnderContract(change.from) {
+			s.Absorbed++
+			break
+		}
+	}
+}
+
+// finish computes the rates once every listing is counted
+func (s *AbsorptionStats) finish(days int) AbsorptionStats {
+	s.MonthlyAbsorbed = round2(float64(s.Absorbed) / float64(days) * 30)
+	if s.Active > 0 {
+		rate := round2(s.MonthlyAbsorbed / float64(s.Active) * 100)
+		s.AbsorptionRate = &rate
+	}
+	if s.MonthlyAbsorbed > 0 {
+		months := round2(float64(s.Active) / s.MonthlyAbsorbed)
+		s.MonthsOfInventory = &months
+	}
+	return *s
+}
+
+func isUnderContract(status string) bool {
+	category := statusCategory(status)
+	return category == statusPending || category == statusSold
+}
+
+// inventoryBuckets returns periods consecutive intervals ending at now
+func inventoryBuckets(now time.Time, interval string, periods int) []InventoryPoint {
+	step := func(t time.Time, n int) time.Time {
+		switch interval {
+		case "day":
+			return t.AddDate(0, 0, n)
+		case "month":
+			return t.AddDate(0, n, 0)
+		}
+		return t.AddDate(0, 0, 7*n)
+	}
+
+	points := make([]InventoryPoint, periods)
+	for i := range points {
+		points[i] = InventoryPoint{
+			Start:    step(now, i-periods),
+			End:      step(now, i-periods+1),
+			Statuses: map[string]int{},
+		}
+	}
+	return points
+}
+
+// statusChange is a listing status transition from home_history
+type statusChange struct {
+	at       time.Time
+	from, to string
+}
+
+// loadStatusChanges returns the status transitions since a time, oldest
+// first, keyed by listing
+func loadStatusChanges(app core.App, since time.Time) (map[string][]statusChange, error) {
+	entries, err := app.FindRecordsByFilter("home_history",
+		"status != old_status && created >= {:since}", "created", 0, 0,
+		map[string]any{"since": since.UTC().Format(outboxDateFormat)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load home history: %w", err)
+	}
+
+	changes := map[string][]statusChange{}
+	for _, entry := range entries {
+		homeID := entry.GetString("home")
+		changes[homeID] = append(changes[homeID], statusChange{
+			at:   entry.GetDateTime("created").Time(),
+			from: entry.GetString("old_status"),
+			to:   entry.GetString("status"),
+		})
+	}
+	return changes, nil
+}
+
+// statusAt returns a listing's status at a point in time by undoing the
+// changes made after it
+func statusAt(status string, changes []statusChange, t time.Time) string {
+	for i := len(changes) - 1; i >= 0 && changes[i].at.After(t); i-- {
+		status = changes[i].from
+	}
+	return status
+}
+
+// newQuartiles summarizes values, or returns nil when there are none
+func newQuartiles(values []float64) *Quartiles {
+	if len(values) == 0 {
+		return nil
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return &Quartiles{
+		Count:  len(sorted),
+		Min:    round2(sorted[0]),
+		Q1:     round2(quantile(sorted, 0.25)),
+		Median: round2(quantile(sorted, 0.5)),
+		Q3:     round2(quantile(sorted, 0.75)),
+		Max:    round2(sorted[len(sorted)-1]),
+	}
+}
+
+// quantile interpolates the q-th quantile of sorted values
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := q * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return quantile(sorted, 0.5)
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,479 @@
+package chattanooga_homes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pb-backend/jobs"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	browserHealthJob     = "homes_browser_health"
+	browserHealthTimeout = 30 * time.Second
+	browserPingTimeout   = 15 * time.Second
+)
+
+// BrowserOptions configures the shared headless browser
+type BrowserOptions struct {
+	// MaxTabs limits how many pages can be driven at once
+	MaxTabs int
+	// MemoryLimitMB restarts the browser once its process tree exceeds this RSS (0 disables)
+	MemoryLimitMB int
+	// HealthInterval is how often the browser is pinged and its memory checked
+	HealthInterval time.Duration
+	// MaxTabUses recycles a tab after this many uses to shed leaked page state (0 disables)
+	MaxTabUses int
+	// StartTimeout bounds launching the browser or opening a tab
+	StartTimeout time.Duration
+}
+
+// DefaultBrowserOptions are sized for a Raspberry Pi
+var DefaultBrowserOptions = BrowserOptions{
+	MaxTabs:        2,
+	MemoryLimitMB:  768,
+	HealthInterval: 1 * time.Minute,
+	MaxTabUses:     50,
+	StartTimeout:   1 * time.Minute,
+}
+
+// browserTab is a reusable tab in the shared browser
+type browserTab struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	generation int
+	uses       int
+}
+
+// BrowserManager owns a long-lived headless Chrome and hands out reusable
+// tabs, so periodic scrapes don't pay for a new browser each time. The
+// browser is restarted when it crashes, fails a health check or grows past
+// the memory limit.
+type BrowserManager struct {
+	opts BrowserOptions
+	sem  chan struct{}
+
+	mu            sync.Mutex
+	allocCancel   context.CancelFunc
+	browserCtx    context.Context
+	browserCancel context.CancelFunc
+	generation    int
+	idle          []*browserTab
+	inUse         int
+	needsRestart  bool
+	// launching is closed when a launch in progress finishes. Chrome starts
+	// without the lock held, so the other callers wait on it instead.
+	launching chan struct{}
+	closed    bool
+}
+
+// errBrowserClosed is returned for runs after Close
+var errBrowserClosed = errors.New("browser closed")
+
+// NewBrowserManager creates a browser manager. The browser itself is launched
+// lazily on first use.
+func NewBrowserManager(opts BrowserOptions) *BrowserManager {
+	if opts.MaxTabs <= 0 {
+		opts.MaxTabs = 1
+	}
+	if opts.StartTimeout <= 0 {
+		opts.StartTimeout = DefaultBrowserOptions.StartTimeout
+	}
+	return &BrowserManager{
+		opts: opts,
+		sem:  make(chan struct{}, opts.MaxTabs),
+	}
+}
+
+// AddJobs registers the health check job, unless HealthInterval disables it
+func (m *BrowserManager) AddJobs(runner *jobs.Runner) {
+	if m.opts.HealthInterval <= 0 {
+		return
+	}
+	runner.MustAdd(jobs.Job{
+		Name:    browserHealthJob,
+		Every:   func() time.Duration { return m.opts.HealthInterval },
+		Timeout: browserHealthTimeout,
+		Enabled: moduleEnabled,
+		Run: func(ctx context.Context) (jobs.Counts, error) {
+			restarts := 0
+			if !m.checkHealth(ctx) {
+				restarts = 1
+			}
+			return jobs.Counts{"restarts": restarts}, nil
+		},
+	})
+}
+
+// Close shuts the browser down for good. Tabs still running are closed
+// when released, and later runs fail with errBrowserClosed.
+func (m *BrowserManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	m.shutdownLocked()
+}
+
+// Run executes fn on a pooled tab with the given timeout. At most MaxTabs
+// calls run concurrently; the rest wait for a free tab. Cancelling ctx
+// stops the wait and fn.
+func (m *BrowserManager) Run(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	select {
+	case m.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-m.sem }()
+
+	tab, err := m.acquireTab()
+	if err != nil {
+		return err
+	}
+
+	// The tab's context carries the browser, so ctx can only cancel it
+	runCtx, cancel := context.WithTimeout(tab.ctx, timeout)
+	stop := context.AfterFunc(ctx, cancel)
+	err = fn(runCtx)
+	stop()
+	cancel()
+
+	m.releaseTab(tab, err)
+	return err
+}
+
+// acquireTab returns an idle tab from the current browser or opens a new
+// one. Launching the browser and opening the tab happen without the lock.
+func (m *BrowserManager) acquireTab() (*browserTab, error) {
+	m.mu.Lock()
+	for {
+		if m.closed {
+			m.mu.Unlock()
+			return nil, errBrowserClosed
+		}
+		if m.needsRestart && m.inUse == 0 {
+			log.Println("[BROWSER] Restarting browser")
+			m.shutdownLocked()
+			m.needsRestart = false
+		}
+		if m.browserCtx != nil {
+			break
+		}
+		if launching := m.launching; launching != nil {
+			m.mu.Unlock()
+			<-launching
+			m.mu.Lock()
+			continue
+		}
+		if err := m.launchLocked(); err != nil {
+			m.mu.Unlock()
+			return nil, err
+		}
+	}
+
+	for len(m.idle) > 0 {
+		tab := m.idle[len(m.idle)-1]
+		m.idle = m.idle[:len(m.idle)-1]
+		if tab.generation == m.generation && tab.ctx.Err() == nil {
+			m.inUse++
+			m.mu.Unlock()
+			return tab, nil
+		}
+		tab.cancel()
+	}
+
+	// Count the tab as in use while it opens, so a restart waits for it
+	m.inUse++
+	browserCtx, generation := m.browserCtx, m.generation
+	m.mu.Unlock()
+
+	tab, err := m.openTab(browserCtx, generation)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.inUse--
+		// A tab that can't be opened usually means the browser died
+		if generation == m.generation {
+			m.shutdownLocked()
+		}
+		return nil, err
+	}
+	if tab.ctx.Err() != nil {
+		// The browser was closed or restarted while the tab opened
+		m.inUse--
+		tab.cancel()
+		if m.closed {
+			return nil, errBrowserClosed
+		}
+		return nil, fmt.Errorf("browser restarted while opening a tab")
+	}
+	return tab, nil
+}
+
+// releaseTab returns a tab to the pool, or closes it if it is stale or
+// the run failed in a way that may have left it in a bad state
+func (m *BrowserManager) releaseTab(tab *browserTab, runErr error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inUse--
+	tab.uses++
+
+	stale := tab.generation != m.generation || tab.ctx.Err() != nil
+	worn := m.opts.MaxTabUses > 0 && tab.uses >= m.opts.MaxTabUses
+	broken := runErr != nil && !errors.Is(runErr, context.DeadlineExceeded)
+
+	if stale || worn || broken || m.needsRestart {
+		tab.cancel()
+		return
+	}
+	m.idle = append(m.idle, tab)
+}
+
+// launchLocked starts a new browser process. It is called with the lock
+// held and releases it while Chrome starts, which can take StartTimeout.
+func (m *BrowserManager) launchLocked() error {
+	launching := make(chan struct{})
+	m.launching = launching
+	m.mu.Unlock()
+
+	allocCancel, browserCtx, browserCancel, err := m.startBrowser()
+
+	m.mu.Lock()
+	m.launching = nil
+	close(launching)
+	if err != nil {
+		return err
+	}
+	if m.closed {
+		browserCancel()
+		allocCancel()
+		return errBrowserClosed
+	}
+
+	m.allocCancel = allocCancel
+	m.browserCtx = browserCtx
+	m.browserCancel = browserCancel
+	m.generation++
+
+	log.Printf("[BROWSER] Launched headless browser (generation %d)", m.generation)
+	return nil
+}
+
+// startBrowser launches Chrome and returns its contexts
+func (m *BrowserManager) startBrowser() (allocCancel context.CancelFunc, browserCtx context.Context, browserCancel context.CancelFunc, err error) {
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.Flag("headless", true),
+		chromedp.Flag("disable-gpu", true),
+		chromedp.Flag("no-sandbox", true),
+		chromedp.Flag("disable-dev-shm-usage", true),
+		chromedp.Flag("disable-blink-features", "AutomationControlled"),
+		chromedp.Flag("disable-infobars", true),
+		chromedp.Flag("start-maximized", true),
+		chromedp.Flag("disable-extensions", true),
+		chromedp.UserAgent(userAgent),
+		chromedp.WindowSize(1920, 1080),
+	)
+
+	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), opts...)
+	browserCtx, browserCancel = chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
+
+	// The first Run launches the browser. It must use the long-lived context,
+	// since chromedp ties the browser's lifetime to it, so bound it separately.
+	if err := runWithTimeout(browserCtx, m.opts.StartTimeout); err != nil {
+		browserCancel()
+		allocCancel()
+		return nil, nil, nil, fmt.Errorf("failed to launch browser: %w", err)
+	}
+	return allocCancel, browserCtx, browserCancel, nil
+}
+
+// openTab opens a new tab in the given browser with the scraper's headers
+// applied
+func (m *BrowserManager) openTab(browserCtx context.Context, generation int) (*browserTab, error) {
+	tabCtx, tabCancel := chromedp.NewContext(browserCtx)
+	if err := runWithTimeout(tabCtx, m.opts.StartTimeout); err != nil {
+		tabCancel()
+		return nil, fmt.Errorf("failed to open tab: %w", err)
+	}
+
+	headers := map[string]interface{}{
+		"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8",
+		"Accept-Language":           "en-US,en;q=0.9",
+		"Accept-Encoding":           "gzip, deflate, br",
+		"Connection":                "keep-alive",
+		"Upgrade-Insecure-Requests": "1",
+		"Sec-Fetch-Dest":            "document",
+		"Sec-Fetch-Mode":            "navigate",
+		"Sec-Fetch-Site":            "none",
+		"Sec-Fetch-User":            "?1",
+		"Cache-Control":             "max-age=0",
+	}
+
+	ctx, cancel := context.WithTimeout(tabCtx, m.opts.StartTimeout)
+	defer cancel()
+	if err := chromedp.Run(ctx, network.Enable(), network.SetExtraHTTPHeaders(network.Headers(headers))); err != nil {
+		log.Printf("[BROWSER] Warning: Could not set extra headers: %v", err)
+	}
+
+	return &browserTab{
+		ctx:        tabCtx,
+		cancel:     tabCancel,
+		generation: generation,
+	}, nil
+}
+
+// shutdownLocked closes all idle tabs and the browser. Tabs in use are
+// invalidated by the generation bump and closed when released.
+func (m *BrowserManager) shutdownLocked() {
+	for _, tab := range m.idle {
+		tab.cancel()
+	}
+	m.idle = nil
+
+	if m.browserCancel != nil {
+		m.browserCancel()
+	}
+	if m.allocCancel != nil {
+		m.allocCancel()
+	}
+	m.browserCtx = nil
+	m.browserCancel = nil
+	m.allocCancel = nil
+	m.generation++
+}
+
+// checkHealth pings the browser and checks its memory, and reports whether
+// it is healthy. Unhealthy browsers are restarted immediately if idle,
+// otherwise once the running tabs finish. The ping gives up when ctx is done
+// and runs without the lock, so tabs can be handed out meanwhile.
+func (m *BrowserManager) checkHealth(ctx context.Context) bool {
+	m.mu.Lock()
+	browserCtx, generation := m.browserCtx, m.generation
+	m.mu.Unlock()
+
+	if browserCtx == nil {
+		return true
+	}
+
+	reason := ""
+	if browserCtx.Err() != nil {
+		reason = "browser context closed"
+	} else {
+		// chromedp needs the browser's context; stop the ping with ctx too
+		pingCtx, cancel := context.WithTimeout(browserCtx, browserPingTimeout)
+		stop := context.AfterFunc(ctx, cancel)
+		var result int
+		err := chromedp.Run(pingCtx, chromedp.Evaluate(`1 + 1`, &result))
+		stop()
+		cancel()
+		if err != nil {
+			reason = fmt.Sprintf("health check failed: %v", err)
+		}
+	}
+
+	if reason == "" && m.opts.MemoryLimitMB > 0 {
+		if c := chromedp.FromContext(browserCtx); c != nil && c.Browser != nil && c.Browser.Process() != nil {
+			if rss, err := processTreeRSS(c.Browser.Process().Pid); err == nil {
+				rssMB := rss / (1024 * 1024)
+				if rssMB > int64(m.opts.MemoryLimitMB) {
+					reason = fmt.Sprintf("memory %d MB exceeds limit %d MB", rssMB, m.opts.MemoryLimitMB)
+				}
+			}
+		}
+	}
+
+	if reason == "" {
+		return true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Already replaced or closed while the check ran
+	if generation != m.generation {
+		return true
+	}
+
+	log.Printf("[BROWSER] Unhealthy: %s", reason)
+	if m.inUse == 0 {
+		m.shutdownLocked()
+	} else {
+		m.needsRestart = true
+	}
+	return false
+}
+
+// runWithTimeout performs the first Run on a chromedp context without
+// deriving a timeout from it, and gives up after d. The caller cancels ctx
+// on error, which also stops the pending Run.
+func runWithTimeout(ctx context.Context, d time.Duration) error {
+	done := make(chan error, 1)
+	go func() { done <- chromedp.Run(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(d):
+		return fmt.Errorf("timed out after %v", d)
+	}
+}
+
+// processTreeRSS returns the resident memory in bytes of pid and all its
+// descendants. It reads /proc and so only works on Linux.
+func processTreeRSS(pid int) (int64, error) {
+	statPaths, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return 0, err
+	}
+	if len(statPaths) == 0 {
+		return 0, fmt.Errorf("/proc not available")
+	}
+
+	children := make(map[int][]int)
+	rssPages := make(map[int]int64)
+	for _, path := range statPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// Format: pid (comm) state ppid ... with rss as field 24; comm may contain spaces
+		s := string(data)
+		end := strings.LastIndexByte(s, ')')
+		if end < 0 {
+			continue
+		}
+		fields := strings.Fields(s[end+1:])
+		if len(fields) < 22 {
+			continue
+		}
+		p, err1 := strconv.Atoi(strings.Fields(s[:end])[0])
+		ppid, err2 := strconv.Atoi(fields[1])
+		rss, err3 := strconv.ParseInt(fields[21], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		children[ppid] = append(children[ppid], p)
+		rssPages[p] = rss
+	}
+
+	pageSize := int64(os.Getpagesize())
+	var total int64
+	stack := []int{pid}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		total += rssPages[p] * pageSize
+		stack = append(stack, children[p]...)
+	}
+	return total, nil
+}
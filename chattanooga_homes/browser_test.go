@@ -0,0 +1,29 @@
+package chattanooga_homes
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBrowserManagerClosed(t *testing.T) {
+	m := NewBrowserManager(DefaultBrowserOptions)
+	m.Close()
+
+	// A closed manager must not launch another browser
+	ran := false
+	err := m.Run(context.Background(), time.Second, func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	if !errors.Is(err, errBrowserClosed) {
+		t.Errorf("Expected errBrowserClosed, got %v", err)
+	}
+	if ran {
+		t.Error("Expected the run to be skipped")
+	}
+	if m.launching != nil || m.browserCtx != nil {
+		t.Error("Expected no browser to be launched")
+	}
+}
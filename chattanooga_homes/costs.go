@@ -0,0 +1,249 @@
+package chattanooga_homes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// CostModel estimates the monthly cost of owning a listing. Rates are
+// percentages: InterestRate is the annual mortgage rate, the tax and
+// insurance rates are annual percentages of the price.
+type CostModel struct {
+	InterestRate       float64
+	DownPaymentPercent float64
+	TermYears          int
+	DefaultTaxRate     float64
+	CountyTaxRates     map[string]float64
+	InsuranceRate      float64
+}
+
+// DefaultCostModel is used until a home_cost_settings record is enabled.
+// Tax rates are effective rates on market value for the area's counties.
+var DefaultCostModel = CostModel{
+	InterestRate:       6.75,
+	DownPaymentPercent: 20,
+	TermYears:          30,
+	DefaultTaxRate:     0.6,
+	CountyTaxRates: map[string]float64{
+		"Hamilton":   0.62,
+		"Marion":     0.55,
+		"Sequatchie": 0.5,
+		"Bledsoe":    0.55,
+		"Rhea":       0.5,
+		"Bradley":    0.45,
+		"Catoosa":    0.8,
+		"Walker":     0.8,
+		"Dade":       0.8,
+	},
+	InsuranceRate: 0.45,
+}
+
+// MonthlyCost is the estimated monthly cost of a listing, in whole dollars
+type MonthlyCost struct {
+	Total             int     `json:"total"`
+	PrincipalInterest int     `json:"principal_interest"`
+	Tax               int     `json:"tax"`
+	Insurance         int     `json:"insurance"`
+	DownPayment       int     `json:"down_payment"`
+	LoanAmount        int     `json:"loan_amount"`
+	InterestRate      float64 `json:"interest_rate"`
+	TermYears         int     `json:"term_years"`
+	TaxRate           float64 `json:"tax_rate"`
+}
+
+// costModelFromRecord reads a home_cost_settings record
+func costModelFromRecord(record *core.Record) (*CostModel, error) {
+	model := &CostModel{
+		InterestRate:       record.GetFloat("interest_rate"),
+		DownPaymentPercent: record.GetFloat("down_payment_percent"),
+		TermYears:          record.GetInt("term_years"),
+		DefaultTaxRate:     record.GetFloat("default_tax_rate"),
+		InsuranceRate:      record.GetFloat("insurance_rate"),
+	}
+	if raw := record.GetString("county_tax_rates"); raw != "" && raw != "null" {
+		if err := record.UnmarshalJSONField("county_tax_rates", &model.CountyTaxRates); err != nil {
+			return nil, fmt.Errorf("county_tax_rates must be an object of county rates: %w", err)
+		}
+	}
+	for county, rate := range model.CountyTaxRates {
+		if rate < 0 {
+			return nil, fmt.Errorf("tax rate for %s must not be negative", county)
+		}
+	}
+	return model, nil
+}
+
+// activeCostModel returns the newest enabled cost settings, or the defaults
+func activeCostModel(app core.App) (*CostModel, error) {
+	records, err := app.FindRecordsByFilter("home_cost_settings", "enabled = true", "-updated", 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return &DefaultCostModel, nil
+	}
+	return costModelFromRecord(records[0])
+}
+
+// TaxRate returns the annual tax rate for a county, ignoring case and a
+// trailing "County"
+func (m *CostModel) TaxRate(county string) float64 {
+	county = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(county), " County"))
+	for name, rate := range m.CountyTaxRates {
+		if strings.EqualFold(name, county) {
+			return rate
+		}
+	}
+	return m.DefaultTaxRate
+}
+
+// Monthly estimates the monthly cost of a listing at a price
+func (m *CostModel) Monthly(price int, county string) MonthlyCost {
+	down := float64(price) * m.DownPaymentPercent / 100
+	loan := float64(price) - down
+	payments := float64(m.TermYears * 12)
+	rate := m.InterestRate / 100 / 12
+
+	var principalInterest float64
+	switch {
+	case loan <= 0 || payments <= 0:
+	case rate == 0:
+		principalInterest = loan / payments
+	default:
+		principalInterest = loan * rate / (1 - math.Pow(1+rate, -payments))
+	}
+
+	taxRate := m.TaxRate(county)
+	tax := float64(price) * taxRate / 100 / 12
+	insurance := float64(price) * m.InsuranceRate / 100 / 12
+
+	return MonthlyCost{
+		Total:             int(math.Round(principalInterest + tax + insurance)),
+		PrincipalInterest: int(math.Round(principalInterest)),
+		Tax:               int(math.Round(tax)),
+		Insurance:         int(math.Round(insurance)),
+		DownPayment:       int(math.Round(down)),
+		LoanAmount:        int(math.Round(loan)),
+		InterestRate:      m.InterestRate,
+		TermYears:         m.TermYears,
+		TaxRate:           taxRate,
+	}
+}
+
+// applyMonthlyCost sets a listing's monthly payment and its breakdown,
+// clearing them when the listing has no price. It reports whether
+// anything changed.
+func applyMonthlyCost(model *CostModel, record *core.Record) bool {
+	payment, details := 0, any(nil)
+	if price := record.GetInt("price"); price > 0 {
+		cost := model.Monthly(price, record.GetString("county"))
+		payment, details = cost.Total, cost
+	}
+
+	beforePayment, beforeDetails := record.GetInt("monthly_payment"), record.GetString("payment_details")
+	record.Set("monthly_payment", payment)
+	record.Set("payment_details", details)
+	return record.GetInt("monthly_payment") != beforePayment || record.GetString("payment_details") != beforeDetails
+}
+
+// paymentValue formats a listing's monthly payment for messages; ok is
+// false when there is none
+func paymentValue(record *core.Record) (value string, ok bool) {
+	payment := record.GetInt("monthly_payment")
+	if payment <= 0 {
+		return "", false
+	}
+	return fmt.Sprintf("$%s/mo", formatNumber(payment)), true
+}
+
+// registerCostHooks validates cost settings, prices listings as they are
+// saved and recalculates every listing when the settings change
+func registerCostHooks(app *pocketbase.PocketBase) {
+	app.OnRecordValidate("home_cost_settings").BindFunc(func(e *core.RecordEvent) error {
+		if _, err := costModelFromRecord(e.Record); err != nil {
+			return fmt.Errorf("invalid cost settings: %w", err)
+		}
+		return e.Next()
+	})
+
+	// Loaded once and kept until the settings change, so saving a batch of
+	// listings doesn't query the settings for each one
+	models := &modelCache[*CostModel]{load: activeCostModel}
+	priceHome := func(e *core.RecordEvent) error {
+		model, err := models.get(e.App)
+		if err != nil {
+			log.Printf("[COSTS] Error loading cost settings: %v", err)
+			return e.Next()
+		}
+		applyMonthlyCost(model, e.Record)
+		return e.Next()
+	}
+	app.OnRecordCreate("homes").BindFunc(priceHome)
+	app.OnRecordUpdate("homes").BindFunc(priceHome)
+
+	recalculate := func(e *core.RecordEvent) error {
+		models.invalidate()
+		wakeJob(costsJob)
+		return e.Next()
+	}
+	app.OnRecordAfterCreateSuccess("home_cost_settings").BindFunc(recalculate)
+	app.OnRecordAfterUpdateSuccess("home_cost_settings").BindFunc(recalculate)
+	app.OnRecordAfterDeleteSuccess("home_cost_settings").BindFunc(recalculate)
+}
+
+// modelCache holds the active cost or scoring model between listing saves
+type modelCache[T any] struct {
+	load func(app core.App) (T, error)
+
+	mu     sync.Mutex
+	loaded bool
+	model  T
+}
+
+// get returns the cached model, loading it if needed
+func (c *modelCache[T]) get(app core.App) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.loaded {
+		model, err := c.load(app)
+		if err != nil {
+			return model, err
+		}
+		c.model, c.loaded = model, true
+	}
+	return c.model, nil
+}
+
+// invalidate makes the next get reload the model
+func (c *modelCache[T]) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var zero T
+	c.model, c.loaded = zero, false
+}
+
+// RecalculateHomeCosts prices every listing with the active settings and
+// saves the ones whose payment changed
+func RecalculateHomeCosts(ctx context.Context, app core.App) (updated int, err error) {
+	model, err := activeCostModel(app)
+	if err != nil {
+		return 0, err
+	}
+
+	updated, err = updateAllHomes(ctx, app, func(record *core.Record) bool {
+		return applyMonthlyCost(model, record)
+	})
+	if err != nil {
+		return updated, err
+	}
+
+	log.Printf("[COSTS] Recalculated listings: %d changed", updated)
+	return updated, nil
+}
@@ -0,0 +1,67 @@
+package chattanooga_homes
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestCostModelMonthly(t *testing.T) {
+	cost := DefaultCostModel.Monthly(300000, "Hamilton County")
+	expected := MonthlyCost{
+		Total:             1824,
+		PrincipalInterest: 1557,
+		Tax:               155,
+		Insurance:         113,
+		DownPayment:       60000,
+		LoanAmount:        240000,
+		InterestRate:      6.75,
+		TermYears:         30,
+		TaxRate:           0.62,
+	}
+	if cost != expected {
+		t.Errorf("Monthly(300000, Hamilton County) = %+v, expected %+v", cost, expected)
+	}
+}
+
+func TestCostModelEdgeCases(t *testing.T) {
+	zeroRate := CostModel{TermYears: 10, DefaultTaxRate: 1.2}
+	if cost := zeroRate.Monthly(120000, "Elsewhere"); cost.PrincipalInterest != 1000 || cost.Tax != 120 {
+		t.Errorf("Expected a zero-interest loan to be repaid evenly, got %+v", cost)
+	}
+
+	cash := CostModel{InterestRate: 7, DownPaymentPercent: 100, TermYears: 30}
+	if cost := cash.Monthly(200000, ""); cost.PrincipalInterest != 0 || cost.LoanAmount != 0 {
+		t.Errorf("Expected no loan payment with 100%% down, got %+v", cost)
+	}
+
+	if rate := DefaultCostModel.TaxRate(" walker "); rate != 0.8 {
+		t.Errorf("Expected county lookups to ignore case and spaces, got %v", rate)
+	}
+	if rate := DefaultCostModel.TaxRate("Unknown"); rate != DefaultCostModel.DefaultTaxRate {
+		t.Errorf("Expected unknown counties to use the default rate, got %v", rate)
+	}
+}
+
+func TestModelCache(t *testing.T) {
+	loads := 0
+	cache := &modelCache[*CostModel]{load: func(app core.App) (*CostModel, error) {
+		loads++
+		return &DefaultCostModel, nil
+	}}
+
+	for range 3 {
+		if _, err := cache.get(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("Expected one load for repeated gets, got %d", loads)
+	}
+
+	cache.invalidate()
+	cache.get(nil)
+	if loads != 2 {
+		t.Errorf("Expected a reload after invalidate, got %d loads", loads)
+	}
+}
@@ -0,0 +1,454 @@
+package chattanooga_homes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"pb-backend/jobs"
+	"pb-backend/notify"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/cron"
+)
+
+// Digest periods
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+const (
+	// Default schedules: 8am every day, 8am every Monday
+	defaultDailySchedule  = "0 8 * * *"
+	defaultWeeklySchedule = "0 8 * * 1"
+
+	// Listings shown per digest section
+	digestSectionLimit = 10
+)
+
+// registerDigestHooks rejects digests with an invalid schedule or target
+func registerDigestHooks(app *pocketbase.PocketBase) {
+	app.OnRecordValidate("home_digests").BindFunc(func(e *core.RecordEvent) error {
+		if _, err := cron.NewSchedule(digestSchedule(e.Record)); err != nil {
+			return fmt.Errorf("invalid digest schedule: %w", err)
+		}
+		// Discord destinations depend on the bot config and are checked
+		// when sending
+		switch e.Record.GetString("delivery") {
+		case notify.KindDiscordChannel, notify.KindDiscordDM:
+		default:
+			if _, err := notify.ForTarget(e.App, e.Record.GetString("delivery"), e.Record.GetString("target")); err != nil {
+				return err
+			}
+		}
+		return e.Next()
+	})
+}
+
+// digestSchedule returns the digest's cron expression, defaulting by period
+func digestSchedule(record *core.Record) string {
+	if schedule := strings.TrimSpace(record.GetString("schedule")); schedule != "" {
+		return schedule
+	}
+	if record.GetString("period") == DigestWeekly {
+		return defaultWeeklySchedule
+	}
+	return defaultDailySchedule
+}
+
+// PriceDrop is a price reduction seen during the digest period
+type PriceDrop struct {
+	Home     *core.Record
+	OldPrice int
+	NewPrice int
+}
+
+// StatusChange is a listing going pending or sold during the digest period
+type StatusChange struct {
+	Home      *core.Record
+	Status    string
+	ChangedAt time.Time
+}
+
+// CountyPricePerAcre is the median price per acre of a county's listings
+type CountyPricePerAcre struct {
+	County   string
+	Median   float64
+	Listings int
+}
+
+// MarketDigest summarizes listing activity over a period
+type MarketDigest struct {
+	Period string
+	Start  time.Time
+	End    time.Time
+
+	NewListings []*core.Record
+	PriceDrops  []PriceDrop
+	WentPending []StatusChange
+	Sold        []StatusChange
+
+	PricePerAcre []CountyPricePerAcre
+
+	// Average days from first seen to pending/sold, for listings that went
+	// under contract or sold during the period
+	AvgDaysOnMarket float64
+	// Average days on market of the currently active inventory
+	ActiveDaysOnMarket float64
+	ActiveListings     int
+}
+
+// BuildMarketDigest gathers the digest for the period ending at end
+func BuildMarketDigest(app core.App, period string, end time.Time) (*MarketDigest, error) {
+	start := end.AddDate(0, 0, -1)
+	if period == DigestWeekly {
+		start = end.AddDate(0, 0, -7)
+	}
+
+	digest := &MarketDigest{Period: period, Start: start, End: end}
+	params := map[string]any{
+		"start": start.UTC().Format(outboxDateFormat),
+		"end":   end.UTC().Format(outboxDateFormat),
+	}
+
+	newListings, err := app.FindRecordsByFilter("homes",
+		"first_seen >= {:start} && first_seen < {:end}", "-price", 0, 0, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find new listings: %w", err)
+	}
+	digest.NewListings = newListings
+
+	if err := digest.addHistory(app, params); err != nil {
+		return nil, err
+	}
+	if err := digest.addInventory(app, params); err != nil {
+		return nil, err
+	}
+
+	return digest, nil
+}
+
+// addHistory collects price drops and pending/sold transitions from
+// home_history, keeping the latest change per listing
+func (d *MarketDigest) addHistory(app core.App, params map[string]any) error {
+	entries, err := app.FindRecordsByFilter("home_history",
+		"event = 'updated' && created >= {:start} && created < {:end}", "created", 0, 0, params)
+	if err != nil {
+		return fmt.Errorf("failed to find home history: %w", err)
+	}
+
+	drops := map[string]*PriceDrop{}
+	transitions := map[string]StatusChange{}
+	homes := map[string]*core.Record{}
+	var dropOrder, transitionOrder []string
+	ordered := map[string]bool{}
+
+	for _, entry := range entries {
+		homeID := entry.GetString("home")
+		if _, ok := homes[homeID]; !ok {
+			home, err := app.FindRecordById("homes", homeID)
+			if err != nil {
+				continue
+			}
+			homes[homeID] = home
+		}
+
+		oldPrice, price := entry.GetInt("old_price"), entry.GetInt("price")
+		if price > 0 && oldPrice > price {
+			if drop, ok := drops[homeID]; ok {
+				// Report several drops in the period as one
+				drop.NewPrice = price
+			} else {
+				drops[homeID] = &PriceDrop{Home: homes[homeID], OldPrice: oldPrice, NewPrice: price}
+				dropOrder = append(dropOrder, homeID)
+			}
+		}
+
+		status := entry.GetString("status")
+		category := statusCategory(status)
+		if category == statusCategory(entry.GetString("old_status")) {
+			continue
+		}
+		if category == statusPending || category == statusSold {
+			if !ordered[homeID] {
+				ordered[homeID] = true
+				transitionOrder = append(transitionOrder, homeID)
+			}
+			transitions[homeID] = StatusChange{
+				Home:      homes[homeID],
+				Status:    status,
+				ChangedAt: entry.GetDateTime("created").Time(),
+			}
+		} else {
+			// Back on the market; it no longer counts
+			delete(transitions, homeID)
+		}
+	}
+
+	for _, homeID := range dropOrder {
+		if drop := drops[homeID]; drop.NewPrice < drop.OldPrice {
+			d.PriceDrops = append(d.PriceDrops, *drop)
+		}
+	}
+
+	var days float64
+	for _, homeID := range transitionOrder {
+		change, ok := transitions[homeID]
+		if !ok {
+			continue
+		}
+		if statusCategory(change.Status) == statusSold {
+			d.Sold = append(d.Sold, change)
+		} else {
+			d.WentPending = append(d.WentPending, change)
+		}
+		days += daysBetween(listedSince(change.Home), change.ChangedAt)
+	}
+	if n := len(d.Sold) + len(d.WentPending); n > 0 {
+		d.AvgDaysOnMarket = days / float64(n)
+	}
+
+	return nil
+}
+
+// addInventory computes median price per acre by county over listings seen
+// during the period, and days on market of the active inventory
+func (d *MarketDigest) addInventory(app core.App, params map[string]any) error {
+	records, err := app.FindRecordsByFilter("homes", "last_seen >= {:start}", "", 0, 0, params)
+	if err != nil {
+		return fmt.Errorf("failed to find listings: %w", err)
+	}
+
+	perAcre := map[string][]float64{}
+	var activeDays float64
+	for _, record := range records {
+		price, acres := record.GetFloat("price"), record.GetFloat("acres")
+		if price > 0 && acres > 0 {
+			county := strings.TrimSpace(record.GetString("county"))
+			if county == "" {
+				county = "Unknown"
+			}
+			perAcre[county] = append(perAcre[county], price/acres)
+		}
+
+		if statusCategory(record.GetString("status")) == statusActive {
+			d.ActiveListings++
+			activeDays += daysBetween(listedSince(record), d.End)
+		}
+	}
+	if d.ActiveListings > 0 {
+		d.ActiveDaysOnMarket = activeDays / float64(d.ActiveListings)
+	}
+
+	for county, values := range perAcre {
+		d.PricePerAcre = append(d.PricePerAcre, CountyPricePerAcre{
+			County:   county,
+			Median:   median(values),
+			Listings: len(values),
+		})
+	}
+	sort.Slice(d.PricePerAcre, func(i, j int) bool {
+		return d.PricePerAcre[i].County < d.PricePerAcre[j].County
+	})
+
+	return nil
+}
+
+// Message renders the digest as a single notification: a summary embed
+// followed by one section per topic
+func (d *MarketDigest) Message() notify.Message {
+	label := "Daily"
+	if d.Period == DigestWeekly {
+		label = "Weekly"
+	}
+
+	msg := notify.Message{
+		Summary:   fmt.Sprintf("%s homes market digest", label),
+		Title:     fmt.Sprintf("📈 %s market digest", label),
+		Text:      fmt.Sprintf("%s – %s", d.Start.Format("Jan 2 3:04 PM"), d.End.Format("Jan 2 3:04 PM")),
+		Color:     0x3498DB,
+		Timestamp: d.End,
+		Fields: []notify.Field{
+			{Name: "🆕 New Listings", Value: fmt.Sprintf("%d", len(d.NewListings)), Inline: true},
+			{Name: "📉 Price Drops", Value: fmt.Sprintf("%d", len(d.PriceDrops)), Inline: true},
+			{Name: "🤝 Went Pending", Value: fmt.Sprintf("%d", len(d.WentPending)), Inline: true},
+			{Name: "🏁 Sold", Value: fmt.Sprintf("%d", len(d.Sold)), Inline: true},
+			{Name: "⏱️ Avg Days on Market", Value: formatDays(d.AvgDaysOnMarket, len(d.WentPending)+len(d.Sold)), Inline: true},
+			{Name: "🏘️ Active Inventory", Value: fmt.Sprintf("%d (avg %s)", d.ActiveListings, formatDays(d.ActiveDaysOnMarket, d.ActiveListings)), Inline: true},
+		},
+	}
+
+	if len(d.NewListings) > 0 {
+		var fields []notify.Field
+		for _, record := range d.NewListings {
+			fields = append(fields, notify.Field{Name: record.GetString("street"), Value: digestListingSummary(record)})
+		}
+		msg.Sections = append(msg.Sections, digestSection("🆕 New Listings", fields, 0x00FF00))
+	}
+
+	if len(d.PriceDrops) > 0 {
+		var fields []notify.Field
+		for _, drop := range d.PriceDrops {
+			pct := float64(drop.OldPrice-drop.NewPrice) / float64(drop.OldPrice) * 100
+			fields = append(fields, notify.Field{
+				Name:  drop.Home.GetString("street"),
+				Value: fmt.Sprintf("~~$%s~~ $%s (-%.1f%%)", formatNumber(drop.OldPrice), formatNumber(drop.NewPrice), pct),
+			})
+		}
+		msg.Sections = append(msg.Sections, digestSection("📉 Price Drops", fields, 0xE67E22))
+	}
+
+	if changes := append(append([]StatusChange{}, d.WentPending...), d.Sold...); len(changes) > 0 {
+		var fields []notify.Field
+		for _, change := range changes {
+			days := daysBetween(listedSince(change.Home), change.ChangedAt)
+			fields = append(fields, notify.Field{
+				Name:  change.Home.GetString("street"),
+				Value: fmt.Sprintf("%s · $%s · %.0f days", change.Status, formatNumber(change.Home.GetInt("price")), days),
+			})
+		}
+		msg.Sections = append(msg.Sections, digestSection("🤝 Pending / Sold", fields, 0xF1C40F))
+	}
+
+	if len(d.PricePerAcre) > 0 {
+		var fields []notify.Field
+		for _, county := range d.PricePerAcre {
+			fields = append(fields, notify.Field{
+				Name:   county.County,
+				Value:  fmt.Sprintf("$%s/acre (%d)", formatNumber(int(county.Median)), county.Listings),
+				Inline: true,
+			})
+		}
+		msg.Sections = append(msg.Sections, digestSection("🌳 Median Price per Acre", fields, 0x27AE60))
+	}
+
+	return msg
+}
+
+// digestSection builds a section, listing at most digestSectionLimit items
+func digestSection(title string, fields []notify.Field, color int) notify.Message {
+	section := notify.Message{Title: title, Color: color, Fields: fields}
+	if len(fields) > digestSectionLimit {
+		section.Fields = fields[:digestSectionLimit]
+		section.Text = fmt.Sprintf("…and %d more", len(fields)-digestSectionLimit)
+	}
+	return section
+}
+
+func digestListingSummary(record *core.Record) string {
+	parts := []string{"$" + formatNumber(record.GetInt("price"))}
+	if record.GetString("relisted_from") != "" {
+		parts = append(parts, fmt.Sprintf("🔁 relisted, was $%s", formatNumber(record.GetInt("relisted_price"))))
+	}
+	if beds := record.GetInt("beds_total"); beds > 0 {
+		parts = append(parts, fmt.Sprintf("%d bd", beds))
+	}
+	if acres := record.GetFloat("acres"); acres > 0 {
+		parts = append(parts, fmt.Sprintf("%.2f ac", acres))
+	}
+	if city := record.GetString("city"); city != "" {
+		parts = append(parts, city)
+	}
+	return strings.Join(parts, " · ")
+}
+
+func formatDays(days float64, samples int) string {
+	if samples == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.0f days", days)
+}
+
+func daysBetween(from, to time.Time) float64 {
+	if from.IsZero() || to.Before(from) {
+		return 0
+	}
+	return to.Sub(from).Hours() / 24
+}
+
+// DigestWorker sends enabled digests when their schedule is due. Digests
+// are re-read every run, so edits take effect without a restart.
+type DigestWorker struct {
+	app *pocketbase.PocketBase
+}
+
+// NewDigestWorker creates a new digest worker
+func NewDigestWorker(app *pocketbase.PocketBase) *DigestWorker {
+	return &DigestWorker{app: app}
+}
+
+// AddJobs registers the job that checks for due digests every minute
+func (w *DigestWorker) AddJobs(runner *jobs.Runner) {
+	runner.MustAdd(jobs.Job{
+		Name:     "homes_digests",
+		Schedule: "* * * * *",
+		Enabled:  moduleEnabled,
+		Run: func(ctx context.Context) (jobs.Counts, error) {
+			sent, err := w.sendDue(time.Now())
+			return jobs.Counts{"sent": sent}, err
+		},
+	})
+}
+
+// sendDue sends every enabled digest whose schedule matches this minute
+// and that has not been sent during it yet. A failed digest does not stop
+// the others; the last error is returned.
+func (w *DigestWorker) sendDue(now time.Time) (sent int, err error) {
+	records, err := w.app.FindRecordsByFilter("home_digests", "enabled = true", "", 0, 0)
+	if err != nil {
+		return 0, fmt.Errorf("loading digests: %w", err)
+	}
+
+	minute := now.Truncate(time.Minute)
+	moment := cron.NewMoment(now)
+	for _, record := range records {
+		schedule, scheduleErr := cron.NewSchedule(digestSchedule(record))
+		if scheduleErr != nil {
+			log.Printf("[DIGEST] Invalid schedule for %s: %v", record.GetString("name"), scheduleErr)
+			continue
+		}
+		if !schedule.IsDue(moment) || !record.GetDateTime("last_sent_at").Time().Before(minute) {
+			continue
+		}
+
+		if sendErr := SendHomeDigest(w.app, record, now); sendErr != nil {
+			log.Printf("[DIGEST] Error sending %s: %v", record.GetString("name"), sendErr)
+			err = sendErr
+			continue
+		}
+		sent++
+	}
+	return sent, err
+}
+
+// SendHomeDigest builds and delivers a digest record's digest for the
+// period ending at end, and records when it was sent
+func SendHomeDigest(app core.App, record *core.Record, end time.Time) error {
+	digest, err := BuildMarketDigest(app, record.GetString("period"), end)
+	if err != nil {
+		return err
+	}
+
+	notifier, err := notify.ForTarget(app, record.GetString("delivery"), record.GetString("target"))
+	if err != nil {
+		return err
+	}
+	if _, err := notifier.Send(digest.Message()); err != nil {
+		return err
+	}
+
+	record.Set("last_sent_at", end)
+	if err := app.Save(record); err != nil {
+		return err
+	}
+
+	log.Printf("[DIGEST] Sent %s digest %q: %d new, %d price drops, %d pending, %d sold",
+		digest.Period, record.GetString("name"), len(digest.NewListings), len(digest.PriceDrops),
+		len(digest.WentPending), len(digest.Sold))
+	return nil
+}
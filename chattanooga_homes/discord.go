@@ -1,433 +1,285 @@
 package chattanooga_homes
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"sync"
 	"time"
 
+	"pb-backend/discord"
+	"pb-backend/notify"
+
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 )
 
-// Discord API endpoints
-const (
-	discordAPIBase = "https://discord.com/api/v10"
-)
-
-var (
-	discordSendMu     sync.Mutex
-	lastDiscordSendAt time.Time
-	discordMinSpacing = 1 * time.Second // ~1 msg/sec
-)
-
-// DiscordConfig holds the Discord bot configuration
-type DiscordConfig struct {
-	BotToken       string
-	HomesChannelID string
-}
-
-// DiscordEmbed represents a Discord embed message
-type DiscordEmbed struct {
-	Title       string              `json:"title,omitempty"`
-	Description string              `json:"description,omitempty"`
-	Color       int                 `json:"color,omitempty"`
-	Fields      []DiscordEmbedField `json:"fields,omitempty"`
-	Image       *DiscordEmbedImage  `json:"image,omitempty"`
-	Thumbnail   *DiscordEmbedImage  `json:"thumbnail,omitempty"`
-	URL         string              `json:"url,omitempty"`
-	Timestamp   string              `json:"timestamp,omitempty"`
-}
+// homesModule is the module name used in discord_routes
+const homesModule = "homes"
 
-type DiscordEmbedField struct {
-	Name   string `json:"name"`
-	Value  string `json:"value"`
-	Inline bool   `json:"inline,omitempty"`
+// homeDiscordPosts returns the discord_posts records for a listing
+func homeDiscordPosts(app core.App, homeID string) ([]*core.Record, error) {
+	return app.FindRecordsByFilter("discord_posts", "home = {:home}", "created", 0, 0, map[string]any{"home": homeID})
 }
 
-type DiscordEmbedImage struct {
-	URL string `json:"url"`
-}
-
-type DiscordMessage struct {
-	Content string         `json:"content,omitempty"`
-	Embeds  []DiscordEmbed `json:"embeds,omitempty"`
-}
-
-type DiscordMessageResponse struct {
-	ID string `json:"id"`
-}
-
-// CreateDiscordConfigSchema creates the discord_config collection
-func CreateDiscordConfigSchema(app *pocketbase.PocketBase) error {
-	existing, _ := app.FindCollectionByNameOrId("discord_config")
-	if existing != nil {
-		return nil
+// homeSubject describes a listing for discord_routes matching
+func homeSubject(record *core.Record) discord.Subject {
+	return discord.Subject{
+		County: record.GetString("county"),
+		Status: record.GetString("status"),
+		Price:  record.GetInt("price"),
 	}
-
-	collection := core.NewBaseCollection("discord_config")
-
-	collection.Fields.Add(&core.TextField{
-		Name:     "name",
-		Required: true,
-	})
-	collection.Fields.Add(&core.TextField{
-		Name:     "bot_token",
-		Required: true,
-	})
-	collection.Fields.Add(&core.TextField{
-		Name:     "homes_channel_id",
-		Required: true,
-	})
-
-	collection.Indexes = []string{
-		"CREATE UNIQUE INDEX idx_discord_config_name ON discord_config (name)",
-	}
-
-	return app.Save(collection)
 }
 
-// GetDiscordConfig fetches the Discord configuration from the database
-func GetDiscordConfig(app *pocketbase.PocketBase) (*DiscordConfig, error) {
-	record, err := app.FindFirstRecordByFilter("discord_config", "name = 'default'")
+// PostHomeToDiscord posts a listing to every channel its routes resolve to
+// that it hasn't been posted to yet, so it is safe to retry. It returns the
+// number of new posts.
+func PostHomeToDiscord(app *pocketbase.PocketBase, record *core.Record) (int, error) {
+	targets, err := discord.ResolveTargets(app, homesModule, homeSubject(record))
 	if err != nil {
-		return nil, fmt.Errorf("discord config not found: %w", err)
+		return 0, err
 	}
 
-	return &DiscordConfig{
-		BotToken:       record.GetString("bot_token"),
-		HomesChannelID: record.GetString("homes_channel_id"),
-	}, nil
-}
+	posts, err := homeDiscordPosts(app, record.Id)
+	if err != nil {
+		return 0, err
+	}
+	posted := make(map[string]bool, len(posts))
+	for _, post := range posts {
+		posted[post.GetString("config")+"|"+post.GetString("channel_id")] = true
+	}
 
-// PostHomeToDiscord posts a new home listing to the Discord channel
-func PostHomeToDiscord(app *pocketbase.PocketBase, record *core.Record) (string, error) {
-	config, err := GetDiscordConfig(app)
+	collection, err := app.FindCollectionByNameOrId("discord_posts")
 	if err != nil {
-		return "", err
+		return 0, fmt.Errorf("failed to find discord_posts collection: %w", err)
 	}
 
-	embed := buildHomeEmbed(record, false)
+	count := 0
+	var errs []error
+	for _, target := range targets {
+		if posted[target.Key()] {
+			continue
+		}
+
+		messageID, err := sendListing(app, target.Config, target.ChannelID, record)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("channel %s: %w", target.ChannelID, err))
+			continue
+		}
 
-	messageID, err := sendDiscordMessage(config, config.HomesChannelID, DiscordMessage{
-		Embeds: []DiscordEmbed{embed},
-	})
-	if err != nil {
-		return "", err
+		post := core.NewRecord(collection)
+		post.Set("home", record.Id)
+		post.Set("config", target.Config.ID)
+		post.Set("channel_id", target.ChannelID)
+		post.Set("message_id", messageID)
+		if err := app.Save(post); err != nil {
+			errs = append(errs, fmt.Errorf("failed to save post for channel %s: %w", target.ChannelID, err))
+			continue
+		}
+		count++
 	}
 
-	return messageID, nil
+	return count, errors.Join(errs...)
+}
+
+// sendListing posts the listing embed and buttons to a channel
+func sendListing(app core.App, config *discord.Config, channelID string, record *core.Record) (string, error) {
+	return discord.SendMessage(config, channelID, notify.DiscordMessage(homeMessage(app, record, false)))
 }
 
-// PostUpdateToDiscordThread creates a thread and posts the update
-func PostUpdateToDiscordThread(app *pocketbase.PocketBase, record *core.Record, changes []FieldChange) error {
-	config, err := GetDiscordConfig(app)
+// PostUpdateToDiscordThread posts the update to the thread of every post of
+// the listing, creating, unarchiving or recreating threads (and reposting the
+// listing) as needed. Listings that now match routes they weren't posted to,
+// for example after going pending or dropping into a new price band, are
+// posted to those channels.
+//
+// delivered holds the discord_posts IDs whose thread already has this
+// update; they are skipped, and posts updated now are added, so a retry
+// after a partial failure only goes to the threads that failed.
+func PostUpdateToDiscordThread(app *pocketbase.PocketBase, record *core.Record, changes []FieldChange, delivered map[string]bool) error {
+	posts, err := homeDiscordPosts(app, record.Id)
 	if err != nil {
 		return err
 	}
 
-	messageID := record.GetString("discord_message_id")
-	if messageID == "" {
-		return fmt.Errorf("no discord message ID found for listing")
+	var errs []error
+	existing := make(map[string]bool, len(posts))
+	for _, post := range posts {
+		existing[post.Id] = true
+		if delivered[post.Id] {
+			continue
+		}
+		if err := postUpdateToThread(app, post, record, changes); err != nil {
+			errs = append(errs, fmt.Errorf("channel %s: %w", post.GetString("channel_id"), err))
+			continue
+		}
+		delivered[post.Id] = true
 	}
 
-	// Create or get thread from the original message
-	threadName := listingTitle(record)
-	threadID, err := createThreadFromMessage(config, config.HomesChannelID, messageID, threadName)
+	posted, err := PostHomeToDiscord(app, record)
 	if err != nil {
-		return fmt.Errorf("failed to create thread: %w", err)
+		errs = append(errs, err)
+	}
+	if posted > 0 {
+		log.Printf("[DISCORD] Posted %s to %d newly matching channels", record.GetString("street"), posted)
+		// New posts already show the change; don't update their threads on retry
+		if posts, err := homeDiscordPosts(app, record.Id); err == nil {
+			for _, post := range posts {
+				if !existing[post.Id] {
+					delivered[post.Id] = true
+				}
+			}
+		}
 	}
 
-	// Post update to the thread
-	embed := buildUpdateEmbed(record, changes)
-	_, err = sendDiscordMessage(config, threadID, DiscordMessage{
-		Embeds: []DiscordEmbed{embed},
-	})
-
-	return err
+	return errors.Join(errs...)
 }
 
-// buildHomeEmbed creates a Discord embed for a home listing
-func buildHomeEmbed(record *core.Record, isUpdate bool) DiscordEmbed {
-	city := record.GetString("city")
-	state := record.GetString("state")
-	zip := record.GetString("zip")
-	price := record.GetInt("price")
-	beds := record.GetInt("beds_total")
-	baths := record.GetFloat("baths_total")
-	sqft := record.GetInt("living_area")
-	acres := record.GetFloat("acres")
-	yearBuilt := record.GetInt("year_built")
-	subType := record.GetString("sub_type")
-	county := record.GetString("county")
-	status := record.GetString("status")
-	url := record.GetString("url")
-	imageURL := record.GetString("image_url")
-	title := listingTitle(record)
-
-	// Green for new, blue for update
-	color := 0x2ECC71 // Green
-	if isUpdate {
-		color = 0x3498DB // Blue
-	}
-
-	embed := DiscordEmbed{
-		Title:     title,
-		URL:       url,
-		Color:     color,
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-		Fields: []DiscordEmbedField{
-			{Name: "💰 Price", Value: fmt.Sprintf("$%s", formatNumber(price)), Inline: true},
-			{Name: "📍 Location", Value: fmt.Sprintf("%s, %s %s", city, state, zip), Inline: true},
-			{Name: "🏘️ Type", Value: subType, Inline: true},
-			{Name: "📊 Status", Value: status, Inline: true},
-			{Name: "🛏️ Beds", Value: fmt.Sprintf("%d", beds), Inline: true},
-			{Name: "🛁 Baths", Value: fmt.Sprintf("%.1f", baths), Inline: true},
-			{Name: "📐 Sq Ft", Value: formatNumber(sqft), Inline: true},
-			{Name: "🌳 Acres", Value: fmt.Sprintf("%.2f", acres), Inline: true},
-			{Name: "📅 Year Built", Value: fmt.Sprintf("%d", yearBuilt), Inline: true},
-			{Name: "🗺️ County", Value: county, Inline: true},
-		},
+func postUpdateToThread(app *pocketbase.PocketBase, post, record *core.Record, changes []FieldChange) error {
+	config, err := discord.GetConfigByID(app, post.GetString("config"))
+	if err != nil {
+		return err
 	}
 
-	if imageURL != "" {
-		// Use full-size image to make it prominent (Discord shows near the top of the embed stack).
-		embed.Image = &DiscordEmbedImage{URL: imageURL}
+	threadID, reposted, err := ensureDiscordThread(app, config, post, record)
+	if err != nil {
+		return fmt.Errorf("failed to get thread: %w", err)
 	}
 
-	return embed
-}
-
-// buildUpdateEmbed creates a Discord embed for listing updates
-func buildUpdateEmbed(record *core.Record, changes []FieldChange) DiscordEmbed {
-	title := listingTitle(record)
-
-	// Build fields for each change with old -> new format
-	var fields []DiscordEmbedField
-
-	for _, change := range changes {
-		fieldName := formatFieldName(change.Field)
-		oldStr := formatFieldValue(change.Field, change.OldValue)
-		newStr := formatFieldValue(change.Field, change.NewValue)
-
-		fields = append(fields, DiscordEmbedField{
-			Name:   fieldName,
-			Value:  fmt.Sprintf("%s → %s", oldStr, newStr),
-			Inline: true,
+	if reposted {
+		_, err = discord.SendMessage(config, threadID, discord.Message{
+			Content: "ℹ️ The original listing post was deleted, so it has been reposted.",
 		})
+		if err != nil {
+			log.Printf("[DISCORD] Error posting repost notice: %v", err)
+		}
 	}
 
-	return DiscordEmbed{
-		Title:     title,
-		Color:     0xF39C12, // Orange
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-		Fields:    fields,
-	}
-}
-
-// listingTitle produces a consistent title for embeds and threads
-func listingTitle(record *core.Record) string {
-	street := record.GetString("street")
-	return fmt.Sprintf("🏠 %s", street)
-}
+	// Post update to the thread
+	_, err = discord.SendMessage(config, threadID, notify.DiscordMessage(updateMessage(record, changes)))
 
-// formatFieldName converts field names to display names with emojis
-func formatFieldName(field string) string {
-	names := map[string]string{
-		"price":       "💰 Price",
-		"status":      "📊 Status",
-		"street":      "🏠 Street",
-		"city":        "📍 City",
-		"state":       "📍 State",
-		"zip":         "📍 Zip",
-		"sub_type":    "🏘️ Type",
-		"county":      "🗺️ County",
-		"area":        "🗺️ Area",
-		"subdivision": "🏘️ Subdivision",
-		"living_area": "📐 Sq Ft",
-		"beds_total":  "🛏️ Beds",
-		"baths_total": "🛁 Baths",
-		"acres":       "🌳 Acres",
-		"year_built":  "📅 Year Built",
-		"url":         "🔗 URL",
-		"image_url":   "🖼️ Image",
-	}
-	if name, ok := names[field]; ok {
-		return name
-	}
-	return field
+	return err
 }
 
-// formatFieldValue formats a field value for display
-func formatFieldValue(field string, value interface{}) string {
-	if value == nil {
-		return "N/A"
-	}
-
-	switch field {
-	case "price":
-		if v, ok := value.(float64); ok {
-			return fmt.Sprintf("$%s", formatNumber(int(v)))
+// ensureDiscordThread returns a usable thread for a post. A stored thread is
+// unarchived if needed; a missing thread is created from the listing
+// message; if that message was deleted, the listing is reposted and the
+// thread created on the new message. New IDs are saved to the post.
+func ensureDiscordThread(app *pocketbase.PocketBase, config *discord.Config, post, record *core.Record) (threadID string, reposted bool, err error) {
+	channelID := post.GetString("channel_id")
+	messageID := post.GetString("message_id")
+	threadID = post.GetString("thread_id")
+
+	if threadID != "" {
+		err := discord.UnarchiveThread(config, threadID)
+		if err == nil {
+			return threadID, false, nil
 		}
-		if v, ok := value.(int); ok {
-			return fmt.Sprintf("$%s", formatNumber(v))
+		if !discord.IsNotFound(err) {
+			return "", false, err
 		}
-	case "living_area":
-		if v, ok := value.(float64); ok {
-			return fmt.Sprintf("%s sq ft", formatNumber(int(v)))
-		}
-		if v, ok := value.(int); ok {
-			return fmt.Sprintf("%s sq ft", formatNumber(v))
+		log.Printf("[DISCORD] Thread %s no longer exists, recreating", threadID)
+		threadID = ""
+	}
+
+	threadName := listingTitle(record)
+	threadID, err = discord.CreateThread(config, channelID, messageID, threadName)
+	switch {
+	case err == nil:
+		// Created a new thread
+
+	case discord.IsErrorCode(err, discord.ErrThreadAlreadyCreated):
+		// A thread started from a message shares the message's ID
+		threadID = messageID
+		if err := discord.UnarchiveThread(config, threadID); err != nil {
+			return "", false, err
 		}
-	case "acres":
-		if v, ok := value.(float64); ok {
-			return fmt.Sprintf("%.2f", v)
+
+	case discord.IsNotFound(err):
+		log.Printf("[DISCORD] Listing message %s was deleted, reposting", messageID)
+		messageID, err = sendListing(app, config, channelID, record)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to repost listing: %w", err)
 		}
-	case "baths_total":
-		if v, ok := value.(float64); ok {
-			return fmt.Sprintf("%.1f", v)
+		threadID, err = discord.CreateThread(config, channelID, messageID, threadName)
+		if err != nil {
+			return "", false, err
 		}
+		reposted = true
+
+	default:
+		return "", false, err
 	}
 
-	return fmt.Sprintf("%v", value)
-}
+	post.Set("message_id", messageID)
+	post.Set("thread_id", threadID)
+	if err := app.Save(post); err != nil {
+		log.Printf("[DISCORD] Error saving thread ID: %v", err)
+	}
 
-// sendDiscordMessage sends a message to a Discord channel
-func sendDiscordMessage(config *DiscordConfig, channelID string, message DiscordMessage) (string, error) {
-	url := fmt.Sprintf("%s/channels/%s/messages", discordAPIBase, channelID)
+	return threadID, reposted, nil
+}
 
-	body, err := json.Marshal(message)
+// RefreshHomeDiscordMessage edits every post of the listing so its embed
+// shows the current price and status
+func RefreshHomeDiscordMessage(app *pocketbase.PocketBase, record *core.Record) error {
+	posts, err := homeDiscordPosts(app, record.Id)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	// Ensure we pace requests to ~1 req/sec (half of the common 5/5s route limit)
-	waitForDiscordSlot()
-
-	client := &http.Client{Timeout: 15 * time.Second}
-
-	// Retry on 429 with respect to retry_after; limit total attempts
-	const maxAttempts = 3
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	var errs []error
+	for _, post := range posts {
+		config, err := discord.GetConfigByID(app, post.GetString("config"))
 		if err != nil {
-			return "", err
-		}
-		req.Header.Set("Authorization", "Bot "+config.BotToken)
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err := client.Do(req)
-		if err != nil {
-			return "", err
-		}
-
-		respBody, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-
-		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
-			var msgResp DiscordMessageResponse
-			if err := json.Unmarshal(respBody, &msgResp); err != nil {
-				return "", err
-			}
-			return msgResp.ID, nil
+			errs = append(errs, err)
+			continue
 		}
 
-		if resp.StatusCode == http.StatusTooManyRequests {
-			// Simple backoff: wait 5x the minimum spacing, then retry
-			sleepFor := 5 * discordMinSpacing
-			log.Printf("[DISCORD] Rate limited (attempt %d/%d), sleeping for %v", attempt, maxAttempts, sleepFor)
-			time.Sleep(sleepFor)
-			waitForDiscordSlot()
+		messageID := post.GetString("message_id")
+		err = discord.EditMessage(config, post.GetString("channel_id"), messageID, notify.DiscordMessage(homeMessage(app, record, true)))
+		if discord.IsNotFound(err) {
+			// The thread update reposts deleted listings with a fresh embed
+			log.Printf("[DISCORD] Listing message %s was deleted, skipping refresh", messageID)
 			continue
 		}
-
-		// Non-retryable status
-		return "", fmt.Errorf("discord API error: %s - %s", resp.Status, string(respBody))
-	}
-
-	return "", fmt.Errorf("discord API error: exceeded retries for rate limit")
-}
-
-// waitForDiscordSlot enforces a minimal spacing between Discord requests to reduce rate limiting.
-func waitForDiscordSlot() {
-	discordSendMu.Lock()
-	defer discordSendMu.Unlock()
-
-	now := time.Now()
-	if !lastDiscordSendAt.IsZero() {
-		elapsed := now.Sub(lastDiscordSendAt)
-		if elapsed < discordMinSpacing {
-			time.Sleep(discordMinSpacing - elapsed)
+		if err != nil {
+			errs = append(errs, err)
 		}
 	}
-	lastDiscordSendAt = time.Now()
+	return errors.Join(errs...)
 }
 
-// createThreadFromMessage creates a thread from an existing message
-func createThreadFromMessage(config *DiscordConfig, channelID, messageID, threadName string) (string, error) {
-	url := fmt.Sprintf("%s/channels/%s/messages/%s/threads", discordAPIBase, channelID, messageID)
-
-	body, err := json.Marshal(map[string]interface{}{
-		"name":                  threadName,
-		"auto_archive_duration": 1440, // 24 hours
-	})
-	if err != nil {
-		return "", err
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+// PostScraperAlert tells the default bot's channel that a listing source is
+// failing, or that it has recovered
+func PostScraperAlert(app *pocketbase.PocketBase, health *ScraperHealth, recovered bool) error {
+	config, err := discord.GetDefaultConfig(app)
 	if err != nil {
-		return "", err
-	}
-
-	req.Header.Set("Authorization", "Bot "+config.BotToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	// Thread already exists returns 400, try to find it
-	if resp.StatusCode == http.StatusBadRequest {
-		// Return the message ID as thread ID (Discord uses message ID as thread ID)
-		return messageID, nil
-	}
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("discord API error creating thread: %s - %s", resp.Status, string(respBody))
+		return err
 	}
 
-	var threadResp struct {
-		ID string `json:"id"`
+	msg := notify.Message{
+		Title:     fmt.Sprintf("⚠️ Scraper %s is failing", health.Source),
+		Color:     0xE74C3C, // Red
+		Timestamp: time.Now(),
+		Fields: []notify.Field{
+			{Name: "Consecutive Failures", Value: fmt.Sprintf("%d", health.ConsecutiveFailures), Inline: true},
+			{Name: "Challenges", Value: fmt.Sprintf("%d", health.ChallengeCount), Inline: true},
+			{Name: "Last Error", Value: health.LastError},
+		},
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&threadResp); err != nil {
-		return "", err
+	if recovered {
+		msg.Title = fmt.Sprintf("✅ Scraper %s recovered", health.Source)
+		msg.Color = 0x2ECC71 // Green
+		msg.Fields = []notify.Field{
+			{Name: "Listings", Value: fmt.Sprintf("%d", health.LastListingCount), Inline: true},
+			{Name: "Challenges", Value: fmt.Sprintf("%d", health.ChallengeCount), Inline: true},
+		}
 	}
-
-	return threadResp.ID, nil
-}
-
-// formatNumber adds commas to numbers
-func formatNumber(n int) string {
-	str := fmt.Sprintf("%d", n)
-	if len(str) <= 3 {
-		return str
+	if !health.LastSuccess.IsZero() && !recovered {
+		msg.Text = fmt.Sprintf("Last success: %s", health.LastSuccess.Format(time.RFC1123))
 	}
 
-	var result []byte
-	for i, c := range str {
-		if i > 0 && (len(str)-i)%3 == 0 {
-			result = append(result, ',')
-		}
-		result = append(result, byte(c))
-	}
-	return string(result)
+	notifier := &notify.DiscordBot{Config: config, ChannelID: config.DefaultChannelID}
+	_, err = notifier.Send(msg)
+	return err
 }
@@ -0,0 +1,113 @@
+package chattanooga_homes
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Per-user listing flags set from Discord commands and buttons
+const (
+	FlagWatch    = "watch"
+	FlagFavorite = "favorite"
+	FlagHidden   = "hidden"
+)
+
+// flagCollections are the user lists behind each flag. Discord and the site
+// share them, so hiding a listing in one hides it in the other.
+var flagCollections = map[string]string{
+	FlagWatch:    "home_watches",
+	FlagFavorite: "home_favorites",
+	FlagHidden:   "home_hidden",
+}
+
+// ToggleDiscordHomeFlag sets the flag for a Discord user on a listing, or
+// clears it if already set. It returns whether the flag is now set.
+func ToggleDiscordHomeFlag(app *pocketbase.PocketBase, homeID, userID, username, flag string) (bool, error) {
+	existing, err := findDiscordHomeFlag(app, homeID, userID, flag)
+	if err != nil {
+		return false, err
+	}
+	if existing != nil {
+		return false, app.Delete(existing)
+	}
+
+	return true, setDiscordHomeFlag(app, homeID, userID, username, flag)
+}
+
+// setDiscordHomeFlag sets the flag, doing nothing if it is already set.
+// Discord accounts linked to a site user set it for that user too.
+func setDiscordHomeFlag(app core.App, homeID, userID, username, flag string) error {
+	existing, err := findDiscordHomeFlag(app, homeID, userID, flag)
+	if err != nil || existing != nil {
+		return err
+	}
+
+	collection, err := app.FindCollectionByNameOrId(flagCollections[flag])
+	if err != nil {
+		return fmt.Errorf("failed to find %s collection: %w", flagCollections[flag], err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("home", homeID)
+	record.Set("user", discordLinkedUser(app, userID))
+	record.Set("discord_user_id", userID)
+	record.Set("discord_username", username)
+	return app.Save(record)
+}
+
+// findDiscordHomeFlag returns the flag's entry for a Discord user, or for
+// the site user their account is linked to, or nil when it isn't set
+func findDiscordHomeFlag(app core.App, homeID, userID, flag string) (*core.Record, error) {
+	name, ok := flagCollections[flag]
+	if !ok {
+		return nil, fmt.Errorf("unknown flag %q", flag)
+	}
+
+	filter := "home = {:home} && discord_user_id = {:discord}"
+	params := map[string]any{"home": homeID, "discord": userID}
+	if linked := discordLinkedUser(app, userID); linked != "" {
+		filter = "home = {:home} && (discord_user_id = {:discord} || user = {:user})"
+		params["user"] = linked
+	}
+
+	records, err := app.FindRecordsByFilter(name, filter, "", 1, 0, params)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// discordLinkedUser returns the site user a Discord account is linked to,
+// or "" when it isn't linked
+func discordLinkedUser(app core.App, discordUserID string) string {
+	auth, err := app.FindFirstExternalAuthByExpr(dbx.HashExp{"provider": "discord", "providerId": discordUserID})
+	if err != nil {
+		return ""
+	}
+	return auth.RecordRef()
+}
+
+// discordHomeWatchers returns the Discord user IDs watching a listing.
+// Watches added on the site reach users through their linked account.
+func discordHomeWatchers(app core.App, homeID string) ([]string, error) {
+	records, err := app.FindRecordsByFilter("home_watches", "home = {:home}", "", 0, 0, map[string]any{"home": homeID})
+	if err != nil {
+		return nil, err
+	}
+
+	watchers := make([]string, 0, len(records))
+	for _, record := range records {
+		if id := record.GetString("discord_user_id"); id != "" {
+			watchers = append(watchers, id)
+			continue
+		}
+		auth, err := app.FindFirstExternalAuthByExpr(dbx.HashExp{"provider": "discord", "recordRef": record.GetString("user")})
+		if err == nil {
+			watchers = append(watchers, auth.ProviderId())
+		}
+	}
+	return watchers, nil
+}
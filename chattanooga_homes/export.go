@@ -0,0 +1,60 @@
+package chattanooga_homes
+
+import (
+	"pb-backend/export"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// homeExportColumns are the listing fields worth a spreadsheet column
+var homeExportColumns = []string{
+	"id", "listing_id", "street", "city", "state", "zip", "county", "area",
+	"subdivision", "sub_type", "status", "price", "previous_price",
+	"monthly_payment", "score", "living_area", "beds_total", "baths_total",
+	"acres", "year_built", "lat", "lon", "url", "first_seen", "last_seen",
+	"relisted_from", "original_first_seen",
+}
+
+// RegisterExportRoutes mounts the streaming listing exports for signed in
+// users. Both take format (csv, jsonl or xlsx), filter, from and to; the
+// date range applies to first_seen for listings and to the event time for
+// history.
+//
+//	GET /api/export/homes?format=xlsx&filter=county='Hamilton'&from=2025-01-01
+//	GET /api/export/homes/history?format=csv&from=2025-06-01&to=2025-06-30
+func RegisterExportRoutes(se *core.ServeEvent) {
+	columns := make([]export.Column, 0, len(homeExportColumns))
+	for _, field := range homeExportColumns {
+		columns = append(columns, export.Field(field))
+	}
+
+	group := se.Router.Group("/api/export/homes")
+	group.Bind(apis.RequireAuth())
+
+	group.GET("", export.Handler(export.Dataset{
+		Collection: "homes",
+		DateField:  "first_seen",
+		Columns:    columns,
+	}))
+
+	group.GET("/history", export.Handler(export.Dataset{
+		Collection: "home_history",
+		DateField:  "created",
+		Expand:     []string{"home"},
+		Columns: []export.Column{
+			export.Field("created"),
+			export.Field("event"),
+			export.Field("home"),
+			export.ExpandedField("home", "listing_id", "listing_id"),
+			export.ExpandedField("home", "street", "street"),
+			export.ExpandedField("home", "city", "city"),
+			export.ExpandedField("home", "zip", "zip"),
+			export.Field("price"),
+			export.Field("old_price"),
+			export.Field("status"),
+			export.Field("old_status"),
+			export.Field("changes"),
+		},
+	}))
+}
@@ -0,0 +1,240 @@
+package chattanooga_homes
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"pb-backend/export"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/search"
+)
+
+const (
+	defaultHomesPerPage = 50
+	maxHomesPerPage     = 200
+)
+
+// Filters for the custom list endpoints; {:auth} is the current user's ID
+const (
+	excludeHiddenFilter = "home_hidden_via_home.user != {:auth}"
+	myFavoritesFilter   = "home_favorites_via_home.user ?= {:auth}"
+	anyFavoritesFilter  = "home_favorites_via_home.id != ''"
+)
+
+// userListFilters returns the filter expressions for the exclude_hidden and
+// favorites_only query parameters shared by the custom list endpoints.
+// favorites_only=true keeps the current user's favorites; "any" keeps
+// listings anyone has favorited. Bind {:auth} to the current user's ID.
+func userListFilters(e *core.RequestEvent) ([]string, error) {
+	query := e.Request.URL.Query()
+	var filters []string
+
+	switch query.Get("exclude_hidden") {
+	case "", "false", "0":
+	case "true", "1":
+		filters = append(filters, excludeHiddenFilter)
+	default:
+		return nil, fmt.Errorf("exclude_hidden must be true or false")
+	}
+
+	switch query.Get("favorites_only") {
+	case "", "false", "0":
+	case "true", "1":
+		filters = append(filters, myFavoritesFilter)
+	case "any":
+		filters = append(filters, anyFavoritesFilter)
+	default:
+		return nil, fmt.Errorf("favorites_only must be true, false or any")
+	}
+
+	return filters, nil
+}
+
+// FavoritedBy is a user who favorited a listing
+type FavoritedBy struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// homeFavorites returns who favorited each of the listings, keyed by home
+func homeFavorites(app core.App, homeIDs []string) (map[string][]FavoritedBy, error) {
+	result := map[string][]FavoritedBy{}
+	if len(homeIDs) == 0 {
+		return result, nil
+	}
+
+	filter, params := anyOf("home", homeIDs)
+	favorites, err := app.FindRecordsByFilter("home_favorites", filter, "created", 0, 0, params)
+	if err != nil {
+		return nil, err
+	}
+	if errs := app.ExpandRecords(favorites, []string{"user"}, nil); len(errs) > 0 {
+		return nil, fmt.Errorf("failed to expand users: %v", errs)
+	}
+
+	for _, favorite := range favorites {
+		entry := FavoritedBy{ID: favorite.GetString("user"), Name: "user"}
+		if user := favorite.ExpandedOne("user"); user != nil {
+			entry.Name = userDisplayName(user)
+		} else if name := favorite.GetString("discord_username"); name != "" {
+			entry.Name = name
+		}
+		homeID := favorite.GetString("home")
+		result[homeID] = append(result[homeID], entry)
+	}
+	return result, nil
+}
+
+// userDisplayName returns a user's name, or the part of their email before
+// the @ when they have none
+func userDisplayName(user *core.Record) string {
+	if name := strings.TrimSpace(user.GetString("name")); name != "" {
+		return name
+	}
+	email, _, _ := strings.Cut(user.Email(), "@")
+	return email
+}
+
+// anyOf builds a filter matching a field against any of the values
+func anyOf(field string, values []string) (string, map[string]any) {
+	clauses := make([]string, 0, len(values))
+	params := make(map[string]any, len(values))
+	for i, value := range values {
+		key := fmt.Sprintf("v%d", i)
+		clauses = append(clauses, fmt.Sprintf("%s = {:%s}", field, key))
+		params[key] = value
+	}
+	return strings.Join(clauses, " || "), params
+}
+
+// RegisterHomesListRoute mounts the paginated listings endpoint for signed
+// in users. It takes the usual page, perPage, sort and filter parameters
+// plus exclude_hidden and favorites_only, and adds who favorited each
+// listing, whether the current user hid it and how many notes it has.
+//
+//	GET /api/homes/list?exclude_hidden=true&favorites_only=any&sort=-score
+func RegisterHomesListRoute(se *core.ServeEvent) {
+	se.Router.GET("/api/homes/list", handleHomesList).Bind(apis.RequireAuth())
+}
+
+func handleHomesList(e *core.RequestEvent) error {
+	collection, err := e.App.FindCollectionByNameOrId("homes")
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	info, err := e.RequestInfo()
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	filters, err := userListFilters(e)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	query := e.Request.URL.Query()
+	// The provider parses these itself, so check them as UserFilter would
+	if err := export.CheckUserFields(query.Get("filter"), query.Get("sort")); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid query: " + err.Error()})
+	}
+	if query.Get("sort") == "" {
+		query.Set("sort", "-first_seen")
+	}
+	perPage, err := analyticsInt(query.Get("perPage"), defaultHomesPerPage, maxHomesPerPage)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid perPage: " + err.Error()})
+	}
+	query.Set("perPage", fmt.Sprint(perPage))
+
+	// The user list filters are applied to the base query so they can bind
+	// the user's ID; the provider adds the joins they need
+	resolver := core.NewRecordFieldResolver(e.App, collection, info, false)
+	baseQuery := e.App.RecordQuery(collection)
+	for _, filter := range filters {
+		expr, err := search.FilterData(filter).BuildExpr(resolver, map[string]any{"auth": e.Auth.Id})
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		baseQuery.AndWhere(expr)
+	}
+	provider := search.NewProvider(resolver).Query(baseQuery)
+
+	records := []*core.Record{}
+	result, err := provider.ParseAndExec(query.Encode(), &records)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	ids := make([]string, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.Id)
+	}
+	favorites, err := homeFavorites(e.App, ids)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	hidden, err := userHiddenHomes(e.App, e.Auth.Id, ids)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	notes, err := homeNoteCounts(e.App, ids)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	items := make([]map[string]any, 0, len(records))
+	for _, record := range records {
+		item := record.PublicExport()
+		item["image_url"] = homeImageURL(e.App, record)
+		item["thumb_url"] = homeThumbURL(e.App, record)
+		item["favorited_by"] = favorites[record.Id]
+		if item["favorited_by"] == nil {
+			item["favorited_by"] = []FavoritedBy{}
+		}
+		item["hidden"] = hidden[record.Id]
+		item["notes"] = notes[record.Id]
+		items = append(items, item)
+	}
+
+	result.Items = items
+	return e.JSON(http.StatusOK, result)
+}
+
+// userHiddenHomes returns which of the listings the user has hidden
+func userHiddenHomes(app core.App, userID string, homeIDs []string) (map[string]bool, error) {
+	result := map[string]bool{}
+	if len(homeIDs) == 0 {
+		return result, nil
+	}
+
+	filter, params := anyOf("home", homeIDs)
+	params["user"] = userID
+	records, err := app.FindRecordsByFilter("home_hidden", "user = {:user} && ("+filter+")", "", 0, 0, params)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		result[record.GetString("home")] = true
+	}
+	return result, nil
+}
+
+// homeNoteCounts returns the number of notes on each of the listings
+func homeNoteCounts(app core.App, homeIDs []string) (map[string]int, error) {
+	result := map[string]int{}
+	if len(homeIDs) == 0 {
+		return result, nil
+	}
+
+	filter, params := anyOf("home", homeIDs)
+	records, err := app.FindRecordsByFilter("home_notes", filter, "", 0, 0, params)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		result[record.GetString("home")]++
+	}
+	return result, nil
+}
@@ -0,0 +1,76 @@
+package chattanooga_homes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"pb-backend/modules"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newHomesTestApp returns an app with the module's schema applied
+func newHomesTestApp(t *testing.T) *pocketbase.PocketBase {
+	t.Helper()
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RunAllMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	if err := modules.MigrateShared(app); err != nil {
+		t.Fatal(err)
+	}
+	if err := modules.Migrate(app, &Module{}); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestHomesListRejectsSuperuserFields(t *testing.T) {
+	app := newHomesTestApp(t)
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := core.NewRecord(users)
+	user.SetEmail("user@example.com")
+	user.SetPassword("password123")
+	if err := app.Save(user); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(query url.Values) int {
+		recorder := httptest.NewRecorder()
+		e := &core.RequestEvent{App: app}
+		e.Request = httptest.NewRequest(http.MethodGet, "/api/homes/list?"+query.Encode(), nil)
+		e.Response = recorder
+		e.Auth = user
+		if err := handleHomesList(e); err != nil {
+			t.Fatal(err)
+		}
+		return recorder.Code
+	}
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  int
+	}{
+		{"no filter", url.Values{}, http.StatusOK},
+		{"listing filter", url.Values{"filter": {"price > 100000"}}, http.StatusOK},
+		{"collection filter", url.Values{"filter": {"@collection.home_alerts.target ~ 'https'"}}, http.StatusBadRequest},
+		{"request filter", url.Values{"filter": {"@request.headers.x_token = 'a'"}}, http.StatusBadRequest},
+		{"collection sort", url.Values{"sort": {"@collection.home_alerts.target"}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if got := list(tt.query); got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
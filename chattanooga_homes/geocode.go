@@ -0,0 +1,394 @@
+package chattanooga_homes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"pb-backend/jobs"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// How often the geocode job looks for listings without coordinates
+	geocodeJob          = "homes_geocode"
+	geocodePollInterval = 5 * time.Minute
+	geocodeBatchSize    = 50
+
+	// Pause between provider requests; Nominatim allows one per second
+	geocodeRequestDelay = 1100 * time.Millisecond
+	geocodeTimeout      = 15 * time.Second
+
+	geocodeRetryBaseBackoff = 15 * time.Minute
+	geocodeRetryMaxBackoff  = 24 * time.Hour
+
+	censusGeocoderURL   = "https://geocoding.geo.census.gov/geocoder/locations/address"
+	nominatimDefaultURL = "https://nominatim.openstreetmap.org"
+	geocodeUserAgent    = "pb-backend-homes/1.0"
+)
+
+// Address is a postal address to geocode
+type Address struct {
+	Street string
+	City   string
+	State  string
+	Zip    string
+}
+
+// String formats the address on one line
+func (a Address) String() string {
+	var parts []string
+	for _, part := range []string{a.Street, a.City, strings.TrimSpace(a.State + " " + a.Zip)} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Key returns the normalized address used as the geocode cache key, or ""
+// when the street is empty
+func (a Address) Key() string {
+	street := NormalizeStreet(a.Street)
+	if street == "" {
+		return ""
+	}
+	zip := strings.TrimSpace(a.Zip)
+	if len(zip) > 5 {
+		zip = zip[:5]
+	}
+	return strings.Join([]string{
+		street,
+		strings.ToLower(strings.TrimSpace(a.City)),
+		strings.ToLower(strings.TrimSpace(a.State)),
+		zip,
+	}, "|")
+}
+
+func homeAddress(record *core.Record) Address {
+	return Address{
+		Street: record.GetString("street"),
+		City:   record.GetString("city"),
+		State:  record.GetString("state"),
+		Zip:    record.GetString("zip"),
+	}
+}
+
+// GeoPoint is a WGS84 coordinate
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Geocoder resolves addresses to coordinates. Geocode returns nil without
+// an error when the provider has no match.
+type Geocoder interface {
+	Name() string
+	Geocode(ctx context.Context, addr Address) (*GeoPoint, error)
+}
+
+// NewGeocoderFromEnv returns the provider selected by GEOCODER: census
+// (default), nominatim, stub or off. It returns nil when geocoding is off.
+func NewGeocoderFromEnv() (Geocoder, error) {
+	switch provider := strings.ToLower(os.Getenv("GEOCODER")); provider {
+	case "", "census":
+		return &CensusGeocoder{}, nil
+	case "nominatim":
+		return &NominatimGeocoder{BaseURL: os.Getenv("NOMINATIM_URL")}, nil
+	case "stub":
+		return &StubGeocoder{}, nil
+	case "off", "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown geocoder %q", provider)
+	}
+}
+
+// CensusGeocoder uses the free US Census Bureau geocoder. It needs no key
+// but only covers US addresses.
+type CensusGeocoder struct{}
+
+func (g *CensusGeocoder) Name() string { return "census" }
+
+func (g *CensusGeocoder) Geocode(ctx context.Context, addr Address) (*GeoPoint, error) {
+	params := url.Values{}
+	params.Set("street", addr.Street)
+	params.Set("city", addr.City)
+	params.Set("state", addr.State)
+	params.Set("zip", addr.Zip)
+	params.Set("benchmark", "Public_AR_Current")
+	params.Set("format", "json")
+
+	var result struct {
+		Result struct {
+			AddressMatches []struct {
+				Coordinates struct {
+					X float64 `json:"x"`
+					Y float64 `json:"y"`
+				} `json:"coordinates"`
+			} `json:"addressMatches"`
+		} `json:"result"`
+	}
+	if err := geocodeRequest(ctx, censusGeocoderURL+"?"+params.Encode(), &result); err != nil {
+		return nil, err
+	}
+
+	if len(result.Result.AddressMatches) == 0 {
+		return nil, nil
+	}
+	match := result.Result.AddressMatches[0].Coordinates
+	return &GeoPoint{Lat: match.Y, Lon: match.X}, nil
+}
+
+// NominatimGeocoder uses an OpenStreetMap Nominatim server. The public
+// server allows one request per second.
+type NominatimGeocoder struct {
+	BaseURL string
+}
+
+func (g *NominatimGeocoder) Name() string { return "nominatim" }
+
+func (g *NominatimGeocoder) Geocode(ctx context.Context, addr Address) (*GeoPoint, error) {
+	base := strings.TrimRight(g.BaseURL, "/")
+	if base == "" {
+		base = nominatimDefaultURL
+	}
+
+	params := url.Values{}
+	params.Set("street", addr.Street)
+	params.Set("city", addr.City)
+	params.Set("state", addr.State)
+	params.Set("postalcode", addr.Zip)
+	params.Set("countrycodes", "us")
+	params.Set("format", "jsonv2")
+	params.Set("limit", "1")
+
+	var results []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+	if err := geocodeRequest(ctx, base+"/search?"+params.Encode(), &results); err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, nil
+	}
+	lat, err := strconv.ParseFloat(results[0].Lat, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude %q", results[0].Lat)
+	}
+	lon, err := strconv.ParseFloat(results[0].Lon, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude %q", results[0].Lon)
+	}
+	return &GeoPoint{Lat: lat, Lon: lon}, nil
+}
+
+// StubGeocoder resolves addresses offline, for tests and development.
+// Addresses in Points use their entry; any other address gets a stable
+// point near Chattanooga derived from its key.
+type StubGeocoder struct {
+	Points map[string]GeoPoint
+}
+
+func (g *StubGeocoder) Name() string { return "stub" }
+
+func (g *StubGeocoder) Geocode(ctx context.Context, addr Address) (*GeoPoint, error) {
+	key := addr.Key()
+	if key == "" {
+		return nil, nil
+	}
+	if point, ok := g.Points[key]; ok {
+		return &point, nil
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	// Spread points over roughly ±0.25° around downtown Chattanooga
+	latOffset := float64(sum&0xFFFF)/0xFFFF*0.5 - 0.25
+	lonOffset := float64((sum>>16)&0xFFFF)/0xFFFF*0.5 - 0.25
+	return &GeoPoint{Lat: 35.0456 + latOffset, Lon: -85.3097 + lonOffset}, nil
+}
+
+func geocodeRequest(ctx context.Context, rawURL string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", geocodeUserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	client := &http.Client{Timeout: geocodeTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("geocoder returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// GeocodeAddress resolves an address through the cache, asking the
+// provider only on a cache miss. cached reports whether the provider was
+// skipped. A nil point means the address could not be found.
+func GeocodeAddress(ctx context.Context, app core.App, geocoder Geocoder, addr Address) (point *GeoPoint, cached bool, err error) {
+	key := addr.Key()
+	if key == "" {
+		return nil, true, nil
+	}
+
+	entry, err := app.FindFirstRecordByFilter("geocode_cache", "key = {:key}", map[string]any{"key": key})
+	if err == nil {
+		if !entry.GetBool("found") {
+			return nil, true, nil
+		}
+		return &GeoPoint{Lat: entry.GetFloat("lat"), Lon: entry.GetFloat("lon")}, true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, geocodeTimeout)
+	defer cancel()
+	point, err = geocoder.Geocode(ctx, addr)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s geocoder: %w", geocoder.Name(), err)
+	}
+
+	collection, err := app.FindCollectionByNameOrId("geocode_cache")
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to find geocode_cache collection: %w", err)
+	}
+	entry = core.NewRecord(collection)
+	entry.Set("key", key)
+	entry.Set("address", addr.String())
+	entry.Set("provider", geocoder.Name())
+	entry.Set("found", point != nil)
+	if point != nil {
+		entry.Set("lat", point.Lat)
+		entry.Set("lon", point.Lon)
+	}
+	if err := app.Save(entry); err != nil {
+		return nil, false, fmt.Errorf("failed to cache geocode result: %w", err)
+	}
+
+	return point, false, nil
+}
+
+// sleepCtx waits for d and reports whether it did before ctx was done
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// registerGeocodeHooks clears the coordinates of listings whose address
+// changes, so the worker geocodes them again
+func registerGeocodeHooks(app *pocketbase.PocketBase) {
+	app.OnRecordUpdate("homes").BindFunc(func(e *core.RecordEvent) error {
+		if original := e.Record.Original(); original != nil && homeAddress(original).Key() != homeAddress(e.Record).Key() {
+			e.Record.Set("lat", 0)
+			e.Record.Set("lon", 0)
+			e.Record.Set("geocoded_at", "")
+			e.Record.Set("geocode_attempts", 0)
+			e.Record.Set("geocode_retry_at", "")
+		}
+		return e.Next()
+	})
+}
+
+// GeocodeWorker fills in coordinates for listings that have none
+type GeocodeWorker struct {
+	app      *pocketbase.PocketBase
+	geocoder Geocoder
+}
+
+// NewGeocodeWorker creates a worker using the given provider
+func NewGeocodeWorker(app *pocketbase.PocketBase, geocoder Geocoder) *GeocodeWorker {
+	return &GeocodeWorker{app: app, geocoder: geocoder}
+}
+
+// AddJobs registers the geocode job. New listings wake it.
+func (w *GeocodeWorker) AddJobs(runner *jobs.Runner) {
+	log.Printf("[GEOCODE] Using %s geocoder", w.geocoder.Name())
+	runner.MustAdd(jobs.Job{
+		Name:       geocodeJob,
+		Every:      func() time.Duration { return geocodePollInterval },
+		RunAtStart: true,
+		Enabled:    moduleEnabled,
+		Run:        w.processPending,
+	})
+}
+
+// processPending geocodes listings that have not been geocoded yet, newest
+// first. A listing the provider fails on is retried after a growing delay,
+// so it doesn't hold up the others; only cancelling ctx ends the pass early.
+func (w *GeocodeWorker) processPending(ctx context.Context) (jobs.Counts, error) {
+	counts := jobs.Counts{"geocoded": 0, "not_found": 0, "failed": 0}
+	for {
+		records, err := w.app.FindRecordsByFilter("homes",
+			"geocoded_at = '' && (geocode_retry_at = '' || geocode_retry_at <= {:now})",
+			"-first_seen", geocodeBatchSize, 0, map[string]any{"now": time.Now().UTC()})
+		if err != nil {
+			return counts, fmt.Errorf("finding listings: %w", err)
+		}
+		if len(records) == 0 {
+			return counts, nil
+		}
+
+		for _, record := range records {
+			point, cached, err := GeocodeAddress(ctx, w.app, w.geocoder, homeAddress(record))
+			if err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return counts, ctxErr
+				}
+				counts["failed"]++
+				backoff := retryBackoff(record.GetInt("geocode_attempts")+1, geocodeRetryBaseBackoff, geocodeRetryMaxBackoff)
+				log.Printf("[GEOCODE] Error geocoding %s, retrying in %v: %v", homeAddress(record), backoff, err)
+				if err := w.app.Save(scheduleRetry(record, "geocode", backoff)); err != nil {
+					return counts, fmt.Errorf("saving %s: %w", record.Id, err)
+				}
+				if !sleepCtx(ctx, geocodeRequestDelay) {
+					return counts, ctx.Err()
+				}
+				continue
+			}
+
+			if point != nil {
+				record.Set("lat", point.Lat)
+				record.Set("lon", point.Lon)
+				counts["geocoded"]++
+			} else {
+				log.Printf("[GEOCODE] No match for %s", homeAddress(record))
+				counts["not_found"]++
+			}
+			record.Set("geocoded_at", time.Now().UTC())
+			record.Set("geocode_attempts", 0)
+			record.Set("geocode_retry_at", "")
+			if err := w.app.Save(record); err != nil {
+				return counts, fmt.Errorf("saving %s: %w", record.Id, err)
+			}
+
+			if !cached && !sleepCtx(ctx, geocodeRequestDelay) {
+				return counts, ctx.Err()
+			}
+		}
+	}
+}
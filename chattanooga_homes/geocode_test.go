@@ -0,0 +1,55 @@
+package chattanooga_homes
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// failingGeocoder fails for one street and places the rest at the origin
+type failingGeocoder struct {
+	street string
+}
+
+func (g failingGeocoder) Name() string { return "failing" }
+
+func (g failingGeocoder) Geocode(ctx context.Context, addr Address) (*GeoPoint, error) {
+	if addr.Street == g.street {
+		return nil, errors.New("provider error")
+	}
+	return &GeoPoint{Lat: 35, Lon: -85}, nil
+}
+
+func TestGeocodePendingSkipsFailures(t *testing.T) {
+	app := newHomesTestApp(t)
+
+	// The failing listing is newest, so it sorts first
+	for _, home := range []Home{
+		{ListingID: "good", Street: "1 Good St", City: "Chattanooga", State: "TN", Zip: "37402"},
+		{ListingID: "bad", Street: "2 Bad St", City: "Chattanooga", State: "TN", Zip: "37402"},
+	} {
+		if _, err := SaveHomes(app, []Home{home}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	worker := NewGeocodeWorker(app, failingGeocoder{street: "2 Bad St"})
+	counts, err := worker.processPending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["geocoded"] != 1 || counts["failed"] != 1 {
+		t.Fatalf("Expected one geocoded and one failed, got %v", counts)
+	}
+
+	bad, err := app.FindFirstRecordByFilter("homes", "listing_id = 'bad'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bad.GetInt("geocode_attempts") != 1 || bad.GetDateTime("geocode_retry_at").IsZero() {
+		t.Errorf("Expected the failure to be recorded, got %d attempts", bad.GetInt("geocode_attempts"))
+	}
+	if !bad.GetDateTime("geocoded_at").IsZero() {
+		t.Error("Expected the failing listing to stay pending")
+	}
+}
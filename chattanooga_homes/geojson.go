@@ -0,0 +1,169 @@
+package chattanooga_homes
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pb-backend/export"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/search"
+)
+
+const (
+	defaultGeoJSONLimit = 1000
+	maxGeoJSONLimit     = 10000
+)
+
+// geoJSONProperties are the listing fields included on each feature
+var geoJSONProperties = []string{
+	"listing_id", "street", "city", "state", "zip", "price", "status",
+	"county", "subdivision", "beds_total", "baths_total", "living_area",
+	"acres", "year_built", "url", "score", "monthly_payment",
+}
+
+// GeoJSONFeature is a listing as a GeoJSON point feature
+type GeoJSONFeature struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"id"`
+	Geometry   GeoJSONPoint   `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+// GeoJSONPoint is a GeoJSON point geometry ([lon, lat])
+type GeoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// RegisterGeoJSONRoute mounts the map endpoint, returning geocoded listings
+// as a GeoJSON FeatureCollection:
+//
+//	GET /api/homes.geojson?bbox=minLon,minLat,maxLon,maxLat&status=active&filter=price<500000
+//
+// exclude_hidden and favorites_only work as on /api/homes/list.
+func RegisterGeoJSONRoute(se *core.ServeEvent) {
+	se.Router.GET("/api/homes.geojson", handleHomesGeoJSON).Bind(apis.RequireAuth())
+}
+
+func handleHomesGeoJSON(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+
+	statuses, err := analyticsStatuses(defaultString(query.Get("status"), "all"))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	limit, err := analyticsInt(query.Get("limit"), defaultGeoJSONLimit, maxGeoJSONLimit)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid limit: " + err.Error()})
+	}
+
+	collection, err := e.App.FindCollectionByNameOrId("homes")
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	userFilter, resolver, err := export.UserFilter(e, collection, query.Get("filter"))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	filters := []string{"geocoded_at != ''", "(lat != 0 || lon != 0)"}
+	params := map[string]any{}
+	if bbox := query.Get("bbox"); bbox != "" {
+		box, err := parseBBox(bbox)
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		filters = append(filters, "lon >= {:minLon} && lat >= {:minLat} && lon <= {:maxLon} && lat <= {:maxLat}")
+		params["minLon"], params["minLat"], params["maxLon"], params["maxLat"] = box[0], box[1], box[2], box[3]
+	}
+	userFilters, err := userListFilters(e)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	filters = append(filters, userFilters...)
+	params["auth"] = e.Auth.Id
+
+	expr, err := search.FilterData(strings.Join(filters, " && ")).BuildExpr(resolver, params)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	homesQuery := e.App.RecordQuery(collection).
+		AndWhere(expr).
+		OrderBy("[[homes.price]] DESC").
+		Limit(int64(limit))
+	if userFilter != nil {
+		homesQuery.AndWhere(userFilter)
+	}
+	// Filtering status before the limit keeps the result full
+	if statuses != nil {
+		homesQuery.AndWhere(statusCategoryExpr(statuses))
+	}
+	if err := resolver.UpdateQuery(homesQuery); err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	records := []*core.Record{}
+	if err := homesQuery.All(&records); err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	features := make([]GeoJSONFeature, 0, len(records))
+	for _, record := range records {
+		features = append(features, homeFeature(e.App, record))
+	}
+
+	e.Response.Header().Set("Content-Type", "application/geo+json")
+	return e.JSON(http.StatusOK, map[string]any{
+		"type":     "FeatureCollection",
+		"features": features,
+	})
+}
+
+func homeFeature(app core.App, record *core.Record) GeoJSONFeature {
+	properties := make(map[string]any, len(geoJSONProperties))
+	for _, field := range geoJSONProperties {
+		properties[field] = record.Get(field)
+	}
+	properties["image_url"] = homeImageURL(app, record)
+	properties["thumb_url"] = homeThumbURL(app, record)
+	return GeoJSONFeature{
+		Type: "Feature",
+		ID:   record.Id,
+		Geometry: GeoJSONPoint{
+			Type:        "Point",
+			Coordinates: [2]float64{record.GetFloat("lon"), record.GetFloat("lat")},
+		},
+		Properties: properties,
+	}
+}
+
+// parseBBox parses a GeoJSON-order bounding box: minLon,minLat,maxLon,maxLat
+func parseBBox(value string) ([4]float64, error) {
+	var box [4]float64
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return box, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat")
+	}
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return box, fmt.Errorf("invalid bbox value %q", part)
+		}
+		box[i] = n
+	}
+	if box[0] > box[2] || box[1] > box[3] {
+		return box, fmt.Errorf("bbox minimums must not exceed maximums")
+	}
+	return box, nil
+}
+
+func defaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,55 @@
+package chattanooga_homes
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// History event types
+const (
+	HistoryCreated  = "created"
+	HistoryUpdated  = "updated"
+	HistoryRelisted = "relisted"
+)
+
+// recordHomeHistory adds a history entry for a listing change. Call it with
+// the transaction app so it commits with the change.
+func recordHomeHistory(txApp core.App, record *core.Record, changes []FieldChange) error {
+	collection, err := txApp.FindCollectionByNameOrId("home_history")
+	if err != nil {
+		return fmt.Errorf("failed to find home_history collection: %w", err)
+	}
+
+	price := record.GetInt("price")
+	status := record.GetString("status")
+
+	entry := core.NewRecord(collection)
+	entry.Set("home", record.Id)
+	entry.Set("price", price)
+	entry.Set("old_price", price)
+	entry.Set("status", status)
+	entry.Set("old_status", status)
+
+	switch {
+	case changes == nil && record.GetString("relisted_from") != "":
+		// Link the relist to its predecessor's history
+		entry.Set("event", HistoryRelisted)
+		entry.Set("old_price", record.GetInt("relisted_price"))
+		entry.Set("changes", []FieldChange{
+			{Field: "relisted_from", OldValue: nil, NewValue: record.GetString("relisted_from")},
+			{Field: "price", OldValue: record.GetInt("relisted_price"), NewValue: price},
+		})
+	case changes == nil:
+		entry.Set("event", HistoryCreated)
+	default:
+		entry.Set("event", HistoryUpdated)
+		entry.Set("changes", changes)
+		if original := record.Original(); original != nil {
+			entry.Set("old_price", original.GetInt("price"))
+			entry.Set("old_status", original.GetString("status"))
+		}
+	}
+
+	return txApp.Save(entry)
+}
@@ -1,9 +1,14 @@
 package chattanooga_homes
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"sync"
 	"time"
 
+	"pb-backend/jobs"
+
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 )
@@ -27,114 +32,36 @@ type Home struct {
 	YearBuilt   int
 	URL         string
 	ImageURL    string
+	PhotoURLs   []string
 	Status      string
+	Description string // public remarks, when the source has them
 }
 
-// CreateHomesSchema creates the homes collection
-func CreateHomesSchema(app *pocketbase.PocketBase) error {
-	return createHomesCollection(app)
-}
-
-func createHomesCollection(app *pocketbase.PocketBase) error {
-	existing, _ := app.FindCollectionByNameOrId("homes")
-	if existing != nil {
-		return nil
-	}
-
-	collection := core.NewBaseCollection("homes")
-
-	// Listing ID (unique identifier from MLS)
-	collection.Fields.Add(&core.TextField{
-		Name:     "listing_id",
-		Required: true,
-	})
-
-	// Address fields
-	collection.Fields.Add(&core.TextField{
-		Name:     "street",
-		Required: true,
-	})
-	collection.Fields.Add(&core.TextField{
-		Name: "city",
-	})
-	collection.Fields.Add(&core.TextField{
-		Name: "state",
-	})
-	collection.Fields.Add(&core.TextField{
-		Name: "zip",
-	})
-
-	// Current price
-	collection.Fields.Add(&core.NumberField{
-		Name: "price",
-	})
-
-	// Property details
-	collection.Fields.Add(&core.TextField{
-		Name: "sub_type",
-	})
-	collection.Fields.Add(&core.TextField{
-		Name: "county",
-	})
-	collection.Fields.Add(&core.TextField{
-		Name: "area",
-	})
-	collection.Fields.Add(&core.TextField{
-		Name: "subdivision",
-	})
-	collection.Fields.Add(&core.NumberField{
-		Name: "living_area",
-	})
-	collection.Fields.Add(&core.NumberField{
-		Name: "beds_total",
-	})
-	collection.Fields.Add(&core.NumberField{
-		Name: "baths_total",
-	})
-	collection.Fields.Add(&core.NumberField{
-		Name: "acres",
-	})
-	collection.Fields.Add(&core.NumberField{
-		Name: "year_built",
-	})
-
-	// URL to listing
-	collection.Fields.Add(&core.TextField{
-		Name: "url",
-	})
-
-	// Image URL
-	collection.Fields.Add(&core.TextField{
-		Name: "image_url",
-	})
-
-	// Tracking fields
-	collection.Fields.Add(&core.DateField{
-		Name: "first_seen",
-	})
-	collection.Fields.Add(&core.DateField{
-		Name: "last_seen",
-	})
-
-	// Status: Active, Inactive, Sold, etc.
-	collection.Fields.Add(&core.TextField{
-		Name: "status",
-	})
-
-	// Discord message ID for thread creation
-	collection.Fields.Add(&core.TextField{
-		Name: "discord_message_id",
-	})
-
-	collection.Indexes = []string{
-		"CREATE UNIQUE INDEX idx_homes_listing_id ON homes (listing_id)",
-		"CREATE INDEX idx_homes_price ON homes (price)",
-		"CREATE INDEX idx_homes_city ON homes (city)",
-		"CREATE INDEX idx_homes_county ON homes (county)",
-		"CREATE INDEX idx_homes_status ON homes (status)",
+// homeFromRecord returns the listing stored in a homes record
+func homeFromRecord(record *core.Record) Home {
+	home := Home{
+		ListingID:   record.GetString("listing_id"),
+		Street:      record.GetString("street"),
+		City:        record.GetString("city"),
+		State:       record.GetString("state"),
+		Zip:         record.GetString("zip"),
+		Price:       record.GetInt("price"),
+		SubType:     record.GetString("sub_type"),
+		County:      record.GetString("county"),
+		Area:        record.GetString("area"),
+		Subdivision: record.GetString("subdivision"),
+		LivingArea:  record.GetInt("living_area"),
+		BedsTotal:   record.GetInt("beds_total"),
+		BathsTotal:  record.GetFloat("baths_total"),
+		Acres:       record.GetFloat("acres"),
+		YearBuilt:   record.GetInt("year_built"),
+		URL:         record.GetString("url"),
+		ImageURL:    record.GetString("image_url"),
+		Status:      record.GetString("status"),
+		Description: record.GetString("description"),
 	}
-
-	return app.Save(collection)
+	_ = record.UnmarshalJSONField("photo_urls", &home.PhotoURLs)
+	return home
 }
 
 // SaveHomes saves or updates multiple home listings in a single transaction
@@ -150,16 +77,51 @@ func SaveHomes(app *pocketbase.PocketBase, homes []Home) (saved int, err error)
 
 	now := time.Now().UTC()
 
+	// Listings in this batch can't be relists of each other
+	batch := make(map[string]bool, len(homes))
+	for _, home := range homes {
+		batch[home.ListingID] = true
+	}
+
 	err = app.RunInTransaction(func(txApp core.App) error {
 		for _, home := range homes {
-			// Find existing or create new record
-			filter := fmt.Sprintf("listing_id = '%s'", home.ListingID)
-			record, _ := txApp.FindFirstRecordByFilter("homes", filter)
+			addressKey := AddressKey(home.Street, home.Zip)
+
+			// Find existing by listing ID. A new listing ID may be a relist
+			// of a listing that left the market; otherwise match by address
+			// so the same house from another source merges into the
+			// existing row.
+			record, _ := txApp.FindFirstRecordByFilter("homes", "listing_id = {:id}",
+				map[string]any{"id": home.ListingID})
+
+			var predecessor *core.Record
+			if record == nil {
+				var relistErr error
+				predecessor, relistErr = findRelistPredecessor(txApp, home, batch, now)
+				if relistErr != nil {
+					return fmt.Errorf("failed to check relist of %s: %w", home.ListingID, relistErr)
+				}
+			}
+			if record == nil && predecessor == nil && addressKey != "" {
+				matches, _ := txApp.FindRecordsByFilter("homes", "address_key = {:key} && status != {:relisted}",
+					"-first_seen", 1, 0, map[string]any{"key": addressKey, "relisted": statusRelisted})
+				if len(matches) > 0 {
+					// Another source's listing of the same house. That source
+					// owns the row, so this one only fills in what it lacks;
+					// replacing its price and status would flip them back and
+					// forth every cycle.
+					record = matches[0]
+					home = mergeHome(homeFromRecord(record), home)
+				}
+			}
 
 			if record == nil {
 				record = core.NewRecord(collection)
 				record.Set("listing_id", home.ListingID)
 				record.Set("first_seen", now)
+				if predecessor != nil {
+					linkRelist(record, predecessor)
+				}
 			}
 
 			// Set all fields
@@ -167,6 +129,9 @@ func SaveHomes(app *pocketbase.PocketBase, homes []Home) (saved int, err error)
 			record.Set("city", home.City)
 			record.Set("state", home.State)
 			record.Set("zip", home.Zip)
+			if current := record.GetInt("price"); current != 0 && current != home.Price {
+				record.Set("previous_price", current)
+			}
 			record.Set("price", home.Price)
 			record.Set("sub_type", home.SubType)
 			record.Set("county", home.County)
@@ -179,13 +144,29 @@ func SaveHomes(app *pocketbase.PocketBase, homes []Home) (saved int, err error)
 			record.Set("year_built", home.YearBuilt)
 			record.Set("url", home.URL)
 			record.Set("image_url", home.ImageURL)
+			if len(home.PhotoURLs) > 0 {
+				record.Set("photo_urls", home.PhotoURLs)
+			}
+			// Not every source has remarks; keep what another one found
+			if home.Description != "" {
+				record.Set("description", home.Description)
+			}
 			record.Set("last_seen", now)
 			record.Set("status", home.Status)
+			record.Set("address_key", addressKey)
 
 			if err := txApp.Save(record); err != nil {
 				return fmt.Errorf("failed to save home %s: %w", home.ListingID, err)
 			}
 			saved++
+
+			if predecessor != nil {
+				log.Printf("[HOMES] %s relisted as %s (previously %s)", home.Street, home.ListingID, predecessor.GetString("listing_id"))
+				predecessor.Set("status", statusRelisted)
+				if err := txApp.Save(predecessor); err != nil {
+					return fmt.Errorf("failed to mark %s relisted: %w", predecessor.GetString("listing_id"), err)
+				}
+			}
 		}
 		return nil
 	})
@@ -196,3 +177,90 @@ func SaveHomes(app *pocketbase.PocketBase, homes []Home) (saved int, err error)
 
 	return saved, nil
 }
+
+// retryBackoff returns the delay before retrying after the given number of
+// failed attempts, doubling from base up to max
+func retryBackoff(attempts int, base, max time.Duration) time.Duration {
+	backoff := base << (attempts - 1)
+	if backoff <= 0 || backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// scheduleRetry counts a failed attempt of a per-listing worker in the
+// record's <prefix>_attempts field and sets <prefix>_retry_at, which the
+// worker's query skips until then
+func scheduleRetry(record *core.Record, prefix string, backoff time.Duration) *core.Record {
+	record.Set(prefix+"_attempts", record.GetInt(prefix+"_attempts")+1)
+	record.Set(prefix+"_retry_at", time.Now().UTC().Add(backoff))
+	return record
+}
+
+// bulkUpdateMu keeps the cost and scoring updates from overlapping each
+// other; the jobs' guards keep each from overlapping itself
+var bulkUpdateMu sync.Mutex
+
+const (
+	bulkUpdateBatchSize = 200
+
+	// Jobs updating every listing. The settings hooks wake them; the daily
+	// run catches a wake lost to a restart. The costs job also runs at start
+	// so listings saved before the cost settings existed get priced.
+	costsJob        = "homes_costs"
+	scoringJob      = "homes_scoring"
+	bulkUpdateEvery = 24 * time.Hour
+)
+
+// addBulkUpdateJobs registers the cost and scoring jobs
+func addBulkUpdateJobs(app core.App, runner *jobs.Runner) {
+	runner.MustAdd(jobs.Job{
+		Name:       costsJob,
+		Every:      func() time.Duration { return bulkUpdateEvery },
+		RunAtStart: true,
+		Enabled:    moduleEnabled,
+		Run: func(ctx context.Context) (jobs.Counts, error) {
+			updated, err := RecalculateHomeCosts(ctx, app)
+			return jobs.Counts{"updated": updated}, err
+		},
+	})
+	runner.MustAdd(jobs.Job{
+		Name:    scoringJob,
+		Every:   func() time.Duration { return bulkUpdateEvery },
+		Enabled: moduleEnabled,
+		Run: func(ctx context.Context) (jobs.Counts, error) {
+			updated, err := RescoreHomes(ctx, app)
+			return jobs.Counts{"updated": updated}, err
+		},
+	})
+}
+
+// updateAllHomes runs apply on every listing and saves the ones it reports
+// as changed. Saving runs the usual hooks, so derived fields stay in sync.
+// It stops between batches once ctx is done.
+func updateAllHomes(ctx context.Context, app core.App, apply func(record *core.Record) bool) (updated int, err error) {
+	bulkUpdateMu.Lock()
+	defer bulkUpdateMu.Unlock()
+
+	for offset := 0; ; offset += bulkUpdateBatchSize {
+		if err := ctx.Err(); err != nil {
+			return updated, err
+		}
+		records, err := app.FindRecordsByFilter("homes", "", "id", bulkUpdateBatchSize, offset)
+		if err != nil {
+			return updated, err
+		}
+		for _, record := range records {
+			if !apply(record) {
+				continue
+			}
+			if err := app.Save(record); err != nil {
+				return updated, fmt.Errorf("failed to save %s: %w", record.GetString("listing_id"), err)
+			}
+			updated++
+		}
+		if len(records) < bulkUpdateBatchSize {
+			return updated, nil
+		}
+	}
+}
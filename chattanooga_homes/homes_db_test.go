@@ -0,0 +1,88 @@
+package chattanooga_homes
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSaveHomesAcrossSources(t *testing.T) {
+	app := newHomesTestApp(t)
+
+	fetch := func(source ListingSource) []Home {
+		homes, err := source.FetchListings(context.Background(), DefaultSearch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return homes
+	}
+	owner := fetch(NewFixtureSource("flexmls", "testdata/search_results.html"))
+	other := fetch(NewFixtureSource("other", "testdata/other_source_results.html"))
+
+	// Two cycles, each saving both sources
+	for range 2 {
+		for _, homes := range [][]Home{owner, other} {
+			if _, err := SaveHomes(app, homes); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	records, err := app.FindRecordsByFilter("homes", "street ~ 'Lookout Ridge'", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected the sources to share one row, got %d", len(records))
+	}
+	record := records[0]
+
+	want := owner[0]
+	checks := []struct {
+		field string
+		got   any
+		want  any
+	}{
+		{"listing_id", record.GetString("listing_id"), want.ListingID},
+		{"price", record.GetInt("price"), want.Price},
+		{"previous_price", record.GetInt("previous_price"), 0},
+		{"status", record.GetString("status"), want.Status},
+		{"image_url", record.GetString("image_url"), want.ImageURL},
+		{"subdivision", record.GetString("subdivision"), want.Subdivision},
+		{"county", record.GetString("county"), want.County},
+		{"url", record.GetString("url"), want.URL},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.field, c.want, c.got)
+		}
+	}
+}
+
+func TestSaveHomesFillsFromOtherSource(t *testing.T) {
+	app := newHomesTestApp(t)
+
+	owner := Home{ListingID: "A1", Street: "10 Main St", City: "Chattanooga", State: "TN", Zip: "37402", Price: 250000, Status: "Active"}
+	other := owner
+	other.ListingID = "B1"
+	other.Price = 240000
+	other.Status = "Pending"
+	other.County = "Hamilton"
+	other.Description = "Brick ranch"
+
+	for _, homes := range [][]Home{{owner}, {other}} {
+		if _, err := SaveHomes(app, homes); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	record, err := app.FindFirstRecordByFilter("homes", "listing_id = 'A1'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.GetInt("price") != 250000 || record.GetString("status") != "Active" {
+		t.Errorf("Expected the owning source's price and status, got %d %s", record.GetInt("price"), record.GetString("status"))
+	}
+	if record.GetString("county") != "Hamilton" || record.GetString("description") != "Brick ranch" {
+		t.Errorf("Expected empty fields to be filled, got %q %q", record.GetString("county"), record.GetString("description"))
+	}
+}
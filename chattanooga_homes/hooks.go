@@ -9,17 +9,64 @@ import (
 
 // FieldChange represents a change to a field with old and new values
 type FieldChange struct {
-	Field    string
-	OldValue interface{}
-	NewValue interface{}
+	Field    string      `json:"field"`
+	OldValue interface{} `json:"old_value"`
+	NewValue interface{} `json:"new_value"`
+}
+
+// fieldsToCheck are the listing fields whose changes are announced
+// (excludes tracking fields like last_seen and the Discord IDs)
+var fieldsToCheck = []string{
+	"street", "city", "state", "zip", "price", "sub_type", "county",
+	"area", "subdivision", "living_area", "beds_total", "baths_total",
+	"acres", "year_built", "url", "image_url", "status",
 }
 
 // RegisterHooks sets up PocketBase hooks for the homes collection
 // These hooks will:
-// 1. Log changes server-side
-// 2. Post to Discord on create/update
-// 3. Automatically broadcast to WebSocket subscribers (built into PocketBase)
+//  1. Log changes server-side
+//  2. Record the change in home_history and queue Discord posts and per-user
+//     alerts in the notification outbox, inside the same transaction as the
+//     listing change
+//  3. Validate alert targets and digest schedules, and reset coordinates when an address changes
+//  4. Score listings and estimate their monthly cost as they are saved
+//  5. Automatically broadcast to WebSocket subscribers (built into PocketBase)
 func RegisterHooks(app *pocketbase.PocketBase) {
+	// Hook: Queue notifications for a new home in the create transaction
+	app.OnRecordCreateExecute("homes").BindFunc(func(e *core.RecordEvent) error {
+		return e.App.RunInTransaction(func(txApp core.App) error {
+			e.App = txApp
+			if err := e.Next(); err != nil {
+				return err
+			}
+			if err := recordHomeHistory(txApp, e.Record, nil); err != nil {
+				return err
+			}
+			return enqueueHomeNotifications(txApp, e.Record, nil)
+		})
+	})
+
+	// Hook: Queue notifications for meaningful changes in the update transaction
+	app.OnRecordUpdateExecute("homes").BindFunc(func(e *core.RecordEvent) error {
+		changes := detectChanges(e.Record)
+
+		// Skip if no meaningful changes
+		if len(changes) == 0 {
+			return e.Next()
+		}
+
+		return e.App.RunInTransaction(func(txApp core.App) error {
+			e.App = txApp
+			if err := e.Next(); err != nil {
+				return err
+			}
+			if err := recordHomeHistory(txApp, e.Record, changes); err != nil {
+				return err
+			}
+			return enqueueHomeNotifications(txApp, e.Record, changes)
+		})
+	})
+
 	// Hook: After a home record is created
 	app.OnRecordAfterCreateSuccess("homes").BindFunc(func(e *core.RecordEvent) error {
 		street := e.Record.GetString("street")
@@ -28,65 +75,20 @@ func RegisterHooks(app *pocketbase.PocketBase) {
 
 		log.Printf("[HOMES EVENT] NEW LISTING: %s, %s - $%d", street, city, price)
 
-		// Post to Discord and save message ID
-		go func() {
-			messageID, err := PostHomeToDiscord(app, e.Record)
-			if err != nil {
-				log.Printf("[DISCORD] Error posting new listing: %v", err)
-				return
-			}
-
-			// Save the Discord message ID to the record
-			e.Record.Set("discord_message_id", messageID)
-			if err := app.Save(e.Record); err != nil {
-				log.Printf("[DISCORD] Error saving message ID: %v", err)
-			} else {
-				log.Printf("[DISCORD] Posted new listing, message ID: %s", messageID)
-			}
-		}()
+		wakeJob(outboxJob)
+		wakeJob(geocodeJob)
+		wakeJob(imageArchiveJob)
 
 		return e.Next()
 	})
 
 	// Hook: After a home record is updated
 	app.OnRecordAfterUpdateSuccess("homes").BindFunc(func(e *core.RecordEvent) error {
-		// Get the original record before the update
-		original := e.Record.Original()
-		if original == nil {
-			return e.Next()
-		}
-
-		// Check if any meaningful fields changed (exclude last_seen and discord_message_id)
-		fieldsToCheck := []string{
-			"street", "city", "state", "zip", "price", "sub_type", "county",
-			"area", "subdivision", "living_area", "beds_total", "baths_total",
-			"acres", "year_built", "url", "image_url", "status",
-		}
-
-		var changes []FieldChange
-		for _, field := range fieldsToCheck {
-			oldVal := original.Get(field)
-			newVal := e.Record.Get(field)
-			if oldVal != newVal {
-				changes = append(changes, FieldChange{
-					Field:    field,
-					OldValue: oldVal,
-					NewValue: newVal,
-				})
-			}
-		}
-
-		// Skip if no meaningful changes
+		changes := detectChanges(e.Record)
 		if len(changes) == 0 {
 			return e.Next()
 		}
 
-		// Skip if this is a new record (original had no street - key required field)
-		// This happens when we save discord_message_id right after creation
-		if original.GetString("street") == "" {
-			return e.Next()
-		}
-
 		street := e.Record.GetString("street")
 		status := e.Record.GetString("status")
 		price := e.Record.GetInt("price")
@@ -96,18 +98,18 @@ func RegisterHooks(app *pocketbase.PocketBase) {
 			log.Printf("  - %s: %v -> %v", change.Field, change.OldValue, change.NewValue)
 		}
 
-		// Post update to Discord thread
-		go func() {
-			if err := PostUpdateToDiscordThread(app, e.Record, changes); err != nil {
-				log.Printf("[DISCORD] Error posting update: %v", err)
-			} else {
-				log.Printf("[DISCORD] Posted update to thread for: %s", street)
-			}
-		}()
+		wakeJob(outboxJob)
 
 		return e.Next()
 	})
 
+	registerAlertHooks(app)
+	registerDigestHooks(app)
+	registerGeocodeHooks(app)
+	registerImageHooks(app)
+	registerScoringHooks(app)
+	registerCostHooks(app)
+
 	// Hook: After a home record is deleted
 	app.OnRecordAfterDeleteSuccess("homes").BindFunc(func(e *core.RecordEvent) error {
 		street := e.Record.GetString("street")
@@ -117,3 +119,32 @@ func RegisterHooks(app *pocketbase.PocketBase) {
 		return e.Next()
 	})
 }
+
+// detectChanges compares a record to its original state and returns the
+// meaningful field changes
+func detectChanges(record *core.Record) []FieldChange {
+	// Get the original record before the update
+	original := record.Original()
+	if original == nil {
+		return nil
+	}
+
+	// Skip if this is a new record (original had no street - key required field)
+	if original.GetString("street") == "" {
+		return nil
+	}
+
+	var changes []FieldChange
+	for _, field := range fieldsToCheck {
+		oldVal := original.Get(field)
+		newVal := record.Get(field)
+		if oldVal != newVal {
+			changes = append(changes, FieldChange{
+				Field:    field,
+				OldValue: oldVal,
+				NewValue: newVal,
+			})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,284 @@
+package chattanooga_homes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"pb-backend/jobs"
+
+	"github.com/disintegration/imaging"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+const (
+	// How often the archive job looks for listings with unarchived images
+	imageArchiveJob       = "homes_image_archive"
+	imageArchiveInterval  = 5 * time.Minute
+	imageArchiveBatchSize = 20
+	imageDownloadTimeout  = 30 * time.Second
+	imageRetryBaseBackoff = 15 * time.Minute
+	imageRetryMaxBackoff  = 24 * time.Hour
+
+	maxImageSize      = 10 << 20
+	maxArchivedPhotos = 40
+
+	// Thumbnails fit within this box, keeping the aspect ratio
+	thumbWidth   = 400
+	thumbHeight  = 300
+	thumbQuality = 80
+)
+
+// errImageGone means the CDN no longer serves the image, so retrying is
+// pointless
+var errImageGone = errors.New("image no longer available")
+
+// homeImageURL returns the stable URL of a listing's archived image, or
+// the CDN URL until it has been archived
+func homeImageURL(app core.App, record *core.Record) string {
+	if url := homeFileURL(app, record, record.GetString("image")); url != "" {
+		return url
+	}
+	return record.GetString("image_url")
+}
+
+// homeThumbURL returns the archived thumbnail URL, falling back like
+// homeImageURL
+func homeThumbURL(app core.App, record *core.Record) string {
+	if url := homeFileURL(app, record, record.GetString("image_thumb")); url != "" {
+		return url
+	}
+	return homeImageURL(app, record)
+}
+
+// homeFileURL builds the public PocketBase URL of a file on a listing. It
+// needs the Application URL setting, since Discord and email fetch images
+// from outside.
+func homeFileURL(app core.App, record *core.Record, filename string) string {
+	base := strings.TrimRight(app.Settings().Meta.AppURL, "/")
+	if filename == "" || base == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/api/files/%s/%s", base, record.BaseFilesPath(), filename)
+}
+
+// ImageArchiver copies listing photos from the CDN into the homes file
+// fields, with a thumbnail of the main image. A listing is archived again
+// when its image_url changes.
+type ImageArchiver struct {
+	app       *pocketbase.PocketBase
+	allPhotos bool
+}
+
+// NewImageArchiver creates an archiver. With allPhotos it also archives
+// every photo in photo_urls, not just the main image.
+func NewImageArchiver(app *pocketbase.PocketBase, allPhotos bool) *ImageArchiver {
+	return &ImageArchiver{app: app, allPhotos: allPhotos}
+}
+
+// AddJobs registers the archive job. New listings wake it.
+func (a *ImageArchiver) AddJobs(runner *jobs.Runner) {
+	runner.MustAdd(jobs.Job{
+		Name:       imageArchiveJob,
+		Every:      func() time.Duration { return imageArchiveInterval },
+		RunAtStart: true,
+		Enabled:    moduleEnabled,
+		Run:        a.archivePending,
+	})
+}
+
+// registerImageHooks clears the retry delay of listings whose image_url
+// changes, so a new image isn't held back by failures of the old one
+func registerImageHooks(app *pocketbase.PocketBase) {
+	app.OnRecordUpdate("homes").BindFunc(func(e *core.RecordEvent) error {
+		if original := e.Record.Original(); original != nil && original.GetString("image_url") != e.Record.GetString("image_url") {
+			e.Record.Set("image_attempts", 0)
+			e.Record.Set("image_retry_at", "")
+		}
+		return e.Next()
+	})
+}
+
+// archivePending archives listings whose current image_url has not been
+// archived yet. A listing that fails is retried after a growing delay, so
+// it doesn't hold up the others; only cancelling ctx ends the pass early.
+func (a *ImageArchiver) archivePending(ctx context.Context) (jobs.Counts, error) {
+	counts := jobs.Counts{"archived": 0, "failed": 0}
+	for {
+		records, err := a.app.FindRecordsByFilter("homes",
+			"image_url != '' && image_source != image_url && (image_retry_at = '' || image_retry_at <= {:now})",
+			"-first_seen", imageArchiveBatchSize, 0, map[string]any{"now": time.Now().UTC()})
+		if err != nil {
+			return counts, fmt.Errorf("finding listings: %w", err)
+		}
+		if len(records) == 0 {
+			return counts, nil
+		}
+
+		for _, record := range records {
+			err := a.archive(ctx, record)
+			if err == nil {
+				counts["archived"]++
+				continue
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return counts, ctxErr
+			}
+
+			counts["failed"]++
+			backoff := retryBackoff(record.GetInt("image_attempts")+1, imageRetryBaseBackoff, imageRetryMaxBackoff)
+			log.Printf("[IMAGES] Error archiving %s, retrying in %v: %v", record.GetString("street"), backoff, err)
+			if err := a.app.Save(scheduleRetry(record, "image", backoff)); err != nil {
+				return counts, fmt.Errorf("saving %s: %w", record.Id, err)
+			}
+		}
+	}
+}
+
+// archive downloads a listing's images and saves them on the record
+func (a *ImageArchiver) archive(ctx context.Context, record *core.Record) error {
+	source := record.GetString("image_url")
+	listingID := record.GetString("listing_id")
+
+	data, err := downloadImage(ctx, source)
+	switch {
+	case errors.Is(err, errImageGone):
+		// Nothing left to archive; keep whatever we had and stop retrying
+		log.Printf("[IMAGES] Image for %s is gone: %s", record.GetString("street"), source)
+		record.Set("image_source", source)
+		return a.app.Save(record)
+	case err != nil:
+		return err
+	}
+
+	file, err := filesystem.NewFileFromBytes(data, listingID+imageExtension(source))
+	if err != nil {
+		return err
+	}
+	record.Set("image", file)
+
+	if thumb, err := makeThumbnail(data); err != nil {
+		log.Printf("[IMAGES] Error creating thumbnail for %s: %v", record.GetString("street"), err)
+	} else if thumbFile, err := filesystem.NewFileFromBytes(thumb, listingID+"_thumb.jpg"); err == nil {
+		record.Set("image_thumb", thumbFile)
+	}
+
+	if a.allPhotos {
+		var photoURLs []string
+		_ = record.UnmarshalJSONField("photo_urls", &photoURLs)
+		if len(photoURLs) > maxArchivedPhotos {
+			photoURLs = photoURLs[:maxArchivedPhotos]
+		}
+
+		var photos []*filesystem.File
+		for i, photoURL := range photoURLs {
+			photoData := data
+			if photoURL != source {
+				if photoData, err = downloadImage(ctx, photoURL); err != nil {
+					log.Printf("[IMAGES] Skipping photo %s: %v", photoURL, err)
+					continue
+				}
+			}
+			photo, err := filesystem.NewFileFromBytes(photoData, fmt.Sprintf("%s_%02d%s", listingID, i+1, imageExtension(photoURL)))
+			if err != nil {
+				return err
+			}
+			photos = append(photos, photo)
+		}
+		if len(photos) > 0 {
+			record.Set("photos", photos)
+		}
+	}
+
+	record.Set("image_source", source)
+	record.Set("image_attempts", 0)
+	record.Set("image_retry_at", "")
+	if err := a.app.Save(record); err != nil {
+		return err
+	}
+	log.Printf("[IMAGES] Archived images for %s", record.GetString("street"))
+
+	// Point existing Discord posts at the archived copy before the CDN
+	// URL expires
+	if posts, err := homeDiscordPosts(a.app, record.Id); err == nil && len(posts) > 0 {
+		if err := RefreshHomeDiscordMessage(a.app, record); err != nil {
+			log.Printf("[IMAGES] Error refreshing Discord posts for %s: %v", record.GetString("street"), err)
+		}
+	}
+	return nil
+}
+
+// downloadImage fetches an image, rejecting non-images and oversized files
+func downloadImage(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; pb-backend-homes/1.0)")
+
+	client := &http.Client{Timeout: imageDownloadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusForbidden:
+		return nil, errImageGone
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("image download returned status %d", resp.StatusCode)
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" && !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("unexpected content type %q", contentType)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageSize {
+		return nil, fmt.Errorf("image larger than %d bytes", maxImageSize)
+	}
+	return data, nil
+}
+
+// makeThumbnail scales an image to fit the thumbnail box as a JPEG
+func makeThumbnail(data []byte) ([]byte, error) {
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, err
+	}
+
+	thumb := imaging.Fit(img, thumbWidth, thumbHeight, imaging.Lanczos)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: thumbQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// imageExtension returns the file extension of an image URL, defaulting
+// to .jpg
+func imageExtension(url string) string {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
+	switch ext := strings.ToLower(path.Ext(url)); ext {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp":
+		return ext
+	}
+	return ".jpg"
+}
@@ -0,0 +1,69 @@
+package chattanooga_homes
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestArchivePendingSkipsFailures(t *testing.T) {
+	app := newHomesTestApp(t)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	var badRequests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad.jpg" {
+			badRequests.Add(1)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	// The failing listing is newest, so it sorts first
+	homes := []Home{
+		{ListingID: "good", Street: "1 Good St", Zip: "37402", ImageURL: srv.URL + "/good.jpg"},
+		{ListingID: "bad", Street: "2 Bad St", Zip: "37402", ImageURL: srv.URL + "/bad.jpg"},
+	}
+	for _, home := range homes {
+		if _, err := SaveHomes(app, []Home{home}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archiver := NewImageArchiver(app, false)
+	counts, err := archiver.archivePending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["archived"] != 1 || counts["failed"] != 1 {
+		t.Fatalf("Expected one archived and one failed, got %v", counts)
+	}
+
+	bad, err := app.FindFirstRecordByFilter("homes", "listing_id = 'bad'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bad.GetInt("image_attempts") != 1 || bad.GetDateTime("image_retry_at").IsZero() {
+		t.Errorf("Expected the failure to be recorded, got %d attempts, retry at %v",
+			bad.GetInt("image_attempts"), bad.GetDateTime("image_retry_at"))
+	}
+
+	// Not retried before its retry time
+	if _, err := archiver.archivePending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := badRequests.Load(); n != 1 {
+		t.Errorf("Expected the failing image to wait for its retry time, got %d requests", n)
+	}
+}
@@ -0,0 +1,638 @@
+package chattanooga_homes
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pb-backend/discord"
+	"pb-backend/jobs"
+	"pb-backend/notify"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Discord interaction and response types
+const (
+	interactionPing             = 1
+	interactionApplicationCmd   = 2
+	interactionMessageComponent = 3
+
+	responsePong                   = 1
+	responseChannelMessage         = 4
+	responseDeferredChannelMessage = 5
+
+	maxInteractionBody = 1 << 20
+	maxSearchResults   = 5
+
+	// Signed requests older or newer than this are rejected as replays
+	maxSignatureSkew = 5 * time.Minute
+)
+
+// Discord permission bits. /homes scrape needs Manage Server, which
+// administrators have implicitly.
+const (
+	permissionAdministrator = 1 << 3
+	permissionManageGuild   = 1 << 5
+)
+
+// discordInteraction is the subset of an incoming interaction we use
+type discordInteraction struct {
+	Type          int    `json:"type"`
+	ApplicationID string `json:"application_id"`
+	Token         string `json:"token"`
+	Data          struct {
+		Name     string              `json:"name"`
+		CustomID string              `json:"custom_id"`
+		Options  []interactionOption `json:"options"`
+	} `json:"data"`
+	Member *struct {
+		User discordUser `json:"user"`
+		// Permissions is the member's permission bitfield in the channel
+		Permissions string `json:"permissions"`
+	} `json:"member"`
+	User *discordUser `json:"user"`
+}
+
+type interactionOption struct {
+	Name    string              `json:"name"`
+	Value   json.RawMessage     `json:"value"`
+	Options []interactionOption `json:"options"`
+}
+
+type discordUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// interactionResponse is the reply to an interaction
+type interactionResponse struct {
+	Type int              `json:"type"`
+	Data *discord.Message `json:"data,omitempty"`
+}
+
+// user returns the invoking user for both guild and DM interactions
+func (i *discordInteraction) user() discordUser {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	if i.User != nil {
+		return *i.User
+	}
+	return discordUser{}
+}
+
+// canManageGuild reports whether the invoking member has Manage Server.
+// Commands used in DMs have no member and never do.
+func (i *discordInteraction) canManageGuild() bool {
+	if i.Member == nil {
+		return false
+	}
+	permissions, err := strconv.ParseUint(i.Member.Permissions, 10, 64)
+	if err != nil {
+		return false
+	}
+	return permissions&(permissionAdministrator|permissionManageGuild) != 0
+}
+
+// stringOption returns the string value of a named option
+func stringOption(options []interactionOption, name string) string {
+	for _, opt := range options {
+		if opt.Name == name {
+			var s string
+			if err := json.Unmarshal(opt.Value, &s); err == nil {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// InteractionHandler serves Discord's interactions webhook
+type InteractionHandler struct {
+	app       *pocketbase.PocketBase
+	scheduler *HomesScheduler
+}
+
+// RegisterDiscordInteractions mounts the interactions endpoint. Set each
+// application's Interactions Endpoint URL in the Discord developer portal to
+// https://<host>/api/discord/interactions/<discord_config name>; the default
+// bot may also use https://<host>/api/discord/interactions.
+func RegisterDiscordInteractions(app *pocketbase.PocketBase, se *core.ServeEvent, scheduler *HomesScheduler) {
+	h := &InteractionHandler{app: app, scheduler: scheduler}
+	se.Router.POST("/api/discord/interactions", h.handle)
+	se.Router.POST("/api/discord/interactions/{config}", h.handle)
+}
+
+func (h *InteractionHandler) handle(e *core.RequestEvent) error {
+	name := e.Request.PathValue("config")
+	if name == "" {
+		name = discord.DefaultConfigName
+	}
+
+	config, err := discord.GetConfig(h.app, name)
+	if err != nil || config.PublicKey == "" {
+		return e.JSON(http.StatusServiceUnavailable, map[string]string{"error": "discord interactions not configured"})
+	}
+
+	body, err := io.ReadAll(io.LimitReader(e.Request.Body, maxInteractionBody))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "failed to read body"})
+	}
+
+	if !verifyDiscordSignature(config.PublicKey,
+		e.Request.Header.Get("X-Signature-Ed25519"),
+		e.Request.Header.Get("X-Signature-Timestamp"),
+		body, time.Now()) {
+		return e.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid request signature"})
+	}
+
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid interaction"})
+	}
+
+	switch interaction.Type {
+	case interactionPing:
+		return e.JSON(http.StatusOK, interactionResponse{Type: responsePong})
+	case interactionApplicationCmd:
+		return e.JSON(http.StatusOK, h.handleCommand(config, &interaction))
+	case interactionMessageComponent:
+		return e.JSON(http.StatusOK, h.handleComponent(&interaction))
+	}
+
+	return e.JSON(http.StatusBadRequest, map[string]string{"error": "unsupported interaction type"})
+}
+
+// verifyDiscordSignature checks the Ed25519 signature Discord sends over
+// timestamp + body, and that the timestamp is within maxSignatureSkew of
+// now so captured requests can't be replayed later
+func verifyDiscordSignature(publicKeyHex, signatureHex, timestamp string, body []byte, now time.Time) bool {
+	publicKey, err := hex.DecodeString(publicKeyHex)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	signature, err := hex.DecodeString(signatureHex)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return false
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > maxSignatureSkew || skew < -maxSignatureSkew {
+		return false
+	}
+
+	message := make([]byte, 0, len(timestamp)+len(body))
+	message = append(message, timestamp...)
+	message = append(message, body...)
+	return ed25519.Verify(publicKey, message, signature)
+}
+
+// ephemeral builds a reply only the invoking user sees
+func ephemeral(content string, embeds ...discord.Embed) interactionResponse {
+	return interactionResponse{
+		Type: responseChannelMessage,
+		Data: &discord.Message{Content: content, Embeds: embeds, Flags: discord.FlagEphemeral},
+	}
+}
+
+func (h *InteractionHandler) handleCommand(config *discord.Config, interaction *discordInteraction) interactionResponse {
+	user := interaction.user()
+	if interaction.Data.Name != "homes" || len(interaction.Data.Options) == 0 {
+		return ephemeral("Unknown command")
+	}
+
+	sub := interaction.Data.Options[0]
+	log.Printf("[DISCORD] /homes %s from %s", sub.Name, user.Username)
+
+	switch sub.Name {
+	case "search":
+		return h.commandSearch(user, stringOption(sub.Options, "query"))
+	case "watch":
+		return h.commandWatch(user, stringOption(sub.Options, "listing"))
+	case "stats":
+		return h.commandStats()
+	case "scrape":
+		return h.commandScrape(config, interaction)
+	}
+
+	return ephemeral(fmt.Sprintf("Unknown subcommand %q", sub.Name))
+}
+
+// commandScrape defers the reply and edits it once the scrape finishes,
+// since scrapes take longer than Discord's 3 second response window. Only
+// members with Manage Server can start one. Discord can't restrict a single
+// subcommand, so everyone sees it and the check happens here.
+func (h *InteractionHandler) commandScrape(config *discord.Config, interaction *discordInteraction) interactionResponse {
+	if !interaction.canManageGuild() {
+		return ephemeral("You need the Manage Server permission to start a scrape")
+	}
+	if h.scheduler == nil {
+		return ephemeral("Scraping is not enabled")
+	}
+	results, err := h.scheduler.ScrapeNow()
+	switch {
+	case errors.Is(err, jobs.ErrRunning):
+		return ephemeral("A scrape is already running")
+	case errors.Is(err, jobs.ErrDisabled), errors.Is(err, jobs.ErrNotFound):
+		return ephemeral("Scraping is not enabled")
+	case err != nil:
+		return ephemeral(fmt.Sprintf("❌ Scrape failed: %v", err))
+	}
+
+	applicationID, token := interaction.ApplicationID, interaction.Token
+	go func() {
+		content := ""
+		result := <-results
+		if result.Err != nil {
+			log.Printf("[DISCORD] Manual scrape failed: %v", result.Err)
+			content = fmt.Sprintf("❌ Scrape failed: %v", result.Err)
+		} else {
+			content = fmt.Sprintf("✅ Scrape complete: %d listings saved", result.Counts["saved"])
+		}
+
+		url := fmt.Sprintf("%s/webhooks/%s/%s/messages/@original", discord.APIBase, applicationID, token)
+		if err := discord.Request(config, "PATCH", url, discord.Message{Content: content}, nil); err != nil {
+			log.Printf("[DISCORD] Error editing scrape response: %v", err)
+		}
+	}()
+
+	return interactionResponse{Type: responseDeferredChannelMessage}
+}
+
+func (h *InteractionHandler) commandSearch(user discordUser, query string) interactionResponse {
+	filter, params, err := parseHomeSearch(query)
+	if err != nil {
+		return ephemeral(fmt.Sprintf("Invalid search: %v", err))
+	}
+
+	// Leave out listings the user has hidden, here or on the site
+	filter += " && home_hidden_via_home.discord_user_id != {:discord}"
+	params["discord"] = user.ID
+	if linked := discordLinkedUser(h.app, user.ID); linked != "" {
+		filter += " && home_hidden_via_home.user != {:auth}"
+		params["auth"] = linked
+	}
+
+	records, err := h.app.FindRecordsByFilter("homes", filter, "-score,-last_seen", maxSearchResults, 0, params)
+	if err != nil {
+		return ephemeral(fmt.Sprintf("Search failed: %v", err))
+	}
+	if len(records) == 0 {
+		return ephemeral("No listings match `" + query + "`")
+	}
+
+	embeds := make([]discord.Embed, 0, len(records))
+	for _, record := range records {
+		embeds = append(embeds, notify.DiscordEmbed(homeMessage(h.app, record, false)))
+	}
+	return ephemeral(fmt.Sprintf("Top %d listings for `%s`", len(records), query), embeds...)
+}
+
+func (h *InteractionHandler) commandWatch(user discordUser, reference string) interactionResponse {
+	record, err := findHomeByReference(h.app, reference)
+	if err != nil {
+		return ephemeral(fmt.Sprintf("Couldn't find a listing matching %q", reference))
+	}
+
+	if err := setDiscordHomeFlag(h.app, record.Id, user.ID, user.Username, FlagWatch); err != nil {
+		log.Printf("[DISCORD] Error saving watch: %v", err)
+		return ephemeral("Failed to watch listing")
+	}
+	return ephemeral(fmt.Sprintf("👀 Watching %s. You'll get a DM when it changes.", listingTitle(record)))
+}
+
+func (h *InteractionHandler) commandStats() interactionResponse {
+	var rows []struct {
+		Status string `db:"status"`
+		Count  int    `db:"count"`
+	}
+	err := h.app.DB().
+		NewQuery("SELECT status, COUNT(*) AS count FROM homes GROUP BY status").
+		All(&rows)
+	if err != nil {
+		return ephemeral(fmt.Sprintf("Failed to load stats: %v", err))
+	}
+
+	total := 0
+	var listings []string
+	for _, row := range rows {
+		total += row.Count
+		status := row.Status
+		if status == "" {
+			status = "Unknown"
+		}
+		listings = append(listings, fmt.Sprintf("%s: %s", status, formatNumber(row.Count)))
+	}
+	sort.Strings(listings)
+
+	embed := discord.Embed{
+		Title: "🏠 Homes Stats",
+		Color: 0x3498db,
+		Fields: []discord.EmbedField{
+			{Name: fmt.Sprintf("Listings (%s)", formatNumber(total)), Value: orNone(strings.Join(listings, "\n"))},
+		},
+	}
+
+	if outbox, err := OutboxStats(h.app); err == nil {
+		embed.Fields = append(embed.Fields, discord.EmbedField{
+			Name:   "Notification Outbox",
+			Value:  fmt.Sprintf("Pending: %d\nSent: %d\nDead: %d", outbox[OutboxPending]+outbox[OutboxProcessing], outbox[OutboxSent], outbox[OutboxDead]),
+			Inline: true,
+		})
+	}
+
+	if health, err := GetScraperHealth(h.app); err == nil {
+		for _, source := range health {
+			value := fmt.Sprintf("Last count: %d\nFailures: %d", source.LastListingCount, source.ConsecutiveFailures)
+			if !source.LastSuccess.IsZero() {
+				value += fmt.Sprintf("\nLast success: <t:%d:R>", source.LastSuccess.Unix())
+			}
+			embed.Fields = append(embed.Fields, discord.EmbedField{
+				Name:   "Scraper: " + source.Source,
+				Value:  value,
+				Inline: true,
+			})
+		}
+	}
+
+	return ephemeral("", embed)
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "None"
+	}
+	return s
+}
+
+// handleComponent toggles per-user flags from the buttons on listing posts.
+// custom_id is "<flag action>:<homes record ID>".
+func (h *InteractionHandler) handleComponent(interaction *discordInteraction) interactionResponse {
+	action, homeID, ok := strings.Cut(interaction.Data.CustomID, ":")
+	if !ok {
+		return ephemeral("Unknown button")
+	}
+
+	flag := map[string]string{"favorite": FlagFavorite, "watch": FlagWatch, "hide": FlagHidden}[action]
+	if flag == "" {
+		return ephemeral("Unknown button")
+	}
+
+	record, err := h.app.FindRecordById("homes", homeID)
+	if err != nil {
+		return ephemeral("This listing no longer exists")
+	}
+
+	user := interaction.user()
+	set, err := ToggleDiscordHomeFlag(h.app, record.Id, user.ID, user.Username, flag)
+	if err != nil {
+		log.Printf("[DISCORD] Error toggling %s: %v", flag, err)
+		return ephemeral("Something went wrong, please try again")
+	}
+
+	title := listingTitle(record)
+	switch {
+	case flag == FlagFavorite && set:
+		return ephemeral("⭐ Added " + title + " to your favorites")
+	case flag == FlagFavorite:
+		return ephemeral("Removed " + title + " from your favorites")
+	case flag == FlagWatch && set:
+		return ephemeral("👀 Watching " + title + ". You'll get a DM when it changes.")
+	case flag == FlagWatch:
+		return ephemeral("Stopped watching " + title)
+	case set:
+		return ephemeral("🙈 Hid " + title + " from your searches")
+	default:
+		return ephemeral("Unhid " + title)
+	}
+}
+
+// findHomeByReference looks a listing up by record ID, MLS listing ID or street
+func findHomeByReference(app *pocketbase.PocketBase, reference string) (*core.Record, error) {
+	reference = strings.TrimSpace(reference)
+	if reference == "" {
+		return nil, fmt.Errorf("empty reference")
+	}
+
+	if record, err := app.FindRecordById("homes", reference); err == nil {
+		return record, nil
+	}
+	if record, err := app.FindFirstRecordByFilter("homes", "listing_id = {:ref}", map[string]any{"ref": reference}); err == nil {
+		return record, nil
+	}
+	return app.FindFirstRecordByFilter("homes", "street ~ {:ref}", map[string]any{"ref": reference})
+}
+
+// searchFields maps search keys to homes fields and whether they're numeric
+var searchFields = map[string]struct {
+	field   string
+	numeric bool
+}{
+	"price":       {"price", true},
+	"acres":       {"acres", true},
+	"beds":        {"beds_total", true},
+	"baths":       {"baths_total", true},
+	"sqft":        {"living_area", true},
+	"year":        {"year_built", true},
+	"county":      {"county", false},
+	"city":        {"city", false},
+	"status":      {"status", false},
+	"zip":         {"zip", false},
+	"subdivision": {"subdivision", false},
+	"area":        {"area", false},
+	"type":        {"sub_type", false},
+}
+
+// searchOperators are checked in order so two-character operators win
+var searchOperators = []string{">=", "<=", "!=", ">", "<", "=", "~"}
+
+// parseHomeSearch turns a query like `price<400k acres>5 county=Hamilton` into
+// a parameterized PocketBase filter. Text comparisons with = are
+// case-insensitive contains matches; bare words match street, city or
+// subdivision.
+func parseHomeSearch(query string) (string, map[string]any, error) {
+	var clauses []string
+	params := map[string]any{}
+
+	for i, token := range strings.Fields(query) {
+		key := fmt.Sprintf("p%d", i)
+
+		op := ""
+		var name, value string
+		for _, candidate := range searchOperators {
+			if idx := strings.Index(token, candidate); idx > 0 {
+				op = candidate
+				name, value = strings.ToLower(token[:idx]), token[idx+len(candidate):]
+				break
+			}
+		}
+
+		if op == "" {
+			clauses = append(clauses, fmt.Sprintf("(street ~ {:%[1]s} || city ~ {:%[1]s} || subdivision ~ {:%[1]s})", key))
+			params[key] = token
+			continue
+		}
+
+		field, ok := searchFields[name]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown field %q", name)
+		}
+		if value == "" {
+			return "", nil, fmt.Errorf("missing value for %q", name)
+		}
+
+		if field.numeric {
+			if op == "~" {
+				return "", nil, fmt.Errorf("%q can't be used with ~", name)
+			}
+			n, err := parseSearchNumber(value)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid number for %q: %s", name, value)
+			}
+			params[key] = n
+		} else {
+			switch op {
+			case "=":
+				op = "~"
+			case "!=":
+				op = "!~"
+			case "~":
+			default:
+				return "", nil, fmt.Errorf("%q only supports =, != and ~", name)
+			}
+			params[key] = strings.ReplaceAll(value, "_", " ")
+		}
+
+		clauses = append(clauses, fmt.Sprintf("%s %s {:%s}", field.field, op, key))
+	}
+
+	if len(clauses) == 0 {
+		return "id != ''", params, nil
+	}
+	return strings.Join(clauses, " && "), params, nil
+}
+
+// parseSearchNumber accepts values like 400000, 400,000, $400k and 1.2m
+func parseSearchNumber(value string) (float64, error) {
+	value = strings.ToLower(strings.NewReplacer("$", "", ",", "").Replace(value))
+
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(value, "k"):
+		multiplier, value = 1e3, strings.TrimSuffix(value, "k")
+	case strings.HasSuffix(value, "m"):
+		multiplier, value = 1e6, strings.TrimSuffix(value, "m")
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
+
+// homesCommand is the /homes application command definition
+var homesCommand = map[string]any{
+	"name":        "homes",
+	"description": "Chattanooga home listings",
+	"options": []map[string]any{
+		{
+			"type":        1,
+			"name":        "search",
+			"description": "Search listings, e.g. price<400k acres>5 county=Hamilton",
+			"options": []map[string]any{
+				{"type": 3, "name": "query", "description": "Search terms", "required": true},
+			},
+		},
+		{
+			"type":        1,
+			"name":        "watch",
+			"description": "Get a DM when a listing changes",
+			"options": []map[string]any{
+				{"type": 3, "name": "listing", "description": "Listing ID or street address", "required": true},
+			},
+		},
+		{
+			"type":        1,
+			"name":        "stats",
+			"description": "Listing and scraper stats",
+		},
+		{
+			"type":        1,
+			"name":        "scrape",
+			"description": "Scrape listings now (needs Manage Server)",
+		},
+	},
+}
+
+// retiredCommands were registered by earlier versions and are deleted
+var retiredCommands = []string{"homes-scrape"}
+
+// RegisterDiscordCommands creates or updates the global /homes command for
+// every bot with an application ID and deletes retired commands. Other
+// commands registered for the application are left alone.
+func RegisterDiscordCommands(app *pocketbase.PocketBase) error {
+	configs, err := discord.ListConfigs(app)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, config := range configs {
+		if config.ApplicationID == "" {
+			continue
+		}
+		url := fmt.Sprintf("%s/applications/%s/commands", discord.APIBase, config.ApplicationID)
+		if err := discord.Request(config, "POST", url, homesCommand, nil); err != nil {
+			errs = append(errs, fmt.Errorf("%s /homes: %w", config.Name, err))
+		}
+
+		var registered []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		}
+		if err := discord.Request(config, "GET", url, nil, &registered); err != nil {
+			errs = append(errs, fmt.Errorf("%s: listing commands: %w", config.Name, err))
+			continue
+		}
+		for _, command := range registered {
+			if !slices.Contains(retiredCommands, command.Name) {
+				continue
+			}
+			if err := discord.Request(config, "DELETE", url+"/"+command.ID, nil, nil); err != nil {
+				errs = append(errs, fmt.Errorf("%s: deleting /%s: %w", config.Name, command.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sendWatchDM sends a listing update to a user who is watching it
+func sendWatchDM(app *pocketbase.PocketBase, userID string, record *core.Record, changes []FieldChange) error {
+	config, err := discord.GetDefaultConfig(app)
+	if err != nil {
+		return err
+	}
+
+	msg := homeMessage(app, record, true)
+	msg.Summary = "👀 A listing you're watching changed"
+	msg.Sections = []notify.Message{updateMessage(record, changes)}
+
+	notifier := &notify.DiscordDM{Config: config, UserID: userID}
+	_, err = notifier.Send(msg)
+	return err
+}
@@ -0,0 +1,119 @@
+package chattanooga_homes
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"maps"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyDiscordSignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1_760_000_000, 0)
+	body := []byte(`{"type":1}`)
+	sign := func(key ed25519.PrivateKey, timestamp string, body []byte) string {
+		return hex.EncodeToString(ed25519.Sign(key, append([]byte(timestamp), body...)))
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-maxSignatureSkew-time.Second).Unix(), 10)
+	future := strconv.FormatInt(now.Add(maxSignatureSkew+time.Second).Unix(), 10)
+	recent := strconv.FormatInt(now.Add(-time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		publicKey string
+		signature string
+		timestamp string
+		body      []byte
+		want      bool
+	}{
+		{"valid", hex.EncodeToString(publicKey), sign(privateKey, timestamp, body), timestamp, body, true},
+		{"recent", hex.EncodeToString(publicKey), sign(privateKey, recent, body), recent, body, true},
+		{"stale", hex.EncodeToString(publicKey), sign(privateKey, stale, body), stale, body, false},
+		{"future", hex.EncodeToString(publicKey), sign(privateKey, future, body), future, body, false},
+		{"other key", hex.EncodeToString(publicKey), sign(otherKey, timestamp, body), timestamp, body, false},
+		{"changed body", hex.EncodeToString(publicKey), sign(privateKey, timestamp, body), timestamp, []byte(`{"type":2}`), false},
+		{"changed timestamp", hex.EncodeToString(publicKey), sign(privateKey, timestamp, body), recent, body, false},
+		{"missing timestamp", hex.EncodeToString(publicKey), sign(privateKey, "", body), "", body, false},
+		{"non-numeric timestamp", hex.EncodeToString(publicKey), sign(privateKey, "abc", body), "abc", body, false},
+		{"missing signature", hex.EncodeToString(publicKey), "", timestamp, body, false},
+		{"malformed signature", hex.EncodeToString(publicKey), "zz", timestamp, body, false},
+		{"malformed public key", "abcd", sign(privateKey, timestamp, body), timestamp, body, false},
+	}
+	for _, tt := range tests {
+		if got := verifyDiscordSignature(tt.publicKey, tt.signature, tt.timestamp, tt.body, now); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestParseHomeSearch(t *testing.T) {
+	tests := []struct {
+		query   string
+		filter  string
+		params  map[string]any
+		wantErr bool
+	}{
+		{query: "", filter: "id != ''", params: map[string]any{}},
+		{
+			query:  "price<400k acres>5",
+			filter: "price < {:p0} && acres > {:p1}",
+			params: map[string]any{"p0": 400000.0, "p1": 5.0},
+		},
+		{
+			query:  "price<=$1.2m beds>=3 baths!=2 sqft=2,000",
+			filter: "price <= {:p0} && beds_total >= {:p1} && baths_total != {:p2} && living_area = {:p3}",
+			params: map[string]any{"p0": 1200000.0, "p1": 3.0, "p2": 2.0, "p3": 2000.0},
+		},
+		{
+			query:  "County=Hamilton city!=Dunlap",
+			filter: "county ~ {:p0} && city !~ {:p1}",
+			params: map[string]any{"p0": "Hamilton", "p1": "Dunlap"},
+		},
+		{
+			query:  "subdivision~Lookout_Ridge type=Single",
+			filter: "subdivision ~ {:p0} && sub_type ~ {:p1}",
+			params: map[string]any{"p0": "Lookout Ridge", "p1": "Single"},
+		},
+		{
+			query:  "signal year>2000",
+			filter: "(street ~ {:p0} || city ~ {:p0} || subdivision ~ {:p0}) && year_built > {:p1}",
+			params: map[string]any{"p0": "signal", "p1": 2000.0},
+		},
+		{query: "foo>3", wantErr: true},
+		{query: "price>", wantErr: true},
+		{query: "price~3", wantErr: true},
+		{query: "price>abc", wantErr: true},
+		{query: "county>5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		filter, params, err := parseHomeSearch(tt.query)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q", tt.query, filter)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.query, err)
+			continue
+		}
+		if filter != tt.filter {
+			t.Errorf("%q: expected filter %q, got %q", tt.query, tt.filter, filter)
+		}
+		if !maps.Equal(params, tt.params) {
+			t.Errorf("%q: expected params %v, got %v", tt.query, tt.params, params)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package chattanooga_homes
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"pb-backend/notify"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// homeMessage describes a home listing for notifications
+func homeMessage(app core.App, record *core.Record, isUpdate bool) notify.Message {
+	city := record.GetString("city")
+	state := record.GetString("state")
+	zip := record.GetString("zip")
+	price := record.GetInt("price")
+	beds := record.GetInt("beds_total")
+	baths := record.GetFloat("baths_total")
+	sqft := record.GetInt("living_area")
+	acres := record.GetFloat("acres")
+	yearBuilt := record.GetInt("year_built")
+	subType := record.GetString("sub_type")
+	county := record.GetString("county")
+	status := record.GetString("status")
+	url := record.GetString("url")
+	imageURL := homeImageURL(app, record)
+	title := listingTitle(record)
+
+	// Green for new, blue for update; pending and sold listings override
+	color := 0x2ECC71 // Green
+	if isUpdate {
+		color = 0x3498DB // Blue
+	}
+	if c, ok := statusColor(status); ok {
+		color = c
+	}
+
+	// Show price drops as a strikethrough of the previous price
+	priceValue := fmt.Sprintf("$%s", formatNumber(price))
+	if previous := record.GetInt("previous_price"); previous > price && price > 0 {
+		priceValue = fmt.Sprintf("~~$%s~~ $%s 📉", formatNumber(previous), formatNumber(price))
+	}
+
+	msg := notify.Message{
+		Title:     title,
+		Text:      relistNote(record),
+		URL:       url,
+		ImageURL:  imageURL,
+		Color:     color,
+		Timestamp: time.Now(),
+		Actions:   listingActions(record),
+		Fields: []notify.Field{
+			{Name: "💰 Price", Value: priceValue, Inline: true},
+			{Name: "📍 Location", Value: fmt.Sprintf("%s, %s %s", city, state, zip), Inline: true},
+			{Name: "🏘️ Type", Value: subType, Inline: true},
+			{Name: "📊 Status", Value: status, Inline: true},
+			{Name: "🛏️ Beds", Value: fmt.Sprintf("%d", beds), Inline: true},
+			{Name: "🛁 Baths", Value: fmt.Sprintf("%.1f", baths), Inline: true},
+			{Name: "📐 Sq Ft", Value: formatNumber(sqft), Inline: true},
+			{Name: "🌳 Acres", Value: fmt.Sprintf("%.2f", acres), Inline: true},
+			{Name: "📅 Year Built", Value: fmt.Sprintf("%d", yearBuilt), Inline: true},
+			{Name: "🗺️ County", Value: county, Inline: true},
+		},
+	}
+	if payment, ok := paymentValue(record); ok {
+		msg.Fields = append(msg.Fields, notify.Field{Name: "🏦 Est. Payment", Value: payment, Inline: true})
+	}
+	if score, ok := scoreValue(record); ok {
+		msg.Fields = append(msg.Fields, notify.Field{Name: "🏆 Score", Value: score, Inline: true})
+	}
+
+	return msg
+}
+
+// Listing status categories
+const (
+	statusActive    = "active"
+	statusPending   = "pending"
+	statusSold      = "sold"
+	statusOffMarket = "off_market"
+)
+
+// statusValues are the lower case MLS status values of each category
+// other than active; any other status counts as active
+var statusValues = []struct {
+	category string
+	values   []string
+}{
+	{statusPending, []string{"pending", "contingent", "under contract", "active under contract"}},
+	{statusSold, []string{"sold", "closed"}},
+	{statusOffMarket, []string{"withdrawn", "expired", "canceled", "cancelled", "inactive", "relisted"}},
+}
+
+// statusCategory groups the MLS status values
+func statusCategory(status string) string {
+	status = strings.ToLower(strings.TrimSpace(status))
+	for _, category := range statusValues {
+		if slices.Contains(category.values, status) {
+			return category.category
+		}
+	}
+	return statusActive
+}
+
+// statusCategoryExpr matches listings whose status is in one of the
+// categories, for filtering in SQL
+func statusCategoryExpr(categories map[string]bool) dbx.Expression {
+	column := "LOWER(TRIM([[homes.status]]))"
+	var matches []dbx.Expression
+	var known []any
+	for _, category := range statusValues {
+		values := make([]any, 0, len(category.values))
+		for _, value := range category.values {
+			values = append(values, value)
+		}
+		if categories[category.category] {
+			matches = append(matches, dbx.In(column, values...))
+		}
+		known = append(known, values...)
+	}
+	if categories[statusActive] {
+		matches = append(matches, dbx.NotIn(column, known...))
+	}
+	return dbx.Or(matches...)
+}
+
+// statusColor returns the embed color for listings that are no longer
+// simply active, so pending and sold listings stand out in the channel
+func statusColor(status string) (int, bool) {
+	switch statusCategory(status) {
+	case statusPending:
+		return 0xF1C40F, true // Yellow
+	case statusSold:
+		return 0xE74C3C, true // Red
+	case statusOffMarket:
+		return 0x95A5A6, true // Grey
+	}
+	return 0, false
+}
+
+// listingActions returns the buttons shown under a listing. The callback
+// buttons are handled by the Discord interactions endpoint.
+func listingActions(record *core.Record) []notify.Action {
+	actions := []notify.Action{
+		{Label: "⭐ Favorite", ID: "favorite:" + record.Id, Primary: true},
+		{Label: "👀 Watch", ID: "watch:" + record.Id},
+		{Label: "🙈 Hide", ID: "hide:" + record.Id},
+	}
+	if url := record.GetString("url"); url != "" {
+		actions = append(actions, notify.Action{Label: "View Listing", URL: url})
+	}
+	return actions
+}
+
+// updateMessage describes the changes to a listing
+func updateMessage(record *core.Record, changes []FieldChange) notify.Message {
+	title := listingTitle(record)
+
+	// Build fields for each change with old -> new format
+	var fields []notify.Field
+
+	for _, change := range changes {
+		fieldName := formatFieldName(change.Field)
+		oldStr := formatFieldValue(change.Field, change.OldValue)
+		newStr := formatFieldValue(change.Field, change.NewValue)
+
+		fields = append(fields, notify.Field{
+			Name:   fieldName,
+			Value:  fmt.Sprintf("%s → %s", oldStr, newStr),
+			Inline: true,
+		})
+	}
+
+	return notify.Message{
+		Title:     title,
+		Color:     0xF39C12, // Orange
+		Timestamp: time.Now(),
+		Fields:    fields,
+	}
+}
+
+// listingTitle produces a consistent title for embeds and threads
+func listingTitle(record *core.Record) string {
+	street := record.GetString("street")
+	return fmt.Sprintf("🏠 %s", street)
+}
+
+// formatFieldName converts field names to display names with emojis
+func formatFieldName(field string) string {
+	names := map[string]string{
+		"price":       "💰 Price",
+		"status":      "📊 Status",
+		"street":      "🏠 Street",
+		"city":        "📍 City",
+		"state":       "📍 State",
+		"zip":         "📍 Zip",
+		"sub_type":    "🏘️ Type",
+		"county":      "🗺️ County",
+		"area":        "🗺️ Area",
+		"subdivision": "🏘️ Subdivision",
+		"living_area": "📐 Sq Ft",
+		"beds_total":  "🛏️ Beds",
+		"baths_total": "🛁 Baths",
+		"acres":       "🌳 Acres",
+		"year_built":  "📅 Year Built",
+		"url":         "🔗 URL",
+		"image_url":   "🖼️ Image",
+	}
+	if name, ok := names[field]; ok {
+		return name
+	}
+	return field
+}
+
+// formatFieldValue formats a field value for display
+func formatFieldValue(field string, value interface{}) string {
+	if value == nil {
+		return "N/A"
+	}
+
+	switch field {
+	case "price":
+		if v, ok := value.(float64); ok {
+			return fmt.Sprintf("$%s", formatNumber(int(v)))
+		}
+		if v, ok := value.(int); ok {
+			return fmt.Sprintf("$%s", formatNumber(v))
+		}
+	case "living_area":
+		if v, ok := value.(float64); ok {
+			return fmt.Sprintf("%s sq ft", formatNumber(int(v)))
+		}
+		if v, ok := value.(int); ok {
+			return fmt.Sprintf("%s sq ft", formatNumber(v))
+		}
+	case "acres":
+		if v, ok := value.(float64); ok {
+			return fmt.Sprintf("%.2f", v)
+		}
+	case "baths_total":
+		if v, ok := value.(float64); ok {
+			return fmt.Sprintf("%.1f", v)
+		}
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+// formatNumber adds commas to numbers
+func formatNumber(n int) string {
+	str := fmt.Sprintf("%d", n)
+	if len(str) <= 3 {
+		return str
+	}
+
+	var result []byte
+	for i, c := range str {
+		if i > 0 && (len(str)-i)%3 == 0 {
+			result = append(result, ',')
+		}
+		result = append(result, byte(c))
+	}
+	return string(result)
+}
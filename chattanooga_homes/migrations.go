@@ -0,0 +1,12 @@
+package chattanooga_homes
+
+import (
+	"pb-backend/chattanooga_homes/migrations"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Migrations implements modules.Module
+func (m *Module) Migrations() core.MigrationsList {
+	return migrations.List
+}
@@ -0,0 +1,204 @@
+package migrations
+
+import (
+	"pb-backend/modules"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func init() {
+	List.Register(createHomes, func(app core.App) error {
+		return modules.DeleteCollections(app, "homes")
+	}, "1792356234_homes_create_homes")
+}
+
+// createHomes creates the homes collection of scraped listings
+func createHomes(app core.App) error {
+	collection := core.NewBaseCollection("homes")
+
+	// Listing ID (unique identifier from MLS)
+	collection.Fields.Add(&core.TextField{
+		Name:     "listing_id",
+		Required: true,
+	})
+
+	// Address fields
+	collection.Fields.Add(&core.TextField{
+		Name:     "street",
+		Required: true,
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "city",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "state",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "zip",
+	})
+
+	// Current price
+	collection.Fields.Add(&core.NumberField{
+		Name: "price",
+	})
+
+	// Price before the most recent price change
+	collection.Fields.Add(&core.NumberField{
+		Name: "previous_price",
+	})
+
+	// Property details
+	collection.Fields.Add(&core.TextField{
+		Name: "sub_type",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "county",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "area",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "subdivision",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "living_area",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "beds_total",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "baths_total",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "acres",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "year_built",
+	})
+
+	// URL to listing
+	collection.Fields.Add(&core.TextField{
+		Name: "url",
+	})
+
+	// Image URL
+	collection.Fields.Add(&core.TextField{
+		Name: "image_url",
+	})
+
+	// Public remarks
+	collection.Fields.Add(&core.TextField{
+		Name: "description",
+	})
+
+	// Archived copies of the listing photos, so they outlive the CDN URLs
+	collection.Fields.Add(&core.JSONField{
+		Name: "photo_urls",
+	})
+	collection.Fields.Add(&core.FileField{
+		Name:      "image",
+		MaxSelect: 1,
+		MaxSize:   10 << 20,
+		MimeTypes: []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+	})
+	collection.Fields.Add(&core.FileField{
+		Name:      "image_thumb",
+		MaxSelect: 1,
+		MaxSize:   10 << 20,
+		MimeTypes: []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+	})
+	collection.Fields.Add(&core.FileField{
+		Name:      "photos",
+		MaxSelect: 40,
+		MaxSize:   10 << 20,
+		MimeTypes: []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "image_source",
+	})
+
+	// Tracking fields
+	collection.Fields.Add(&core.DateField{
+		Name: "first_seen",
+	})
+	collection.Fields.Add(&core.DateField{
+		Name: "last_seen",
+	})
+
+	// Status: Active, Inactive, Sold, etc.
+	collection.Fields.Add(&core.TextField{
+		Name: "status",
+	})
+
+	// Normalized street+zip used to merge the same house from multiple sources
+	collection.Fields.Add(&core.TextField{
+		Name: "address_key",
+	})
+
+	// Coordinates filled in by the geocode worker
+	collection.Fields.Add(&core.NumberField{
+		Name: "lat",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "lon",
+	})
+	collection.Fields.Add(&core.DateField{
+		Name: "geocoded_at",
+	})
+
+	// Score from the active scoring model and its per-criterion breakdown
+	collection.Fields.Add(&core.NumberField{
+		Name: "score",
+	})
+	collection.Fields.Add(&core.JSONField{
+		Name: "score_details",
+	})
+
+	// Estimated monthly cost from the cost settings and its breakdown
+	collection.Fields.Add(&core.NumberField{
+		Name: "monthly_payment",
+	})
+	collection.Fields.Add(&core.JSONField{
+		Name: "payment_details",
+	})
+
+	// Last price, days on market and first sighting of the earlier listing
+	// this one relists; the relisted_from link is added once saved
+	collection.Fields.Add(&core.NumberField{
+		Name: "relisted_price",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "relisted_days",
+	})
+	collection.Fields.Add(&core.DateField{
+		Name: "original_first_seen",
+	})
+
+	collection.Indexes = []string{
+		"CREATE UNIQUE INDEX idx_homes_listing_id ON homes (listing_id)",
+		"CREATE INDEX idx_homes_price ON homes (price)",
+		"CREATE INDEX idx_homes_city ON homes (city)",
+		"CREATE INDEX idx_homes_county ON homes (county)",
+		"CREATE INDEX idx_homes_status ON homes (status)",
+		"CREATE INDEX idx_homes_address_key ON homes (address_key)",
+		"CREATE INDEX idx_homes_lat_lon ON homes (lat, lon)",
+		"CREATE INDEX idx_homes_score ON homes (score)",
+		"CREATE INDEX idx_homes_monthly_payment ON homes (monthly_payment)",
+	}
+
+	collection, err := modules.EnsureCollection(app, collection)
+	if err != nil {
+		return err
+	}
+
+	// Self relations need the saved collection
+	if collection.Fields.GetByName("relisted_from") != nil {
+		return nil
+	}
+	collection.Fields.Add(&core.RelationField{
+		Name:         "relisted_from",
+		CollectionId: collection.Id,
+		MaxSelect:    1,
+	})
+	return app.Save(collection)
+}
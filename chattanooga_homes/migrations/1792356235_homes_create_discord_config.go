@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"pb-backend/modules"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func init() {
+	List.Register(createDiscordConfig, func(app core.App) error {
+		return modules.DeleteCollections(app, "discord_config")
+	}, "1792356235_homes_create_discord_config")
+}
+
+// createDiscordConfig creates the discord_config collection, one record
+// per bot. It runs as a migration of the module that owns the bots.
+func createDiscordConfig(app core.App) error {
+	// No API rules: only superusers can read or change bot configs
+	collection := core.NewBaseCollection("discord_config")
+
+	collection.Fields.Add(&core.TextField{
+		Name:     "name",
+		Required: true,
+	})
+	// Encrypted at rest (see secrets.go) and never included in API responses
+	collection.Fields.Add(&core.TextField{
+		Name:     "bot_token",
+		Required: true,
+		Hidden:   true,
+	})
+	// Channel used when no routing rule matches
+	collection.Fields.Add(&core.TextField{
+		Name: "default_channel_id",
+	})
+
+	// Interactions endpoint: application ID and Ed25519 public key (hex)
+	collection.Fields.Add(&core.TextField{
+		Name: "application_id",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "public_key",
+	})
+
+	collection.Indexes = []string{
+		"CREATE UNIQUE INDEX idx_discord_config_name ON discord_config (name)",
+	}
+
+	_, err := modules.EnsureCollection(app, collection)
+	return err
+}
@@ -0,0 +1,739 @@
+package migrations
+
+import (
+	"fmt"
+
+	"pb-backend/modules"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	List.Register(createHomesSupportCollections, func(app core.App) error {
+		return modules.DeleteCollections(app, homesSupportCollections...)
+	}, "1792356236_homes_create_support_collections")
+}
+
+// Collections created by the third migration, dependents first
+var homesSupportCollections = []string{
+	"home_cost_settings",
+	"home_scoring",
+	"home_notes",
+	"home_watches",
+	"home_hidden",
+	"home_favorites",
+	"geocode_cache",
+	"home_digests",
+	"home_history",
+	"notification_outbox",
+	"home_alerts",
+	"scraper_health",
+	"discord_posts",
+	"discord_routes",
+}
+
+// deliveryKinds are the destinations alerts and digests can be sent to
+var deliveryKinds = []string{"discord_channel", "discord_dm", "email", "webhook", "discord_webhook", "slack", "ntfy"}
+
+// API rules for the per-user listing collections
+const (
+	userListAuthRule   = "@request.auth.id != ''"
+	userListOwnerRule  = userListAuthRule + " && user = @request.auth.id"
+	userListCreateRule = userListAuthRule + " && @request.body.user = @request.auth.id"
+	// Discord fields are only set by the bot
+	userFlagCreateRule = userListCreateRule + " && @request.body.discord_user_id:isset = false"
+)
+
+// createHomesSupportCollections creates the collections around homes:
+// notifications, alerts, history, user lists and the scoring and cost
+// settings. Collections made before migrations existed gain any missing
+// fields and indexes.
+func createHomesSupportCollections(app core.App) error {
+	steps := []struct {
+		name   string
+		create func(app core.App) error
+	}{
+		{"discord routes", createDiscordRoutes},
+		{"discord posts", createDiscordPosts},
+		{"scraper health", createScraperHealth},
+		{"home alerts", createHomeAlerts},
+		{"notification outbox", createNotificationOutbox},
+		{"home history", createHomeHistory},
+		{"home digests", createHomeDigests},
+		{"geocode cache", createGeocodeCache},
+		{"user home lists", createUserHomeLists},
+		{"home scoring", createHomeScoring},
+		{"home cost settings", createHomeCostSettings},
+	}
+	for _, step := range steps {
+		if err := step.create(app); err != nil {
+			return fmt.Errorf("failed to create %s schema: %w", step.name, err)
+		}
+	}
+	return nil
+}
+
+// createDiscordRoutes creates the discord_routes collection
+func createDiscordRoutes(app core.App) error {
+	configs, err := app.FindCollectionByNameOrId("discord_config")
+	if err != nil {
+		return fmt.Errorf("failed to find discord_config collection: %w", err)
+	}
+
+	collection := core.NewBaseCollection("discord_routes")
+
+	collection.Fields.Add(&core.TextField{
+		Name: "name",
+	})
+	collection.Fields.Add(&core.BoolField{
+		Name: "enabled",
+	})
+	// Module the route applies to, e.g. "homes" or "albion"
+	collection.Fields.Add(&core.TextField{
+		Name:     "module",
+		Required: true,
+	})
+
+	// Destination: the bot to post as and the channel (and its server)
+	collection.Fields.Add(&core.RelationField{
+		Name:          "config",
+		Required:      true,
+		CollectionId:  configs.Id,
+		CascadeDelete: true,
+		MaxSelect:     1,
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "guild_id",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name:     "channel_id",
+		Required: true,
+	})
+
+	// Criteria
+	collection.Fields.Add(&core.JSONField{
+		Name: "counties",
+	})
+	collection.Fields.Add(&core.JSONField{
+		Name: "statuses",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "min_price",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "max_price",
+	})
+	collection.Fields.Add(&core.JSONField{
+		Name: "tags",
+	})
+
+	// Evaluation order; lower runs first. Stop skips lower-priority routes.
+	collection.Fields.Add(&core.NumberField{
+		Name: "priority",
+	})
+	collection.Fields.Add(&core.BoolField{
+		Name: "stop",
+	})
+	collection.Fields.Add(&core.AutodateField{
+		Name:     "created",
+		OnCreate: true,
+	})
+
+	collection.Indexes = []string{
+		"CREATE INDEX idx_discord_routes_module ON discord_routes (module, priority)",
+	}
+
+	_, err = modules.EnsureCollection(app, collection)
+	return err
+}
+
+// createDiscordPosts creates the discord_posts collection, which
+// records every channel a listing was posted to along with its thread
+func createDiscordPosts(app core.App) error {
+	homes, err := app.FindCollectionByNameOrId("homes")
+	if err != nil {
+		return fmt.Errorf("failed to find homes collection: %w", err)
+	}
+	configs, err := app.FindCollectionByNameOrId("discord_config")
+	if err != nil {
+		return fmt.Errorf("failed to find discord_config collection: %w", err)
+	}
+
+	collection := core.NewBaseCollection("discord_posts")
+
+	collection.Fields.Add(&core.RelationField{
+		Name:          "home",
+		Required:      true,
+		CollectionId:  homes.Id,
+		CascadeDelete: true,
+		MaxSelect:     1,
+	})
+	// Bot that posted the message
+	collection.Fields.Add(&core.RelationField{
+		Name:          "config",
+		Required:      true,
+		CollectionId:  configs.Id,
+		CascadeDelete: true,
+		MaxSelect:     1,
+	})
+	collection.Fields.Add(&core.TextField{
+		Name:     "channel_id",
+		Required: true,
+	})
+	collection.Fields.Add(&core.TextField{
+		Name:     "message_id",
+		Required: true,
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "thread_id",
+	})
+	collection.Fields.Add(&core.AutodateField{
+		Name:     "created",
+		OnCreate: true,
+	})
+
+	collection.Indexes = []string{
+		"CREATE UNIQUE INDEX idx_discord_posts_target ON discord_posts (home, config, channel_id)",
+	}
+
+	_, err = modules.EnsureCollection(app, collection)
+	return err
+}
+
+// createScraperHealth creates the scraper_health collection
+func createScraperHealth(app core.App) error {
+	collection := core.NewBaseCollection("scraper_health")
+
+	// Listing source name (one record per source)
+	collection.Fields.Add(&core.TextField{
+		Name:     "source",
+		Required: true,
+	})
+
+	collection.Fields.Add(&core.DateField{
+		Name: "last_success",
+	})
+	collection.Fields.Add(&core.DateField{
+		Name: "last_failure",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "last_error",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "last_listing_count",
+	})
+
+	// Counters
+	collection.Fields.Add(&core.NumberField{
+		Name: "consecutive_failures",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "consecutive_challenges",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "challenge_count",
+	})
+
+	collection.Indexes = []string{
+		"CREATE UNIQUE INDEX idx_scraper_health_source ON scraper_health (source)",
+	}
+
+	_, err := modules.EnsureCollection(app, collection)
+	return err
+}
+
+// createHomeAlerts creates the home_alerts collection
+func createHomeAlerts(app core.App) error {
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		return fmt.Errorf("failed to find users collection: %w", err)
+	}
+
+	collection := core.NewBaseCollection("home_alerts")
+
+	// Owner; users can only see and manage their own alerts
+	ownerRule := "@request.auth.id != '' && user = @request.auth.id"
+	collection.ListRule = types.Pointer(ownerRule)
+	collection.ViewRule = types.Pointer(ownerRule)
+	collection.CreateRule = types.Pointer("@request.auth.id != '' && @request.body.user = @request.auth.id")
+	collection.UpdateRule = types.Pointer(ownerRule + " && (@request.body.user:isset = false || @request.body.user = @request.auth.id)")
+	collection.DeleteRule = types.Pointer(ownerRule)
+
+	collection.Fields.Add(&core.RelationField{
+		Name:          "user",
+		Required:      true,
+		CollectionId:  users.Id,
+		CascadeDelete: true,
+		MaxSelect:     1,
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "name",
+	})
+	collection.Fields.Add(&core.BoolField{
+		Name: "enabled",
+	})
+
+	// Criteria
+	collection.Fields.Add(&core.NumberField{
+		Name: "min_price",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "max_price",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "min_beds",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "min_baths",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "min_acres",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "max_acres",
+	})
+	collection.Fields.Add(&core.JSONField{
+		Name: "counties",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "subdivision",
+	})
+	collection.Fields.Add(&core.JSONField{
+		Name: "keywords",
+	})
+
+	// Delivery
+	collection.Fields.Add(&core.SelectField{
+		Name:      "delivery",
+		Required:  true,
+		MaxSelect: 1,
+		Values:    deliveryKinds,
+	})
+	// Channel ID, Discord user ID, email address or URL depending on
+	// delivery. See checkAlertTarget for what users may choose.
+	collection.Fields.Add(&core.TextField{
+		Name:     "target",
+		Required: true,
+	})
+
+	collection.Indexes = []string{
+		"CREATE INDEX idx_home_alerts_user ON home_alerts (user)",
+	}
+
+	_, err = modules.EnsureCollection(app, collection)
+	return err
+}
+
+// createNotificationOutbox creates the notification_outbox collection
+func createNotificationOutbox(app core.App) error {
+	homes, err := app.FindCollectionByNameOrId("homes")
+	if err != nil {
+		return fmt.Errorf("failed to find homes collection: %w", err)
+	}
+
+	collection := core.NewBaseCollection("notification_outbox")
+
+	collection.Fields.Add(&core.SelectField{
+		Name:      "kind",
+		Required:  true,
+		MaxSelect: 1,
+		Values:    []string{"home_post", "home_update", "home_alert", "home_refresh", "home_watch"},
+	})
+	collection.Fields.Add(&core.RelationField{
+		Name:          "home",
+		Required:      true,
+		CollectionId:  homes.Id,
+		CascadeDelete: true,
+		MaxSelect:     1,
+	})
+	// home_alerts record ID for alert deliveries
+	collection.Fields.Add(&core.TextField{
+		Name: "alert",
+	})
+	// Discord user ID for watch deliveries
+	collection.Fields.Add(&core.TextField{
+		Name: "watcher",
+	})
+	collection.Fields.Add(&core.JSONField{
+		Name: "payload",
+	})
+
+	// Delivery state
+	collection.Fields.Add(&core.SelectField{
+		Name:      "status",
+		Required:  true,
+		MaxSelect: 1,
+		Values:    []string{"pending", "processing", "sent", "dead"},
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "attempts",
+	})
+	collection.Fields.Add(&core.DateField{
+		Name: "next_attempt_at",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "last_error",
+	})
+	collection.Fields.Add(&core.DateField{
+		Name: "sent_at",
+	})
+	collection.Fields.Add(&core.AutodateField{
+		Name:     "created",
+		OnCreate: true,
+	})
+
+	collection.Indexes = []string{
+		"CREATE INDEX idx_notification_outbox_due ON notification_outbox (status, next_attempt_at)",
+		"CREATE INDEX idx_notification_outbox_home ON notification_outbox (home)",
+	}
+
+	_, err = modules.EnsureCollection(app, collection)
+	return err
+}
+
+// createHomeHistory creates the home_history collection, one record
+// per listing creation or meaningful change
+func createHomeHistory(app core.App) error {
+	homes, err := app.FindCollectionByNameOrId("homes")
+	if err != nil {
+		return fmt.Errorf("failed to find homes collection: %w", err)
+	}
+
+	collection := core.NewBaseCollection("home_history")
+
+	collection.Fields.Add(&core.RelationField{
+		Name:          "home",
+		Required:      true,
+		CollectionId:  homes.Id,
+		CascadeDelete: true,
+		MaxSelect:     1,
+	})
+	collection.Fields.Add(&core.SelectField{
+		Name:      "event",
+		Required:  true,
+		MaxSelect: 1,
+		Values:    []string{"created", "updated", "relisted"},
+	})
+	collection.Fields.Add(&core.JSONField{
+		Name: "changes",
+	})
+
+	// Price and status after (and before) the event, for market queries
+	collection.Fields.Add(&core.NumberField{
+		Name: "price",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "old_price",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "status",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "old_status",
+	})
+	collection.Fields.Add(&core.AutodateField{
+		Name:     "created",
+		OnCreate: true,
+	})
+
+	collection.Indexes = []string{
+		"CREATE INDEX idx_home_history_home ON home_history (home, created)",
+		"CREATE INDEX idx_home_history_created ON home_history (created)",
+	}
+
+	_, err = modules.EnsureCollection(app, collection)
+	return err
+}
+
+// createHomeDigests creates the home_digests collection. Each record
+// is a scheduled market digest and where to send it.
+func createHomeDigests(app core.App) error {
+	collection := core.NewBaseCollection("home_digests")
+
+	collection.Fields.Add(&core.TextField{
+		Name:     "name",
+		Required: true,
+	})
+	collection.Fields.Add(&core.BoolField{
+		Name: "enabled",
+	})
+	collection.Fields.Add(&core.SelectField{
+		Name:      "period",
+		Required:  true,
+		MaxSelect: 1,
+		Values:    []string{"daily", "weekly"},
+	})
+
+	// Cron expression in server time; empty uses the period's default
+	collection.Fields.Add(&core.TextField{
+		Name: "schedule",
+	})
+	collection.Fields.Add(&core.SelectField{
+		Name:      "delivery",
+		Required:  true,
+		MaxSelect: 1,
+		Values:    deliveryKinds,
+	})
+	collection.Fields.Add(&core.TextField{
+		Name:     "target",
+		Required: true,
+	})
+	collection.Fields.Add(&core.DateField{
+		Name: "last_sent_at",
+	})
+
+	_, err := modules.EnsureCollection(app, collection)
+	return err
+}
+
+// createGeocodeCache creates the geocode_cache collection. Misses are
+// cached too, so no address is ever sent to a provider twice.
+func createGeocodeCache(app core.App) error {
+	collection := core.NewBaseCollection("geocode_cache")
+
+	collection.Fields.Add(&core.TextField{
+		Name:     "key",
+		Required: true,
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "address",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "provider",
+	})
+	collection.Fields.Add(&core.BoolField{
+		Name: "found",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "lat",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "lon",
+	})
+	collection.Fields.Add(&core.AutodateField{
+		Name:     "created",
+		OnCreate: true,
+	})
+
+	collection.Indexes = []string{
+		"CREATE UNIQUE INDEX idx_geocode_cache_key ON geocode_cache (key)",
+	}
+
+	_, err := modules.EnsureCollection(app, collection)
+	return err
+}
+
+// createUserHomeLists creates the home_favorites, home_hidden,
+// home_watches and home_notes collections. Favorites and notes are shared
+// with every signed in user so a household can shop together; hidden and
+// watched listings are private. Users can only add, change and remove their
+// own entries. Favorites, hidden and watched listings are also set from
+// Discord, for the site user the Discord account is linked to if any.
+func createUserHomeLists(app core.App) error {
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		return fmt.Errorf("failed to find users collection: %w", err)
+	}
+	homes, err := app.FindCollectionByNameOrId("homes")
+	if err != nil {
+		return fmt.Errorf("failed to find homes collection: %w", err)
+	}
+
+	if err := createUserHomeList(app, "home_favorites", users, homes, userListAuthRule); err != nil {
+		return err
+	}
+	if err := createUserHomeList(app, "home_hidden", users, homes, userListOwnerRule); err != nil {
+		return err
+	}
+	if err := createUserHomeList(app, "home_watches", users, homes, userListOwnerRule); err != nil {
+		return err
+	}
+	return createHomeNotes(app, users, homes)
+}
+
+// createUserHomeList creates a collection of (user, home) pairs. Entries
+// from Discord accounts not linked to a site user have no user.
+func createUserHomeList(app core.App, name string, users, homes *core.Collection, listRule string) error {
+	collection := core.NewBaseCollection(name)
+	collection.ListRule = types.Pointer(listRule)
+	collection.ViewRule = types.Pointer(listRule)
+	collection.CreateRule = types.Pointer(userFlagCreateRule)
+	collection.DeleteRule = types.Pointer(userListOwnerRule)
+
+	addUserHomeFields(collection, users, homes)
+	collection.Fields.GetByName("user").(*core.RelationField).Required = false
+	collection.Fields.Add(&core.TextField{
+		Name: "discord_user_id",
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "discord_username",
+	})
+	collection.Fields.Add(&core.AutodateField{
+		Name:     "created",
+		OnCreate: true,
+	})
+
+	collection.Indexes = []string{
+		fmt.Sprintf("CREATE UNIQUE INDEX idx_%s_user ON %s (user, home) WHERE user != ''", name, name),
+		fmt.Sprintf("CREATE UNIQUE INDEX idx_%s_discord ON %s (discord_user_id, home) WHERE discord_user_id != ''", name, name),
+		fmt.Sprintf("CREATE INDEX idx_%s_home ON %s (home)", name, name),
+	}
+
+	_, err := modules.EnsureCollection(app, collection)
+	return err
+}
+
+func createHomeNotes(app core.App, users, homes *core.Collection) error {
+	collection := core.NewBaseCollection("home_notes")
+	collection.ListRule = types.Pointer(userListAuthRule)
+	collection.ViewRule = types.Pointer(userListAuthRule)
+	collection.CreateRule = types.Pointer(userListCreateRule)
+	collection.UpdateRule = types.Pointer(userListOwnerRule + " && (@request.body.user:isset = false || @request.body.user = @request.auth.id)")
+	collection.DeleteRule = types.Pointer(userListOwnerRule)
+
+	addUserHomeFields(collection, users, homes)
+	collection.Fields.Add(&core.TextField{
+		Name:     "body",
+		Required: true,
+		Max:      5000,
+	})
+	collection.Fields.Add(&core.AutodateField{
+		Name:     "created",
+		OnCreate: true,
+	})
+	collection.Fields.Add(&core.AutodateField{
+		Name:     "updated",
+		OnCreate: true,
+		OnUpdate: true,
+	})
+
+	collection.Indexes = []string{
+		"CREATE INDEX idx_home_notes_home ON home_notes (home, created)",
+	}
+
+	_, err := modules.EnsureCollection(app, collection)
+	return err
+}
+
+func addUserHomeFields(collection *core.Collection, users, homes *core.Collection) {
+	collection.Fields.Add(&core.RelationField{
+		Name:          "user",
+		Required:      true,
+		CollectionId:  users.Id,
+		CascadeDelete: true,
+		MaxSelect:     1,
+	})
+	collection.Fields.Add(&core.RelationField{
+		Name:          "home",
+		Required:      true,
+		CollectionId:  homes.Id,
+		CascadeDelete: true,
+		MaxSelect:     1,
+	})
+}
+
+// createHomeScoring creates the home_scoring collection. The newest
+// enabled record is the active scoring model; saving one rescores every
+// listing.
+func createHomeScoring(app core.App) error {
+	collection := core.NewBaseCollection("home_scoring")
+	collection.ListRule = types.Pointer("@request.auth.id != ''")
+	collection.ViewRule = types.Pointer("@request.auth.id != ''")
+
+	collection.Fields.Add(&core.TextField{
+		Name:     "name",
+		Required: true,
+	})
+	collection.Fields.Add(&core.BoolField{
+		Name: "enabled",
+	})
+
+	for _, criterion := range []string{"price_per_acre", "living_area", "year_built", "distance", "keywords"} {
+		collection.Fields.Add(&core.NumberField{
+			Name: "weight_" + criterion,
+			Min:  types.Pointer(0.0),
+		})
+	}
+
+	collection.Fields.Add(&core.NumberField{Name: "price_per_acre_ideal"})
+	collection.Fields.Add(&core.NumberField{Name: "price_per_acre_max"})
+	collection.Fields.Add(&core.NumberField{Name: "living_area_min"})
+	collection.Fields.Add(&core.NumberField{Name: "living_area_ideal"})
+	collection.Fields.Add(&core.NumberField{Name: "year_built_min"})
+	collection.Fields.Add(&core.NumberField{Name: "year_built_ideal"})
+	collection.Fields.Add(&core.NumberField{Name: "origin_lat"})
+	collection.Fields.Add(&core.NumberField{Name: "origin_lon"})
+	collection.Fields.Add(&core.NumberField{Name: "distance_ideal_miles"})
+	collection.Fields.Add(&core.NumberField{Name: "distance_max_miles"})
+
+	// {"keyword": weight}, e.g. {"creek": 2, "barn": 1, "fixer": -2}
+	collection.Fields.Add(&core.JSONField{
+		Name: "keywords",
+	})
+
+	collection.Fields.Add(&core.AutodateField{
+		Name:     "updated",
+		OnCreate: true,
+		OnUpdate: true,
+	})
+
+	_, err := modules.EnsureCollection(app, collection)
+	return err
+}
+
+// createHomeCostSettings creates the home_cost_settings collection.
+// The newest enabled record replaces DefaultCostModel; saving one
+// recalculates every listing.
+func createHomeCostSettings(app core.App) error {
+	collection := core.NewBaseCollection("home_cost_settings")
+	collection.ListRule = types.Pointer("@request.auth.id != ''")
+	collection.ViewRule = types.Pointer("@request.auth.id != ''")
+
+	collection.Fields.Add(&core.TextField{
+		Name:     "name",
+		Required: true,
+	})
+	collection.Fields.Add(&core.BoolField{
+		Name: "enabled",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "interest_rate",
+		Min:  types.Pointer(0.0),
+		Max:  types.Pointer(30.0),
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "down_payment_percent",
+		Min:  types.Pointer(0.0),
+		Max:  types.Pointer(100.0),
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name:     "term_years",
+		Required: true,
+		OnlyInt:  true,
+		Min:      types.Pointer(1.0),
+		Max:      types.Pointer(50.0),
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "default_tax_rate",
+		Min:  types.Pointer(0.0),
+	})
+
+	// {"Hamilton": 0.62}; counties not listed use default_tax_rate
+	collection.Fields.Add(&core.JSONField{
+		Name: "county_tax_rates",
+	})
+	collection.Fields.Add(&core.NumberField{
+		Name: "insurance_rate",
+		Min:  types.Pointer(0.0),
+	})
+	collection.Fields.Add(&core.AutodateField{
+		Name:     "updated",
+		OnCreate: true,
+		OnUpdate: true,
+	})
+
+	// Existing listings are priced by the costs job, which runs at start
+	_, err := modules.EnsureCollection(app, collection)
+	return err
+}
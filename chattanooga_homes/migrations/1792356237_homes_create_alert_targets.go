@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"pb-backend/modules"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func init() {
+	List.Register(createAlertTargets, func(app core.App) error {
+		return modules.DeleteCollections(app, "alert_targets")
+	}, "1792356237_homes_create_alert_targets")
+}
+
+// createAlertTargets creates alert_targets, the destinations
+// superusers have approved for home alerts. Only superusers can see it.
+func createAlertTargets(app core.App) error {
+	collection := core.NewBaseCollection("alert_targets")
+
+	collection.Fields.Add(&core.SelectField{
+		Name:      "delivery",
+		Required:  true,
+		MaxSelect: 1,
+		Values:    []string{"discord_channel", "discord_dm", "email", "webhook", "discord_webhook", "slack", "ntfy"},
+	})
+	collection.Fields.Add(&core.TextField{
+		Name:     "target",
+		Required: true,
+	})
+	collection.Fields.Add(&core.TextField{
+		Name: "note",
+	})
+
+	collection.Indexes = []string{
+		"CREATE UNIQUE INDEX idx_alert_targets_unique ON alert_targets (delivery, target)",
+	}
+
+	_, err := modules.EnsureCollection(app, collection)
+	return err
+}
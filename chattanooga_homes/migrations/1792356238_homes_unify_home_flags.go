@@ -0,0 +1,101 @@
+package migrations
+
+import (
+	"fmt"
+
+	"pb-backend/modules"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	// Not undone: once moved, a Discord flag can't be told apart from an
+	// entry added on the site, so there is nothing to split back out
+	List.Register(unifyHomeFlags, nil, "1792356238_homes_unify_home_flags")
+}
+
+// The user list each discord_home_flags flag moves to
+var flagCollections = map[string]string{
+	"watch":    "home_watches",
+	"favorite": "home_favorites",
+	"hidden":   "home_hidden",
+}
+
+// unifyHomeFlags moves the flags from the old discord_home_flags collection
+// into the user lists, which gain Discord users, and drops it
+func unifyHomeFlags(app core.App) error {
+	for _, name := range []string{"home_favorites", "home_hidden"} {
+		collection, err := app.FindCollectionByNameOrId(name)
+		if err != nil {
+			return err
+		}
+		// Entries from unlinked Discord accounts have no user, so the old
+		// (user, home) index would only allow one of them per listing
+		collection.RemoveIndex(fmt.Sprintf("idx_%s_unique", name))
+		if field, ok := collection.Fields.GetByName("user").(*core.RelationField); ok {
+			field.Required = false
+		}
+		collection.CreateRule = types.Pointer(userFlagCreateRule)
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+	}
+	if err := createUserHomeLists(app); err != nil {
+		return err
+	}
+
+	// Not created on installs that started with the user lists
+	if _, err := app.FindCollectionByNameOrId("discord_home_flags"); err != nil {
+		return nil
+	}
+	flags, err := app.FindRecordsByFilter("discord_home_flags", "", "created", 0, 0)
+	if err != nil {
+		return err
+	}
+	for _, flag := range flags {
+		if err := moveHomeFlag(app, flag); err != nil {
+			return fmt.Errorf("failed to move %s flag %s: %w", flag.GetString("flag"), flag.Id, err)
+		}
+	}
+	return modules.DeleteCollections(app, "discord_home_flags")
+}
+
+// moveHomeFlag adds a discord_home_flags flag to its user list, linked to
+// the site user of the Discord account, unless it is already there
+func moveHomeFlag(app core.App, flag *core.Record) error {
+	name, ok := flagCollections[flag.GetString("flag")]
+	if !ok {
+		return fmt.Errorf("unknown flag %q", flag.GetString("flag"))
+	}
+	discordID := flag.GetString("discord_user_id")
+
+	user := ""
+	auth, err := app.FindFirstExternalAuthByExpr(dbx.HashExp{"provider": "discord", "providerId": discordID})
+	if err == nil {
+		user = auth.RecordRef()
+	}
+
+	filter := "home = {:home} && discord_user_id = {:discord}"
+	params := map[string]any{"home": flag.GetString("home"), "discord": discordID}
+	if user != "" {
+		filter = "home = {:home} && (discord_user_id = {:discord} || user = {:user})"
+		params["user"] = user
+	}
+	existing, err := app.FindRecordsByFilter(name, filter, "", 1, 0, params)
+	if err != nil || len(existing) > 0 {
+		return err
+	}
+
+	collection, err := app.FindCollectionByNameOrId(name)
+	if err != nil {
+		return err
+	}
+	record := core.NewRecord(collection)
+	record.Set("home", flag.GetString("home"))
+	record.Set("user", user)
+	record.Set("discord_user_id", discordID)
+	record.Set("discord_username", flag.GetString("discord_username"))
+	return app.Save(record)
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func init() {
+	// Not undone: a no-op on new installs, and nothing reads the old field
+	List.Register(moveDiscordDefaultChannel, nil, "1792356239_homes_move_discord_default_channel")
+}
+
+// moveDiscordDefaultChannel moves the channels in homes_channel_id, the original
+// name of default_channel_id, to that field and drops the old one
+func moveDiscordDefaultChannel(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId("discord_config")
+	if err != nil {
+		return err
+	}
+	if collection.Fields.GetByName("homes_channel_id") == nil {
+		return nil
+	}
+
+	_, err = app.DB().NewQuery(
+		"UPDATE {{discord_config}} SET [[default_channel_id]] = [[homes_channel_id]] WHERE [[default_channel_id]] = ''",
+	).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to move homes_channel_id: %w", err)
+	}
+
+	collection.Fields.RemoveByName("homes_channel_id")
+	return app.Save(collection)
+}
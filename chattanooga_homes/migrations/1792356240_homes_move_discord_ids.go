@@ -0,0 +1,63 @@
+package migrations
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func init() {
+	// Not undone: discord_posts replaced the homes fields and nothing reads
+	// them. Posts are moved to the default channel, so this follows the
+	// default channel move in 1792356239.
+	List.Register(moveHomeDiscordIDs, nil, "1792356240_homes_move_discord_ids")
+}
+
+// moveHomeDiscordIDs moves the message and thread IDs that used to be
+// stored on homes records into discord_posts, as posts by the default bot
+// in its default channel, then drops the old homes fields
+func moveHomeDiscordIDs(txApp core.App) error {
+	homes, err := txApp.FindCollectionByNameOrId("homes")
+	if err != nil {
+		return err
+	}
+	if homes.Fields.GetByName("discord_message_id") == nil {
+		return nil
+	}
+	posts, err := txApp.FindCollectionByNameOrId("discord_posts")
+	if err != nil {
+		return err
+	}
+
+	records, err := txApp.FindRecordsByFilter("homes", "discord_message_id != ''", "", 0, 0)
+	if err != nil {
+		return err
+	}
+
+	if len(records) > 0 {
+		// Only the record is needed; its token may not be encrypted yet
+		config, err := txApp.FindFirstRecordByFilter("discord_config", "name = {:name}",
+			map[string]any{"name": "default"})
+		if err != nil {
+			return fmt.Errorf("can't migrate %d posted listings: %w", len(records), err)
+		}
+
+		for _, record := range records {
+			post := core.NewRecord(posts)
+			post.Set("home", record.Id)
+			post.Set("config", config.Id)
+			post.Set("channel_id", config.GetString("default_channel_id"))
+			post.Set("message_id", record.GetString("discord_message_id"))
+			post.Set("thread_id", record.GetString("discord_thread_id"))
+			if err := txApp.Save(post); err != nil {
+				return fmt.Errorf("failed to migrate discord IDs for %s: %w", record.Id, err)
+			}
+		}
+		log.Printf("[DISCORD] Migrated %d listing posts to discord_posts", len(records))
+	}
+
+	homes.Fields.RemoveByName("discord_message_id")
+	homes.Fields.RemoveByName("discord_thread_id")
+	return txApp.Save(homes)
+}
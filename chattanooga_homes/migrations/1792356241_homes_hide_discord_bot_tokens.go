@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func init() {
+	// Not undone: showing the field again would expose the bot tokens
+	List.Register(hideDiscordBotTokens, nil, "1792356241_homes_hide_discord_bot_tokens")
+}
+
+// hideDiscordBotTokens hides bot_token from API responses on collections created
+// before it was hidden. API rules are left alone so that CheckConfigAccess
+// can flag a publicly readable collection.
+func hideDiscordBotTokens(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId("discord_config")
+	if err != nil {
+		return err
+	}
+	field := collection.Fields.GetByName("bot_token")
+	if field == nil || field.GetHidden() {
+		return nil
+	}
+
+	field.SetHidden(true)
+	return app.Save(collection)
+}
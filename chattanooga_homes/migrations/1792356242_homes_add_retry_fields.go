@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"pb-backend/modules"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func init() {
+	List.Register(addHomeRetryFields, func(app core.App) error {
+		return modules.RemoveFields(app, "homes", homeRetryFields...)
+	}, "1792356242_homes_add_retry_fields")
+}
+
+// Fields the image archive and geocode jobs use to retry failed listings
+// later without holding up the rest
+var homeRetryFields = []string{"image_attempts", "image_retry_at", "geocode_attempts", "geocode_retry_at"}
+
+func addHomeRetryFields(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId("homes")
+	if err != nil {
+		return err
+	}
+	for _, prefix := range []string{"image", "geocode"} {
+		collection.Fields.Add(&core.NumberField{Name: prefix + "_attempts", OnlyInt: true})
+		collection.Fields.Add(&core.DateField{Name: prefix + "_retry_at"})
+	}
+	return app.Save(collection)
+}
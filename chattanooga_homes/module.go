@@ -0,0 +1,157 @@
+package chattanooga_homes
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"pb-backend/discord"
+	"pb-backend/jobs"
+	"pb-backend/modules"
+	"pb-backend/settings"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ModuleName is the name used for the module and its enable_ setting
+const ModuleName = "chattanooga_homes"
+
+// How often stored Discord secrets are checked against the current key
+const secretCheckInterval = 5 * time.Minute
+
+// moduleRunner runs the module's jobs once StartJobs is called. Record
+// hooks use it to wake the workers for new work.
+var moduleRunner atomic.Pointer[jobs.Runner]
+
+// wakeJob asks for an early run of a job; it does nothing until the jobs
+// are added
+func wakeJob(name string) {
+	if runner := moduleRunner.Load(); runner != nil {
+		_ = runner.Wake(name)
+	}
+}
+
+// Module is the Chattanooga homes scraper with its Discord notifications
+type Module struct {
+	scheduler *HomesScheduler
+}
+
+// NewModule creates the homes module
+func NewModule() *Module {
+	return &Module{}
+}
+
+// Name implements modules.Module
+func (m *Module) Name() string {
+	return ModuleName
+}
+
+// RegisterHooks registers the Discord and homes record hooks
+func (m *Module) RegisterHooks(app *pocketbase.PocketBase) {
+	discord.RegisterHooks(app)
+	RegisterHooks(app)
+}
+
+// StartJobs checks the Discord setup and adds the scrape, delivery and
+// maintenance jobs
+func (m *Module) StartJobs(app *pocketbase.PocketBase, runner *jobs.Runner) {
+	moduleRunner.Store(runner)
+
+	// Discord problems only disable posting, not the module
+	if _, err := discord.ReencryptSecrets(app); err != nil {
+		log.Printf("[DISCORD] ERROR: Discord posting disabled: %v", err)
+	}
+	if err := discord.CheckConfigAccess(app); err != nil {
+		log.Printf("Discord posting disabled: %v", err)
+	}
+
+	// Picks up keys rotated through DISCORD_SECRET_KEY_FILE
+	runner.MustAdd(jobs.Job{
+		Name:    "discord_secrets",
+		Every:   func() time.Duration { return secretCheckInterval },
+		Enabled: moduleEnabled,
+		Run: func(ctx context.Context) (jobs.Counts, error) {
+			reencrypted, err := discord.ReencryptSecrets(app)
+			return jobs.Counts{"reencrypted": reencrypted}, err
+		},
+	})
+
+	NewNotificationWorker(app).AddJobs(runner)
+	NewDigestWorker(app).AddJobs(runner)
+	if geocoder, err := NewGeocoderFromEnv(); err != nil {
+		log.Printf("Geocoding disabled: %v", err)
+	} else if geocoder != nil {
+		NewGeocodeWorker(app, geocoder).AddJobs(runner)
+	}
+	NewImageArchiver(app, os.Getenv("ARCHIVE_ALL_PHOTOS") == "true").AddJobs(runner)
+	addBulkUpdateJobs(app, runner)
+
+	m.scheduler = NewHomesScheduler(app)
+	m.scheduler.AddJobs(runner)
+
+	go func() {
+		if err := RegisterDiscordCommands(app); err != nil {
+			log.Printf("Error registering discord commands: %v", err)
+		}
+	}()
+}
+
+func moduleEnabled() bool {
+	return settings.Current().ModuleEnabled(ModuleName)
+}
+
+// RegisterRoutes registers the Discord interactions, which drive the
+// scheduler StartJobs created, and the homes API
+func (m *Module) RegisterRoutes(app *pocketbase.PocketBase, se *core.ServeEvent) {
+	RegisterDiscordInteractions(app, se, m.scheduler)
+	RegisterAnalyticsRoutes(se)
+	RegisterGeoJSONRoute(se)
+	RegisterHistoryRoute(se)
+	RegisterHomesListRoute(se)
+	RegisterExportRoutes(se)
+}
+
+// Health is degraded while any listing source keeps failing, and down when
+// all of them are
+func (m *Module) Health(app *pocketbase.PocketBase) modules.Health {
+	sources, err := GetScraperHealth(app)
+	if err != nil {
+		return modules.Health{Status: modules.StatusDown, Details: map[string]any{"error": err.Error()}}
+	}
+
+	failing := 0
+	perSource := map[string]any{}
+	for _, source := range sources {
+		if source.ConsecutiveFailures >= scraperAlertThreshold {
+			failing++
+		}
+		entry := map[string]any{
+			"consecutive_failures": source.ConsecutiveFailures,
+			"last_listing_count":   source.LastListingCount,
+			"last_error":           source.LastError,
+		}
+		if !source.LastSuccess.IsZero() {
+			entry["last_success"] = source.LastSuccess
+		}
+		perSource[source.Source] = entry
+	}
+	details := map[string]any{"sources": perSource}
+	if homes, err := app.CountRecords("homes"); err == nil {
+		details["homes"] = homes
+	}
+	if outbox, err := OutboxStats(app); err == nil {
+		details["outbox"] = outbox
+	}
+
+	status := modules.StatusOK
+	switch {
+	case len(sources) > 0 && failing == len(sources):
+		status = modules.StatusDown
+	case failing > 0:
+		status = modules.StatusDegraded
+	}
+	return modules.Health{Status: status, Details: details}
+}
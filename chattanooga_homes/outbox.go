@@ -0,0 +1,394 @@
+package chattanooga_homes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"pb-backend/discord"
+	"pb-backend/jobs"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Outbox item kinds
+const (
+	OutboxHomePost    = "home_post"
+	OutboxHomeUpdate  = "home_update"
+	OutboxHomeRefresh = "home_refresh"
+	OutboxHomeAlert   = "home_alert"
+	OutboxHomeWatch   = "home_watch"
+)
+
+// Outbox item statuses
+const (
+	OutboxPending    = "pending"
+	OutboxProcessing = "processing"
+	OutboxSent       = "sent"
+	OutboxDead       = "dead"
+)
+
+const (
+	outboxJob           = "homes_outbox"
+	outboxCleanupJob    = "homes_outbox_cleanup"
+	outboxPollInterval  = 10 * time.Second
+	outboxBatchSize     = 50
+	maxOutboxAttempts   = 8
+	outboxBaseBackoff   = 30 * time.Second
+	outboxMaxBackoff    = 1 * time.Hour
+	outboxDateFormat    = "2006-01-02 15:04:05.000Z"
+	outboxEventCreated  = "created"
+	outboxEventUpdated  = "updated"
+	outboxErrorMaxBytes = 2000
+
+	// Sent and dead items are deleted after this long. Dead items are kept
+	// a while so failed deliveries can be looked into.
+	outboxRetention = 30 * 24 * time.Hour
+)
+
+// outboxPayload is the JSON stored with each outbox item
+type outboxPayload struct {
+	Event   string        `json:"event"`
+	Changes []FieldChange `json:"changes,omitempty"`
+	// Delivered lists the discord_posts whose thread already got an update,
+	// so retries skip them
+	Delivered []string `json:"delivered,omitempty"`
+}
+
+// enqueueNotification adds an item to the outbox. Call it with the
+// transaction app so the item commits or rolls back with the listing change.
+// target is the alert ID for alert items and the Discord user ID for watch items.
+func enqueueNotification(txApp core.App, kind, homeID, target string, payload outboxPayload) error {
+	collection, err := txApp.FindCollectionByNameOrId("notification_outbox")
+	if err != nil {
+		return fmt.Errorf("failed to find notification_outbox collection: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("kind", kind)
+	record.Set("home", homeID)
+	switch kind {
+	case OutboxHomeAlert:
+		record.Set("alert", target)
+	case OutboxHomeWatch:
+		record.Set("watcher", target)
+	}
+	record.Set("payload", payload)
+	record.Set("status", OutboxPending)
+	record.Set("attempts", 0)
+	record.Set("next_attempt_at", time.Now().UTC())
+
+	return txApp.Save(record)
+}
+
+// enqueueHomeNotifications queues the channel post (or thread update) for a
+// listing change, a DM per Discord watcher on updates and one delivery per
+// matching home alert
+func enqueueHomeNotifications(txApp core.App, record *core.Record, changes []FieldChange) error {
+	payload := outboxPayload{Event: outboxEventCreated}
+	kind := OutboxHomePost
+	if changes != nil {
+		payload = outboxPayload{Event: outboxEventUpdated, Changes: changes}
+		kind = OutboxHomeUpdate
+	}
+
+	if err := enqueueNotification(txApp, kind, record.Id, "", payload); err != nil {
+		return err
+	}
+
+	// Keep the original post's embed in sync with the listing
+	if changes != nil {
+		if err := enqueueNotification(txApp, OutboxHomeRefresh, record.Id, "", payload); err != nil {
+			return err
+		}
+
+		watchers, err := discordHomeWatchers(txApp, record.Id)
+		if err != nil {
+			log.Printf("[OUTBOX] Error loading watchers: %v", err)
+		}
+		for _, userID := range watchers {
+			if err := enqueueNotification(txApp, OutboxHomeWatch, record.Id, userID, payload); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Alerts are optional; a problem loading them shouldn't block the listing save
+	alerts, err := LoadHomeAlerts(txApp)
+	if err != nil {
+		log.Printf("[OUTBOX] Error loading alerts: %v", err)
+		return nil
+	}
+	for _, alert := range alerts {
+		if !alert.Matches(record) {
+			continue
+		}
+		if err := enqueueNotification(txApp, OutboxHomeAlert, record.Id, alert.ID, payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NotificationWorker delivers outbox items with retries and dead-lettering
+type NotificationWorker struct {
+	app *pocketbase.PocketBase
+}
+
+// NewNotificationWorker creates a new worker
+func NewNotificationWorker(app *pocketbase.PocketBase) *NotificationWorker {
+	return &NotificationWorker{app: app}
+}
+
+// AddJobs requeues items left in flight by a previous run and registers
+// the delivery and cleanup jobs. Listing hooks wake the delivery job when
+// they queue items, so notifications go out immediately instead of on the
+// next poll.
+func (w *NotificationWorker) AddJobs(runner *jobs.Runner) {
+	w.requeueInFlight()
+	runner.MustAdd(jobs.Job{
+		Name:       outboxJob,
+		Every:      func() time.Duration { return outboxPollInterval },
+		RunAtStart: true,
+		Enabled:    moduleEnabled,
+		Run:        w.processDue,
+	})
+	runner.MustAdd(jobs.Job{
+		Name:     outboxCleanupJob,
+		Schedule: "40 * * * *",
+		Enabled:  moduleEnabled,
+		Run:      w.pruneSettled,
+	})
+}
+
+// pruneSettled deletes sent and dead items past the retention period.
+// Items settle within hours of being queued, so their creation time is
+// used for both. It deletes with one statement, skipping record hooks,
+// since outbox items have no files or dependents.
+func (w *NotificationWorker) pruneSettled(ctx context.Context) (jobs.Counts, error) {
+	cutoff := time.Now().UTC().Add(-outboxRetention).Format(outboxDateFormat)
+	result, err := w.app.DB().
+		NewQuery("DELETE FROM notification_outbox WHERE status IN ({:sent}, {:dead}) AND created < {:cutoff}").
+		Bind(map[string]any{"sent": OutboxSent, "dead": OutboxDead, "cutoff": cutoff}).
+		WithContext(ctx).
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, _ := result.RowsAffected()
+	return jobs.Counts{"deleted": int(deleted)}, nil
+}
+
+// requeueInFlight resets items that were being delivered when the process
+// stopped. They may have been delivered already, but retrying is the only
+// way not to lose them.
+func (w *NotificationWorker) requeueInFlight() {
+	records, err := w.app.FindRecordsByFilter("notification_outbox", "status = {:status}", "", 0, 0,
+		map[string]any{"status": OutboxProcessing})
+	if err != nil {
+		log.Printf("[OUTBOX] Error finding in-flight items: %v", err)
+		return
+	}
+
+	for _, record := range records {
+		record.Set("status", OutboxPending)
+		if err := w.app.Save(record); err != nil {
+			log.Printf("[OUTBOX] Error requeueing %s: %v", record.Id, err)
+		}
+	}
+	if len(records) > 0 {
+		log.Printf("[OUTBOX] Requeued %d in-flight items", len(records))
+	}
+}
+
+// processDue delivers every due item in the order it was queued, stopping
+// between items once ctx is done
+func (w *NotificationWorker) processDue(ctx context.Context) (jobs.Counts, error) {
+	counts := jobs.Counts{"sent": 0, "failed": 0}
+	for {
+		records, err := w.app.FindRecordsByFilter(
+			"notification_outbox",
+			"status = {:status} && next_attempt_at <= {:now}",
+			"created",
+			outboxBatchSize,
+			0,
+			map[string]any{"status": OutboxPending, "now": time.Now().UTC().Format(outboxDateFormat)},
+		)
+		if err != nil {
+			return counts, fmt.Errorf("finding due items: %w", err)
+		}
+
+		for _, record := range records {
+			if err := ctx.Err(); err != nil {
+				return counts, err
+			}
+			if w.process(record) {
+				counts["sent"]++
+			} else {
+				counts["failed"]++
+			}
+		}
+
+		if len(records) < outboxBatchSize {
+			return counts, nil
+		}
+	}
+}
+
+// process delivers an item and reports whether it was sent
+func (w *NotificationWorker) process(item *core.Record) bool {
+	item.Set("status", OutboxProcessing)
+	if err := w.app.Save(item); err != nil {
+		log.Printf("[OUTBOX] Error claiming %s: %v", item.Id, err)
+		return false
+	}
+
+	err := w.deliver(item)
+	if err == nil {
+		item.Set("status", OutboxSent)
+		item.Set("sent_at", time.Now().UTC())
+		item.Set("last_error", "")
+		if err := w.app.Save(item); err != nil {
+			log.Printf("[OUTBOX] Error marking %s sent: %v", item.Id, err)
+		}
+		return true
+	}
+
+	w.fail(item, err)
+	return false
+}
+
+// fail schedules a retry, or dead-letters the item once it runs out of attempts.
+// Rate limits are retried after Discord's retry_after without using an attempt.
+func (w *NotificationWorker) fail(item *core.Record, deliverErr error) {
+	now := time.Now().UTC()
+	message := deliverErr.Error()
+	if len(message) > outboxErrorMaxBytes {
+		message = message[:outboxErrorMaxBytes]
+	}
+	item.Set("last_error", message)
+
+	var rateLimitErr *discord.RateLimitError
+	if errors.As(deliverErr, &rateLimitErr) {
+		item.Set("status", OutboxPending)
+		item.Set("next_attempt_at", now.Add(rateLimitErr.RetryAfter))
+		log.Printf("[OUTBOX] %s %s rate limited, retrying in %v", item.GetString("kind"), item.Id, rateLimitErr.RetryAfter)
+	} else {
+		attempts := item.GetInt("attempts") + 1
+		item.Set("attempts", attempts)
+
+		if attempts >= maxOutboxAttempts {
+			item.Set("status", OutboxDead)
+			log.Printf("[OUTBOX] %s %s dead-lettered after %d attempts: %v", item.GetString("kind"), item.Id, attempts, deliverErr)
+		} else {
+			backoff := outboxBaseBackoff << (attempts - 1)
+			if backoff > outboxMaxBackoff {
+				backoff = outboxMaxBackoff
+			}
+			item.Set("status", OutboxPending)
+			item.Set("next_attempt_at", now.Add(backoff))
+			log.Printf("[OUTBOX] %s %s failed (attempt %d/%d), retrying in %v: %v", item.GetString("kind"), item.Id, attempts, maxOutboxAttempts, backoff, deliverErr)
+		}
+	}
+
+	if err := w.app.Save(item); err != nil {
+		log.Printf("[OUTBOX] Error saving %s: %v", item.Id, err)
+	}
+}
+
+// deliver sends a single outbox item
+func (w *NotificationWorker) deliver(item *core.Record) error {
+	home, err := w.app.FindRecordById("homes", item.GetString("home"))
+	if err != nil {
+		return fmt.Errorf("failed to load home: %w", err)
+	}
+
+	var payload outboxPayload
+	if err := item.UnmarshalJSONField("payload", &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	switch item.GetString("kind") {
+	case OutboxHomePost:
+		posted, err := PostHomeToDiscord(w.app, home)
+		if err != nil {
+			return err
+		}
+		log.Printf("[DISCORD] Posted new listing %s to %d channels", home.GetString("street"), posted)
+		return nil
+
+	case OutboxHomeUpdate:
+		delivered := make(map[string]bool, len(payload.Delivered))
+		for _, postID := range payload.Delivered {
+			delivered[postID] = true
+		}
+		if err := PostUpdateToDiscordThread(w.app, home, payload.Changes, delivered); err != nil {
+			// Saved with the retry, so only the failed threads are retried
+			payload.Delivered = slices.Sorted(maps.Keys(delivered))
+			item.Set("payload", payload)
+			return err
+		}
+		log.Printf("[DISCORD] Posted update to thread for: %s", home.GetString("street"))
+		return nil
+
+	case OutboxHomeRefresh:
+		if err := RefreshHomeDiscordMessage(w.app, home); err != nil {
+			return err
+		}
+		log.Printf("[DISCORD] Refreshed listing message for: %s", home.GetString("street"))
+		return nil
+
+	case OutboxHomeWatch:
+		if err := sendWatchDM(w.app, item.GetString("watcher"), home, payload.Changes); err != nil {
+			return err
+		}
+		log.Printf("[DISCORD] Sent watch update for %s to %s", home.GetString("street"), item.GetString("watcher"))
+		return nil
+
+	case OutboxHomeAlert:
+		alertRecord, err := w.app.FindRecordById("home_alerts", item.GetString("alert"))
+		if err != nil {
+			return fmt.Errorf("failed to load alert: %w", err)
+		}
+		alert := homeAlertFromRecord(alertRecord)
+
+		var changes []FieldChange
+		if payload.Event == outboxEventUpdated {
+			changes = payload.Changes
+		}
+		if err := deliverHomeAlert(w.app, alert, home, changes); err != nil {
+			return err
+		}
+		log.Printf("[ALERTS] Delivered alert %s (%s) for %s", alert.ID, alert.Delivery, home.GetString("street"))
+		return nil
+	}
+
+	return fmt.Errorf("unknown outbox kind %q", item.GetString("kind"))
+}
+
+// OutboxStats counts outbox items by status
+func OutboxStats(app core.App) (map[string]int, error) {
+	var rows []struct {
+		Status string `db:"status"`
+		Count  int    `db:"count"`
+	}
+	err := app.DB().
+		NewQuery("SELECT status, COUNT(*) AS count FROM notification_outbox GROUP BY status").
+		All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]int, len(rows))
+	for _, row := range rows {
+		stats[row.Status] = row.Count
+	}
+	return stats, nil
+}
@@ -0,0 +1,64 @@
+package chattanooga_homes
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPruneSettledOutbox(t *testing.T) {
+	app := newHomesTestApp(t)
+	if _, err := SaveHomes(app, []Home{{ListingID: "A1", Street: "10 Main St", City: "Chattanooga", Price: 250000}}); err != nil {
+		t.Fatal(err)
+	}
+	home, err := app.FindFirstRecordByFilter("homes", "listing_id = 'A1'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().UTC().Add(-outboxRetention - time.Hour).Format(outboxDateFormat)
+	recent := time.Now().UTC().Add(-time.Hour).Format(outboxDateFormat)
+	items := []struct {
+		status  string
+		created string
+		kept    bool
+	}{
+		{OutboxSent, old, false},
+		{OutboxDead, old, false},
+		{OutboxPending, old, true},
+		{OutboxProcessing, old, true},
+		{OutboxSent, recent, true},
+		{OutboxDead, recent, true},
+	}
+	for _, item := range items {
+		if err := enqueueNotification(app, OutboxHomePost, home.Id, "", outboxPayload{}); err != nil {
+			t.Fatal(err)
+		}
+		_, err := app.DB().
+			NewQuery("UPDATE notification_outbox SET status = {:status}, created = {:created} WHERE status = {:pending} AND created > {:recent}").
+			Bind(map[string]any{"status": item.status, "created": item.created, "pending": OutboxPending, "recent": recent}).
+			Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counts, err := NewNotificationWorker(app).pruneSettled(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["deleted"] != 2 {
+		t.Errorf("Expected 2 items deleted, got %d", counts["deleted"])
+	}
+
+	for _, item := range items {
+		records, err := app.FindRecordsByFilter("notification_outbox", "status = {:status} && created = {:created}", "", 0, 0,
+			map[string]any{"status": item.status, "created": item.created})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kept := len(records) > 0; kept != item.kept {
+			t.Errorf("%s item created %s: expected kept %v, got %v", item.status, item.created, item.kept, kept)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package chattanooga_homes
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// listingURLBase is the public detail page for a single listing key
+	listingURLBase = "https://my.flexmls.com/greaterchattanooganew/search/idx_links/20240916004638701725000000/listings/"
+)
+
+// FieldError describes a single field that could not be extracted from a listing card
+type FieldError struct {
+	ListingID string
+	Field     string
+	Reason    string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("listing %s: %s: %s", e.ListingID, e.Field, e.Reason)
+}
+
+// ParseResult holds the listings parsed from a search results page along with
+// any per-field extraction failures
+type ParseResult struct {
+	Homes       []Home
+	FieldErrors []FieldError
+}
+
+// FailureCounts returns the number of extraction failures per field
+func (r *ParseResult) FailureCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, fe := range r.FieldErrors {
+		counts[fe.Field]++
+	}
+	return counts
+}
+
+// Summary returns a short, stable description of the failures for logging
+func (r *ParseResult) Summary() string {
+	counts := r.FailureCounts()
+	if len(counts) == 0 {
+		return "no field errors"
+	}
+
+	fields := make([]string, 0, len(counts))
+	for field := range counts {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, fmt.Sprintf("%s=%d", field, counts[field]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ParseListingsHTML parses a FlexMLS search results page using the DOM rather
+// than regular expressions, so attribute order and whitespace changes don't
+// silently drop listings.
+func ParseListingsHTML(r io.Reader) (*ParseResult, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	result := &ParseResult{}
+	for _, card := range findAll(doc, isSummaryCard) {
+		home, fieldErrs := parseSummaryCard(card)
+		result.FieldErrors = append(result.FieldErrors, fieldErrs...)
+		if home.ListingID == "" {
+			continue
+		}
+		result.Homes = append(result.Homes, home)
+	}
+
+	return result, nil
+}
+
+// parseSummaryCard extracts a Home from a single summary-card element
+func parseSummaryCard(card *html.Node) (Home, []FieldError) {
+	var errs []FieldError
+
+	home := Home{
+		ListingID: strings.TrimSpace(attr(card, "id")),
+		Status:    strings.TrimSpace(attr(card, "data-standard-status")),
+	}
+
+	fail := func(field, reason string) {
+		errs = append(errs, FieldError{ListingID: home.ListingID, Field: field, Reason: reason})
+	}
+
+	if home.ListingID == "" {
+		fail("listing_id", "missing id attribute")
+		return home, errs
+	}
+	if home.Status == "" {
+		fail("status", "missing data-standard-status attribute")
+	}
+
+	// Price
+	if priceStr := strings.TrimSpace(attr(card, "data-current-price")); priceStr == "" {
+		fail("price", "missing data-current-price attribute")
+	} else if price, err := strconv.ParseFloat(priceStr, 64); err != nil {
+		fail("price", fmt.Sprintf("invalid value %q", priceStr))
+	} else {
+		home.Price = int(price)
+	}
+
+	// Street address (line-one)
+	if n := findFirst(card, hasClass("line-one")); n != nil {
+		home.Street = textContent(n)
+	}
+	if home.Street == "" {
+		fail("street", "missing line-one")
+	}
+
+	// City, state, zip (line-two) in "City, TN 37308" format
+	if n := findFirst(card, hasClass("line-two")); n != nil {
+		home.City, home.State, home.Zip = splitCityStateZip(textContent(n))
+	}
+	if home.City == "" {
+		fail("city", "missing line-two")
+	}
+
+	// Title/value data rows
+	rows := dataRows(card)
+
+	textField := func(title string, dst *string) {
+		if v, ok := rows[title]; ok && v != "" {
+			*dst = v
+			return
+		}
+		fail(title, "missing data row")
+	}
+	intField := func(title string, dst *int) {
+		v, ok := rows[title]
+		if !ok || v == "" {
+			fail(title, "missing data row")
+			return
+		}
+		n, err := strconv.Atoi(strings.ReplaceAll(v, ",", ""))
+		if err != nil {
+			fail(title, fmt.Sprintf("invalid value %q", v))
+			return
+		}
+		*dst = n
+	}
+	floatField := func(title string, dst *float64) {
+		v, ok := rows[title]
+		if !ok || v == "" {
+			fail(title, "missing data row")
+			return
+		}
+		f, err := strconv.ParseFloat(strings.ReplaceAll(v, ",", ""), 64)
+		if err != nil {
+			fail(title, fmt.Sprintf("invalid value %q", v))
+			return
+		}
+		*dst = f
+	}
+
+	textField("Sub Type", &home.SubType)
+	textField("County", &home.County)
+	textField("Area", &home.Area)
+	textField("Subdivision", &home.Subdivision)
+	intField("Living Area", &home.LivingArea)
+	intField("Beds Total", &home.BedsTotal)
+	floatField("Baths Total", &home.BathsTotal)
+	floatField("Acres", &home.Acres)
+	intField("Year Built", &home.YearBuilt)
+
+	// Remarks are optional; most search result cards don't include them
+	if v := rows["Public Remarks"]; v != "" {
+		home.Description = v
+	} else if n := findFirst(card, hasClass("remarks")); n != nil {
+		home.Description = textContent(n)
+	}
+
+	// Listing photos; the first is the main listing image. FlexMLS lazy-loads
+	// via data-src, so prefer it over src.
+	for _, img := range findAll(card, isElement("img")) {
+		src := attr(img, "data-src")
+		if !strings.Contains(src, "sparkplatform") {
+			src = attr(img, "src")
+		}
+		if !strings.Contains(src, "sparkplatform") {
+			continue
+		}
+		if strings.HasPrefix(src, "//") {
+			src = "https:" + src
+		}
+		if home.ImageURL == "" {
+			home.ImageURL = src
+		}
+		if !slices.Contains(home.PhotoURLs, src) {
+			home.PhotoURLs = append(home.PhotoURLs, src)
+		}
+	}
+	if home.ImageURL == "" {
+		fail("image_url", "no sparkplatform image")
+	}
+
+	home.URL = listingURLBase + home.ListingID
+
+	return home, errs
+}
+
+// dataRows collects title/value pairs from the card. Each row is a
+// div.title followed by a sibling div.value; the value's title attribute
+// carries the untruncated text, so prefer it over the element's text.
+func dataRows(card *html.Node) map[string]string {
+	rows := make(map[string]string)
+	for _, titleNode := range findAll(card, hasClass("title")) {
+		title := textContent(titleNode)
+		if title == "" {
+			continue
+		}
+		valueNode := nextElementSibling(titleNode)
+		if valueNode == nil || !hasClass("value")(valueNode) {
+			continue
+		}
+		value := strings.TrimSpace(attr(valueNode, "title"))
+		if value == "" {
+			value = textContent(valueNode)
+		}
+		if _, exists := rows[title]; !exists {
+			rows[title] = value
+		}
+	}
+	return rows
+}
+
+// splitCityStateZip splits "City, TN 37308" into its parts
+func splitCityStateZip(s string) (city, state, zip string) {
+	parts := strings.SplitN(strings.TrimSpace(s), ",", 2)
+	city = strings.TrimSpace(parts[0])
+	if len(parts) < 2 {
+		return city, "", ""
+	}
+	stateZip := strings.Fields(parts[1])
+	if len(stateZip) >= 1 {
+		state = stateZip[0]
+	}
+	if len(stateZip) >= 2 {
+		zip = stateZip[1]
+	}
+	return city, state, zip
+}
+
+// isSummaryCard matches listing cards: <div id="..." data-standard-status="..." class="summary-card ...">
+func isSummaryCard(n *html.Node) bool {
+	return hasClass("summary-card")(n) && hasAttr(n, "data-standard-status")
+}
+
+func isElement(tag string) func(*html.Node) bool {
+	return func(n *html.Node) bool {
+		return n.Type == html.ElementNode && n.Data == tag
+	}
+}
+
+func hasClass(class string) func(*html.Node) bool {
+	return func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return false
+		}
+		for _, c := range strings.Fields(attr(n, "class")) {
+			if c == class {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// findAll returns every descendant of root matching the predicate, in document order.
+// Matches are not descended into, so nested cards are never double counted.
+func findAll(root *html.Node, match func(*html.Node) bool) []*html.Node {
+	var found []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if match(c) {
+				found = append(found, c)
+				continue
+			}
+			walk(c)
+		}
+	}
+	walk(root)
+	return found
+}
+
+func findFirst(root *html.Node, match func(*html.Node) bool) *html.Node {
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if match(c) {
+			return c
+		}
+		if n := findFirst(c, match); n != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+func nextElementSibling(n *html.Node) *html.Node {
+	for s := n.NextSibling; s != nil; s = s.NextSibling {
+		if s.Type == html.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
+// textContent returns the whitespace-collapsed text of a node and its descendants
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
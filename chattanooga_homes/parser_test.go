@@ -0,0 +1,121 @@
+package chattanooga_homes
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseListingsHTMLGolden(t *testing.T) {
+	f, err := os.Open("testdata/search_results.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	result, err := ParseListingsHTML(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedHomes := []Home{
+		{
+			ListingID:   "20250812150312345678000000",
+			Street:      "1234 Lookout Ridge Rd",
+			City:        "Signal Mountain",
+			State:       "TN",
+			Zip:         "37377",
+			Price:       489900,
+			SubType:     "Single Family Residence",
+			County:      "Hamilton",
+			Area:        "Signal Mountain",
+			Subdivision: "Lookout Ridge Estates Phase II",
+			LivingArea:  2450,
+			BedsTotal:   4,
+			BathsTotal:  2.5,
+			Acres:       5.12,
+			YearBuilt:   1998,
+			URL:         listingURLBase + "20250812150312345678000000",
+			ImageURL:    "https://cdn.photos.sparkplatform.com/chat/20250812150312345678000000-o.jpg",
+			PhotoURLs:   []string{"https://cdn.photos.sparkplatform.com/chat/20250812150312345678000000-o.jpg"},
+			Status:      "Active",
+			Description: "Updated kitchen, wraparound porch and mountain views on a wooded lot with a creek.",
+		},
+		{
+			ListingID:  "20250801093000111222000000",
+			Street:     "88 Sequatchie Valley Hwy",
+			City:       "Dunlap",
+			State:      "TN",
+			Zip:        "37327",
+			Price:      315000,
+			SubType:    "Single Family Residence",
+			County:     "Sequatchie",
+			Area:       "Sequatchie County",
+			LivingArea: 1680,
+			BedsTotal:  3,
+			BathsTotal: 2,
+			Acres:      12.4,
+			YearBuilt:  2006,
+			URL:        listingURLBase + "20250801093000111222000000",
+			ImageURL:   "https://cdn.photos.sparkplatform.com/chat/20250801093000111222000000-o.jpg",
+			PhotoURLs:  []string{"https://cdn.photos.sparkplatform.com/chat/20250801093000111222000000-o.jpg"},
+			Status:     "Pending",
+		},
+	}
+	if len(result.Homes) != len(expectedHomes) {
+		t.Fatalf("Expected %d homes, got %d", len(expectedHomes), len(result.Homes))
+	}
+	for i, expected := range expectedHomes {
+		if !reflect.DeepEqual(result.Homes[i], expected) {
+			t.Errorf("Home %d:\nexpected %+v\n     got %+v", i, expected, result.Homes[i])
+		}
+	}
+
+	expectedErrors := []FieldError{
+		{ListingID: "20250801093000111222000000", Field: "Subdivision", Reason: "missing data row"},
+	}
+	if !reflect.DeepEqual(result.FieldErrors, expectedErrors) {
+		t.Errorf("Expected field errors %v, got %v", expectedErrors, result.FieldErrors)
+	}
+	if summary := result.Summary(); summary != "Subdivision=1" {
+		t.Errorf("Expected summary %q, got %q", "Subdivision=1", summary)
+	}
+}
+
+func TestParseListingsHTMLFieldErrors(t *testing.T) {
+	page := `<div id="1" data-standard-status="Active" data-current-price="abc" class="summary-card">
+		<div class="title">Beds Total</div><div class="value">three</div>
+	</div>
+	<div data-standard-status="Active" class="summary-card"></div>`
+
+	result, err := ParseListingsHTML(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Homes) != 1 {
+		t.Fatalf("Expected the card without an id to be dropped, got %d homes", len(result.Homes))
+	}
+
+	counts := result.FailureCounts()
+	for field, reason := range map[string]string{
+		"price":      `invalid value "abc"`,
+		"Beds Total": `invalid value "three"`,
+		"street":     "missing line-one",
+		"image_url":  "no sparkplatform image",
+		"listing_id": "missing id attribute",
+	} {
+		if counts[field] != 1 {
+			t.Errorf("Expected one %s error, got %d", field, counts[field])
+		}
+		found := false
+		for _, fe := range result.FieldErrors {
+			if fe.Field == field && fe.Reason == reason {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected %s error %q in %v", field, reason, result.FieldErrors)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package chattanooga_homes
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// A listing that has not been seen for this long can be succeeded by a
+	// relist. Shorter gaps are usually a source skipping a scrape.
+	relistMinGap = 6 * time.Hour
+
+	// Fuzzy match thresholds
+	relistStreetSimilarity = 0.85
+	relistAcresTolerance   = 0.05 // fraction
+	relistAcresSlack       = 0.1  // acres
+	relistAreaTolerance    = 0.05 // fraction
+	relistAreaSlack        = 50   // square feet
+)
+
+// statusRelisted is the status given to a listing once a relist succeeds it
+const statusRelisted = "Relisted"
+
+// findRelistPredecessor looks for an earlier listing of the same property
+// that a new listing ID is relisting: an exact address match, or a fuzzy
+// match on street, zip, acres and living area. Only unsold listings that
+// are off the market or have not been seen for relistMinGap qualify, and
+// never one that is still in the current batch.
+func findRelistPredecessor(app core.App, home Home, batch map[string]bool, now time.Time) (*core.Record, error) {
+	zip := zip5(home.Zip)
+	if NormalizeStreet(home.Street) == "" || zip == "" {
+		return nil, nil
+	}
+
+	candidates, err := app.FindRecordsByFilter("homes", "zip ~ {:zip} && listing_id != {:id} && status != {:relisted}",
+		"-first_seen", 0, 0, map[string]any{"zip": zip, "id": home.ListingID, "relisted": statusRelisted})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range candidates {
+		if batch[candidate.GetString("listing_id")] || zip5(candidate.GetString("zip")) != zip {
+			continue
+		}
+		// A sold house coming back is a resale, not a relist
+		category := statusCategory(candidate.GetString("status"))
+		if category == statusSold {
+			continue
+		}
+		lastSeen := candidate.GetDateTime("last_seen").Time()
+		if category != statusOffMarket && now.Sub(lastSeen) < relistMinGap {
+			continue
+		}
+		if sameProperty(home, candidate) {
+			return candidate, nil
+		}
+	}
+	return nil, nil
+}
+
+// sameProperty reports whether a scraped listing and a stored one describe
+// the same house. House numbers must match exactly; street names may differ
+// slightly. Acres and living area must agree when both sides have them.
+func sameProperty(home Home, record *core.Record) bool {
+	a := NormalizeStreet(home.Street)
+	b := NormalizeStreet(record.GetString("street"))
+	if a == b {
+		return true
+	}
+
+	numberA, nameA, _ := strings.Cut(a, " ")
+	numberB, nameB, _ := strings.Cut(b, " ")
+	if numberA != numberB || similarity(nameA, nameB) < relistStreetSimilarity {
+		return false
+	}
+
+	acresKnown := home.Acres > 0 && record.GetFloat("acres") > 0
+	if acresKnown && !within(home.Acres, record.GetFloat("acres"), relistAcresTolerance, relistAcresSlack) {
+		return false
+	}
+	areaKnown := home.LivingArea > 0 && record.GetInt("living_area") > 0
+	if areaKnown && !within(float64(home.LivingArea), record.GetFloat("living_area"), relistAreaTolerance, relistAreaSlack) {
+		return false
+	}
+
+	// A fuzzy street match needs some corroboration
+	return acresKnown || areaKnown
+}
+
+// linkRelist marks a new listing as the relist of its predecessor, carrying
+// over the original listing date so days on market don't reset
+func linkRelist(record, predecessor *core.Record) {
+	record.Set("relisted_from", predecessor.Id)
+	record.Set("relisted_price", predecessor.GetInt("price"))
+	record.Set("relisted_days", int(math.Round(daysBetween(listedSince(predecessor), predecessor.GetDateTime("last_seen").Time()))))
+	record.Set("original_first_seen", listedSince(predecessor))
+}
+
+// listedSince returns when a property was first listed, following relists
+func listedSince(record *core.Record) time.Time {
+	if original := record.GetDateTime("original_first_seen"); !original.IsZero() {
+		return original.Time()
+	}
+	return record.GetDateTime("first_seen").Time()
+}
+
+// relistNote describes a relisted listing, or returns "" for others
+func relistNote(record *core.Record) string {
+	if record.GetString("relisted_from") == "" {
+		return ""
+	}
+	return fmt.Sprintf("🔁 Relisted (previously $%s, %d days)",
+		formatNumber(record.GetInt("relisted_price")), record.GetInt("relisted_days"))
+}
+
+// HomeLineage returns a listing and the listings it relisted, oldest first
+func HomeLineage(app core.App, record *core.Record) []*core.Record {
+	lineage := []*core.Record{record}
+	seen := map[string]bool{record.Id: true}
+	for current := record; current.GetString("relisted_from") != ""; {
+		previous, err := app.FindRecordById("homes", current.GetString("relisted_from"))
+		if err != nil || seen[previous.Id] {
+			break
+		}
+		seen[previous.Id] = true
+		lineage = append([]*core.Record{previous}, lineage...)
+		current = previous
+	}
+	return lineage
+}
+
+// HomeHistory returns the history of a listing including the listings it
+// relisted, oldest first
+func HomeHistory(app core.App, record *core.Record) ([]*core.Record, error) {
+	var ids []string
+	for _, home := range HomeLineage(app, record) {
+		ids = append(ids, home.Id)
+	}
+	filter, params := anyOf("home", ids)
+	return app.FindRecordsByFilter("home_history", filter, "created", 0, 0, params)
+}
+
+// RegisterHistoryRoute mounts the listing history endpoint, which includes
+// the history of listings it relisted:
+//
+//	GET /api/homes/{id}/history
+func RegisterHistoryRoute(se *core.ServeEvent) {
+	se.Router.GET("/api/homes/{id}/history", func(e *core.RequestEvent) error {
+		record, err := e.App.FindRecordById("homes", e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "listing not found"})
+		}
+
+		entries, err := HomeHistory(e.App, record)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+
+		lineage := HomeLineage(e.App, record)
+		listings := make([]map[string]any, 0, len(lineage))
+		for _, home := range lineage {
+			listings = append(listings, map[string]any{
+				"id":         home.Id,
+				"listing_id": home.GetString("listing_id"),
+				"price":      home.GetInt("price"),
+				"status":     home.GetString("status"),
+				"first_seen": home.GetDateTime("first_seen"),
+				"last_seen":  home.GetDateTime("last_seen"),
+			})
+		}
+
+		return e.JSON(http.StatusOK, map[string]any{
+			"listings":     listings,
+			"listed_since": listedSince(record),
+			"history":      entries,
+		})
+	}).Bind(apis.RequireAuth())
+}
+
+// similarity returns 1 minus the normalized Levenshtein distance
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
+
+// within reports whether a and b differ by at most the larger of a
+// fraction of the larger value or an absolute slack
+func within(a, b, fraction, slack float64) bool {
+	return math.Abs(a-b) <= math.Max(fraction*math.Max(a, b), slack)
+}
+
+func zip5(zip string) string {
+	zip = strings.TrimSpace(zip)
+	if len(zip) > 5 {
+		zip = zip[:5]
+	}
+	return zip
+}
@@ -0,0 +1,57 @@
+package chattanooga_homes
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestSameProperty(t *testing.T) {
+	collection := core.NewBaseCollection("homes")
+	collection.Fields.Add(
+		&core.TextField{Name: "street"},
+		&core.NumberField{Name: "acres"},
+		&core.NumberField{Name: "living_area"},
+	)
+	stored := func(street string, acres float64, area int) *core.Record {
+		record := core.NewRecord(collection)
+		record.Set("street", street)
+		record.Set("acres", acres)
+		record.Set("living_area", area)
+		return record
+	}
+
+	tests := []struct {
+		name     string
+		home     Home
+		record   *core.Record
+		expected bool
+	}{
+		{"same normalized street", Home{Street: "12 Signal Mountain Road"}, stored("12 Signal Mtn Rd", 0, 0), true},
+		{"typo with matching acres", Home{Street: "12 Sequatchie Valley Hwy", Acres: 5}, stored("12 Sequachie Valley Hwy", 5.1, 0), true},
+		{"typo with matching area", Home{Street: "12 Sequatchie Valley Hwy", LivingArea: 2000}, stored("12 Sequachie Valley Hwy", 0, 2040), true},
+		{"typo without corroboration", Home{Street: "12 Sequatchie Valley Hwy"}, stored("12 Sequachie Valley Hwy", 0, 0), false},
+		{"different house number", Home{Street: "14 Sequatchie Valley Hwy", Acres: 5}, stored("12 Sequatchie Valley Hwy", 5, 0), false},
+		{"different street", Home{Street: "12 Lookout Ridge Rd", Acres: 5}, stored("12 Sequatchie Valley Hwy", 5, 0), false},
+		{"acres disagree", Home{Street: "12 Sequatchie Valley Hwy", Acres: 5}, stored("12 Sequachie Valley Hwy", 8, 0), false},
+		{"area disagrees", Home{Street: "12 Sequatchie Valley Hwy", Acres: 5, LivingArea: 2000}, stored("12 Sequachie Valley Hwy", 5, 2600), false},
+	}
+
+	for _, tt := range tests {
+		if got := sameProperty(tt.home, tt.record); got != tt.expected {
+			t.Errorf("%s: sameProperty = %v, expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	if got := similarity("signal mtn rd", "signal mtn rd"); got != 1 {
+		t.Errorf("Expected identical strings to score 1, got %v", got)
+	}
+	if got := similarity("abcd", "abce"); got != 0.75 {
+		t.Errorf("Expected one substitution in four to score 0.75, got %v", got)
+	}
+	if got := similarity("", "abc"); got != 0 {
+		t.Errorf("Expected an empty string to score 0, got %v", got)
+	}
+}
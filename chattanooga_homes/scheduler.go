@@ -1,75 +1,262 @@
 package chattanooga_homes
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
+	"pb-backend/jobs"
+	"pb-backend/settings"
+
 	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
 )
 
+// The scrape interval comes from the settings package
 const (
-	// Scrape every minute for real-time updates
-	scrapeInterval = 1 * time.Minute
+	// Parse yield monitoring: warn when a scrape returns less than
+	// yieldDropRatio of the recent average listing count
+	yieldHistorySize = 10
+	yieldMinSamples  = 3
+	yieldDropRatio   = 0.5
+
+	// Back off exponentially while sources keep serving challenge pages
+	maxScrapeBackoff = 1 * time.Hour
+
+	// Alert Discord after this many consecutive failures of a source
+	scraperAlertThreshold = 5
+
+	scrapeJob     = "homes_scrape"
+	scrapeTimeout = 10 * time.Minute
+	scrapeJitter  = 10 * time.Second
 )
 
 // HomesScheduler handles periodic scraping of home listings
 type HomesScheduler struct {
-	app     *pocketbase.PocketBase
-	scraper *Scraper
+	app      *pocketbase.PocketBase
+	runner   *jobs.Runner
+	browser  *BrowserManager
+	sources  []ListingSource
+	searches []Search
+
+	// Listing counts from recent scrapes, used to detect parser breakage
+	yieldHistory []int
 }
 
-// NewHomesScheduler creates a new scheduler instance
+// NewHomesScheduler creates a new scheduler instance backed by the FlexMLS
+// scraper on a shared headless browser
 func NewHomesScheduler(app *pocketbase.PocketBase) *HomesScheduler {
+	browser := NewBrowserManager(DefaultBrowserOptions)
+	// Chrome would outlive the app otherwise
+	app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+		browser.Close()
+		return e.Next()
+	})
+
+	s := NewHomesSchedulerWithSources(app, []Search{DefaultSearch}, NewScraper(browser))
+	s.browser = browser
+	return s
+}
+
+// NewHomesSchedulerWithSources creates a scheduler that runs every search
+// against every source and merges the results
+func NewHomesSchedulerWithSources(app *pocketbase.PocketBase, searches []Search, sources ...ListingSource) *HomesScheduler {
 	return &HomesScheduler{
-		app:     app,
-		scraper: NewScraper(),
+		app:      app,
+		sources:  sources,
+		searches: searches,
 	}
 }
 
-// Start begins the scheduler goroutine for scraping
-func (s *HomesScheduler) Start() {
-	go s.runScrapeLoop()
+// Browser returns the shared headless browser, or nil if the scheduler
+// was built without one
+func (s *HomesScheduler) Browser() *BrowserManager {
+	return s.browser
 }
 
-func (s *HomesScheduler) runScrapeLoop() {
-	ticker := time.NewTicker(scrapeInterval)
-	defer ticker.Stop()
+// AddJobs registers the scrape job, and the browser's health check if the
+// scheduler has one. The scrape interval is read before every run, so
+// settings changes and the challenge backoff apply to the next scrape.
+func (s *HomesScheduler) AddJobs(runner *jobs.Runner) {
+	s.runner = runner
+	if s.browser != nil {
+		s.browser.AddJobs(runner)
+	}
+	runner.MustAdd(jobs.Job{
+		Name:    scrapeJob,
+		Every:   s.nextInterval,
+		Timeout: scrapeTimeout,
+		Jitter:  scrapeJitter,
+		Enabled: moduleEnabled,
+		Run:     s.scrapeAndSaveHomes,
+	})
+}
 
-	for range ticker.C {
-		s.scrapeAndSaveHomes()
+// nextInterval doubles the scrape interval for every consecutive challenged
+// scrape, up to maxScrapeBackoff
+func (s *HomesScheduler) nextInterval() time.Duration {
+	streak := s.challengeStreak()
+	interval := settings.Current().ScrapeInterval
+	for i := 0; i < streak && interval < maxScrapeBackoff; i++ {
+		interval *= 2
+	}
+	if interval > maxScrapeBackoff {
+		interval = maxScrapeBackoff
 	}
+	return interval
 }
 
-func (s *HomesScheduler) scrapeAndSaveHomes() {
+func (s *HomesScheduler) scrapeAndSaveHomes(ctx context.Context) (jobs.Counts, error) {
 	log.Println("Starting home listings scrape...")
+	defer func() {
+		if interval := s.nextInterval(); interval != settings.Current().ScrapeInterval {
+			log.Printf("Backing off: next scrape in %v", interval)
+		}
+	}()
 
-	homes, err := s.scraper.ScrapeListings()
+	homes, err := s.fetchListings(ctx)
 	if err != nil {
-		log.Printf("Error scraping listings: %v", err)
-		return
+		return nil, fmt.Errorf("scraping listings: %w", err)
 	}
 
+	s.checkYield(len(homes))
+
 	if len(homes) == 0 {
 		log.Println("No homes found in scrape")
-		return
+		return jobs.Counts{"listings": 0}, nil
 	}
 
 	log.Printf("Found %d listings, saving to database...", len(homes))
 
 	saved, err := SaveHomes(s.app, homes)
 	if err != nil {
-		log.Printf("Error saving homes: %v", err)
+		err = fmt.Errorf("saving homes: %w", err)
 	}
 
 	log.Printf("Scrape complete: %d saved", saved)
+	return jobs.Counts{"listings": len(homes), "saved": saved}, err
 }
 
 // ScrapeNow triggers an immediate scrape (useful for Discord commands)
-func (s *HomesScheduler) ScrapeNow() (int, error) {
-	homes, err := s.scraper.ScrapeListings()
+// through the runner, so it can't overlap a scheduled one. It fails with
+// jobs.ErrRunning while a scrape is running.
+func (s *HomesScheduler) ScrapeNow() (<-chan jobs.Result, error) {
+	if s.runner == nil {
+		return nil, jobs.ErrNotFound
+	}
+	return s.runner.TriggerWait(scrapeJob)
+}
+
+// fetchListings runs every search against every source and dedupes the
+// results by address. It only fails if every source fails, or once ctx is
+// done.
+func (s *HomesScheduler) fetchListings(ctx context.Context) ([]Home, error) {
+	var all []Home
+	var lastErr error
+	failedSources := 0
+
+	for _, source := range s.sources {
+		var sourceHomes []Home
+		var sourceErr error
+		failures := 0
+
+		for _, search := range s.searches {
+			homes, err := source.FetchListings(ctx, search)
+			if err != nil {
+				log.Printf("Error fetching %q from %s: %v", search.Name, source.Name(), err)
+				// Keep a challenge error in preference to others so it is recorded as one
+				if sourceErr == nil || errors.Is(err, ErrBotChallenge) {
+					sourceErr = err
+				}
+				failures++
+				continue
+			}
+			sourceHomes = append(sourceHomes, homes...)
+		}
+
+		// Failures from cancelling the scrape say nothing about the source
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// A source is only unhealthy if every search against it failed
+		if failures < len(s.searches) {
+			sourceErr = nil
+		} else {
+			failedSources++
+			lastErr = sourceErr
+		}
+		s.recordHealth(source.Name(), len(sourceHomes), sourceErr)
+
+		all = append(all, sourceHomes...)
+	}
+
+	if len(s.sources) > 0 && failedSources == len(s.sources) {
+		return nil, lastErr
+	}
+
+	deduped := DedupeHomes(all)
+	if len(deduped) < len(all) {
+		log.Printf("Merged %d duplicate listings across sources", len(all)-len(deduped))
+	}
+	return deduped, nil
+}
+
+// challengeStreak returns the most consecutive challenged scrapes of any of
+// the scheduler's sources. It is read from their health records, so the
+// backoff survives a restart.
+func (s *HomesScheduler) challengeStreak() int {
+	streak := 0
+	for _, source := range s.sources {
+		record, err := s.app.FindFirstRecordByFilter("scraper_health", "source = {:source}",
+			map[string]any{"source": source.Name()})
+		if err == nil {
+			streak = max(streak, record.GetInt("consecutive_challenges"))
+		}
+	}
+	return streak
+}
+
+// checkYield warns when the number of parsed listings drops suddenly compared
+// to recent scrapes, which usually means the page markup changed
+func (s *HomesScheduler) checkYield(count int) {
+	if len(s.yieldHistory) >= yieldMinSamples {
+		total := 0
+		for _, n := range s.yieldHistory {
+			total += n
+		}
+		avg := float64(total) / float64(len(s.yieldHistory))
+		if avg > 0 && float64(count) < avg*yieldDropRatio {
+			log.Printf("WARNING: Parse yield dropped to %d listings (recent average %.1f); page markup may have changed", count, avg)
+		}
+	}
+
+	s.yieldHistory = append(s.yieldHistory, count)
+	if len(s.yieldHistory) > yieldHistorySize {
+		s.yieldHistory = s.yieldHistory[1:]
+	}
+}
+
+// recordHealth persists a source's scrape result and alerts Discord when it
+// crosses the failure threshold or recovers after crossing it
+func (s *HomesScheduler) recordHealth(source string, listings int, scrapeErr error) {
+	health, previousFailures, err := RecordScrapeResult(s.app, source, listings, scrapeErr)
 	if err != nil {
-		return 0, err
+		log.Printf("Error recording scraper health: %v", err)
+		return
 	}
 
-	return SaveHomes(s.app, homes)
+	switch {
+	case scrapeErr != nil && health.ConsecutiveFailures == scraperAlertThreshold:
+		err = PostScraperAlert(s.app, health, false)
+	case scrapeErr == nil && previousFailures >= scraperAlertThreshold:
+		err = PostScraperAlert(s.app, health, true)
+	default:
+		return
+	}
+	if err != nil {
+		log.Printf("[DISCORD] Error posting scraper alert: %v", err)
+	}
 }
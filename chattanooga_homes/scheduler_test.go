@@ -0,0 +1,34 @@
+package chattanooga_homes
+
+import (
+	"testing"
+
+	"pb-backend/settings"
+)
+
+func TestNextIntervalBacksOffAcrossRestarts(t *testing.T) {
+	app := newHomesTestApp(t)
+	newScheduler := func() *HomesScheduler {
+		return NewHomesSchedulerWithSources(app, []Search{DefaultSearch}, NewFixtureSource("fx"))
+	}
+	base := settings.Current().ScrapeInterval
+
+	for range 2 {
+		if _, _, err := RecordScrapeResult(app, "fx", 0, ErrBotChallenge); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A new scheduler stands in for a restart
+	want := min(4*base, maxScrapeBackoff)
+	if got := newScheduler().nextInterval(); got != want {
+		t.Errorf("Expected %v after two challenges, got %v", want, got)
+	}
+
+	if _, _, err := RecordScrapeResult(app, "fx", 10, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := newScheduler().nextInterval(); got != base {
+		t.Errorf("Expected %v after a success, got %v", base, got)
+	}
+}
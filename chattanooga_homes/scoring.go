@@ -0,0 +1,305 @@
+package chattanooga_homes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Scoring criteria, as stored in score_details
+const (
+	ScorePricePerAcre = "price_per_acre"
+	ScoreLivingArea   = "living_area"
+	ScoreYearBuilt    = "year_built"
+	ScoreDistance     = "distance"
+	ScoreKeywords     = "keywords"
+)
+
+// scoreCriteria lists the criteria in display order
+var scoreCriteria = []string{ScorePricePerAcre, ScoreLivingArea, ScoreYearBuilt, ScoreDistance, ScoreKeywords}
+
+const (
+	// Criteria a listing has no data for count as average rather than
+	// sinking or lifting it
+	unknownSubscore = 0.5
+
+	earthRadiusMiles = 3958.8
+)
+
+// ScoringModel rates listings from 0 to 100. Each weighted criterion maps a
+// listing to a 0-1 subscore with a linear ramp between the value that
+// scores 0 and the ideal value that scores 1; the score is the weighted
+// average of the subscores.
+type ScoringModel struct {
+	Weights map[string]float64
+
+	PricePerAcreIdeal, PricePerAcreMax float64
+	LivingAreaMin, LivingAreaIdeal     float64
+	YearBuiltMin, YearBuiltIdeal       float64
+
+	// Distance in miles from a point, e.g. work or family
+	OriginLat, OriginLon       float64
+	DistanceIdeal, DistanceMax float64
+
+	// Keyword weights; negative weights penalize matches
+	Keywords map[string]float64
+}
+
+// scoringModelFromRecord reads a home_scoring record
+func scoringModelFromRecord(record *core.Record) (*ScoringModel, error) {
+	model := &ScoringModel{
+		Weights:           make(map[string]float64, len(scoreCriteria)),
+		PricePerAcreIdeal: record.GetFloat("price_per_acre_ideal"),
+		PricePerAcreMax:   record.GetFloat("price_per_acre_max"),
+		LivingAreaMin:     record.GetFloat("living_area_min"),
+		LivingAreaIdeal:   record.GetFloat("living_area_ideal"),
+		YearBuiltMin:      record.GetFloat("year_built_min"),
+		YearBuiltIdeal:    record.GetFloat("year_built_ideal"),
+		OriginLat:         record.GetFloat("origin_lat"),
+		OriginLon:         record.GetFloat("origin_lon"),
+		DistanceIdeal:     record.GetFloat("distance_ideal_miles"),
+		DistanceMax:       record.GetFloat("distance_max_miles"),
+	}
+	for _, criterion := range scoreCriteria {
+		model.Weights[criterion] = record.GetFloat("weight_" + criterion)
+	}
+	if raw := record.GetString("keywords"); raw != "" && raw != "null" {
+		if err := record.UnmarshalJSONField("keywords", &model.Keywords); err != nil {
+			return nil, fmt.Errorf("keywords must be an object of keyword weights: %w", err)
+		}
+	}
+	return model, nil
+}
+
+// Validate checks that every weighted criterion is configured
+func (m *ScoringModel) Validate() error {
+	ramps := map[string][2]float64{
+		ScorePricePerAcre: {m.PricePerAcreMax, m.PricePerAcreIdeal},
+		ScoreLivingArea:   {m.LivingAreaMin, m.LivingAreaIdeal},
+		ScoreYearBuilt:    {m.YearBuiltMin, m.YearBuiltIdeal},
+		ScoreDistance:     {m.DistanceMax, m.DistanceIdeal},
+	}
+	for _, criterion := range scoreCriteria {
+		ramp, ok := ramps[criterion]
+		if ok && m.Weights[criterion] > 0 && ramp[0] == ramp[1] {
+			return fmt.Errorf("%s is weighted but its ideal and limit are equal", criterion)
+		}
+	}
+	if m.Weights[ScoreDistance] > 0 && m.OriginLat == 0 && m.OriginLon == 0 {
+		return fmt.Errorf("distance is weighted but origin_lat and origin_lon are not set")
+	}
+	if m.Weights[ScoreKeywords] > 0 {
+		positive := false
+		for keyword, weight := range m.Keywords {
+			if strings.TrimSpace(keyword) == "" {
+				return fmt.Errorf("keywords must not be empty")
+			}
+			positive = positive || weight > 0
+		}
+		if !positive {
+			return fmt.Errorf("keywords are weighted but none has a positive weight")
+		}
+	}
+	return nil
+}
+
+// Score rates a listing. details holds each weighted criterion's subscore,
+// or nil when the listing has no data for it.
+func (m *ScoringModel) Score(record *core.Record) (score float64, details map[string]any) {
+	details = make(map[string]any, len(scoreCriteria))
+	var total, weights float64
+
+	for _, criterion := range scoreCriteria {
+		weight := m.Weights[criterion]
+		if weight <= 0 {
+			continue
+		}
+
+		subscore, ok := m.subscore(criterion, record)
+		if ok {
+			details[criterion] = round2(subscore)
+		} else {
+			details[criterion] = nil
+			subscore = unknownSubscore
+		}
+		total += weight * subscore
+		weights += weight
+	}
+
+	if weights == 0 {
+		return 0, details
+	}
+	return math.Round(1000*total/weights) / 10, details
+}
+
+func (m *ScoringModel) subscore(criterion string, record *core.Record) (float64, bool) {
+	switch criterion {
+	case ScorePricePerAcre:
+		price, acres := record.GetFloat("price"), record.GetFloat("acres")
+		if price <= 0 || acres <= 0 {
+			return 0, false
+		}
+		return ramp(price/acres, m.PricePerAcreMax, m.PricePerAcreIdeal), true
+
+	case ScoreLivingArea:
+		area := record.GetFloat("living_area")
+		if area <= 0 {
+			return 0, false
+		}
+		return ramp(area, m.LivingAreaMin, m.LivingAreaIdeal), true
+
+	case ScoreYearBuilt:
+		year := record.GetFloat("year_built")
+		if year <= 0 {
+			return 0, false
+		}
+		return ramp(year, m.YearBuiltMin, m.YearBuiltIdeal), true
+
+	case ScoreDistance:
+		lat, lon := record.GetFloat("lat"), record.GetFloat("lon")
+		if lat == 0 && lon == 0 {
+			return 0, false
+		}
+		miles := distanceMiles(m.OriginLat, m.OriginLon, lat, lon)
+		return ramp(miles, m.DistanceMax, m.DistanceIdeal), true
+
+	case ScoreKeywords:
+		description := strings.ToLower(record.GetString("description"))
+		if description == "" {
+			return 0, false
+		}
+		var hits, possible float64
+		for keyword, weight := range m.Keywords {
+			if weight > 0 {
+				possible += weight
+			}
+			if strings.Contains(description, strings.ToLower(strings.TrimSpace(keyword))) {
+				hits += weight
+			}
+		}
+		if possible == 0 {
+			return 0, false
+		}
+		return math.Max(0, math.Min(1, hits/possible)), true
+	}
+	return 0, false
+}
+
+// ramp maps value linearly from zeroAt (0) to oneAt (1), clamped to 0-1.
+// It works in either direction, so lower-is-better criteria pass their
+// limit as zeroAt.
+func ramp(value, zeroAt, oneAt float64) float64 {
+	if zeroAt == oneAt {
+		return 0
+	}
+	t := (value - zeroAt) / (oneAt - zeroAt)
+	return math.Max(0, math.Min(1, t))
+}
+
+// distanceMiles returns the great-circle distance between two points
+func distanceMiles(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMiles * math.Asin(math.Sqrt(a))
+}
+
+// activeScoringModel returns the newest enabled scoring model, or nil when
+// there is none
+func activeScoringModel(app core.App) (*ScoringModel, error) {
+	records, err := app.FindRecordsByFilter("home_scoring", "enabled = true", "-updated", 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return scoringModelFromRecord(records[0])
+}
+
+// applyScore sets a listing's score from the model, clearing it when there
+// is no model. It reports whether anything changed.
+func applyScore(model *ScoringModel, record *core.Record) bool {
+	score, details := 0.0, map[string]any(nil)
+	if model != nil {
+		score, details = model.Score(record)
+	}
+
+	beforeScore, beforeDetails := record.GetFloat("score"), record.GetString("score_details")
+	record.Set("score", score)
+	record.Set("score_details", details)
+	return record.GetFloat("score") != beforeScore || record.GetString("score_details") != beforeDetails
+}
+
+// scoreValue formats a listing's score for messages; ok is false when the
+// listing hasn't been scored
+func scoreValue(record *core.Record) (value string, ok bool) {
+	var details map[string]any
+	if err := record.UnmarshalJSONField("score_details", &details); err != nil || len(details) == 0 {
+		return "", false
+	}
+	return fmt.Sprintf("%.0f/100", record.GetFloat("score")), true
+}
+
+// registerScoringHooks validates scoring models, scores listings as they
+// are saved and rescores every listing when the models change
+func registerScoringHooks(app *pocketbase.PocketBase) {
+	app.OnRecordValidate("home_scoring").BindFunc(func(e *core.RecordEvent) error {
+		model, err := scoringModelFromRecord(e.Record)
+		if err != nil {
+			return err
+		}
+		if err := model.Validate(); err != nil {
+			return fmt.Errorf("invalid scoring model: %w", err)
+		}
+		return e.Next()
+	})
+
+	models := &modelCache[*ScoringModel]{load: activeScoringModel}
+	scoreHome := func(e *core.RecordEvent) error {
+		model, err := models.get(e.App)
+		if err != nil {
+			log.Printf("[SCORING] Error loading scoring model: %v", err)
+			return e.Next()
+		}
+		applyScore(model, e.Record)
+		return e.Next()
+	}
+	app.OnRecordCreate("homes").BindFunc(scoreHome)
+	app.OnRecordUpdate("homes").BindFunc(scoreHome)
+
+	rescore := func(e *core.RecordEvent) error {
+		models.invalidate()
+		wakeJob(scoringJob)
+		return e.Next()
+	}
+	app.OnRecordAfterCreateSuccess("home_scoring").BindFunc(rescore)
+	app.OnRecordAfterUpdateSuccess("home_scoring").BindFunc(rescore)
+	app.OnRecordAfterDeleteSuccess("home_scoring").BindFunc(rescore)
+}
+
+// RescoreHomes scores every listing with the active model and saves the
+// ones whose score changed
+func RescoreHomes(ctx context.Context, app core.App) (updated int, err error) {
+	model, err := activeScoringModel(app)
+	if err != nil {
+		return 0, err
+	}
+
+	updated, err = updateAllHomes(ctx, app, func(record *core.Record) bool {
+		return applyScore(model, record)
+	})
+	if err != nil {
+		return updated, err
+	}
+
+	log.Printf("[SCORING] Rescored listings: %d changed", updated)
+	return updated, nil
+}
@@ -0,0 +1,127 @@
+package chattanooga_homes
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func newScoringTestRecord(values map[string]any) *core.Record {
+	collection := core.NewBaseCollection("homes")
+	for _, name := range []string{"price", "acres", "living_area", "year_built", "lat", "lon"} {
+		collection.Fields.Add(&core.NumberField{Name: name})
+	}
+	collection.Fields.Add(&core.TextField{Name: "description"})
+
+	record := core.NewRecord(collection)
+	for key, value := range values {
+		record.Set(key, value)
+	}
+	return record
+}
+
+func TestRamp(t *testing.T) {
+	tests := []struct {
+		value, zeroAt, oneAt, expected float64
+	}{
+		{1500, 1000, 2000, 0.5},
+		{500, 1000, 2000, 0},
+		{2500, 1000, 2000, 1},
+		// Lower is better
+		{15000, 20000, 10000, 0.5},
+		{5000, 20000, 10000, 1},
+		{1000, 1000, 1000, 0},
+	}
+	for _, test := range tests {
+		if got := ramp(test.value, test.zeroAt, test.oneAt); got != test.expected {
+			t.Errorf("ramp(%v, %v, %v) = %v, expected %v", test.value, test.zeroAt, test.oneAt, got, test.expected)
+		}
+	}
+}
+
+func TestScoringModelScore(t *testing.T) {
+	model := &ScoringModel{
+		Weights:         map[string]float64{ScoreLivingArea: 2, ScoreYearBuilt: 1, ScoreKeywords: 1},
+		LivingAreaMin:   1000,
+		LivingAreaIdeal: 2000,
+		YearBuiltMin:    1950,
+		YearBuiltIdeal:  2020,
+		Keywords:        map[string]float64{"Creek": 1, "pond": 1, "highway": -1},
+	}
+
+	record := newScoringTestRecord(map[string]any{
+		"living_area": 1500,
+		"year_built":  2020,
+		"description": "Quiet lot with a creek",
+	})
+	score, details := model.Score(record)
+	// (2*0.5 + 1*1 + 1*0.5) / 4
+	if score != 62.5 {
+		t.Errorf("Expected a score of 62.5, got %v (%v)", score, details)
+	}
+	if details[ScoreKeywords] != 0.5 || details[ScoreLivingArea] != 0.5 {
+		t.Errorf("Unexpected details %v", details)
+	}
+	if _, ok := details[ScorePricePerAcre]; ok {
+		t.Errorf("Expected unweighted criteria to be left out of the details, got %v", details)
+	}
+
+	// Missing data counts as average
+	score, details = model.Score(newScoringTestRecord(map[string]any{"year_built": 2020}))
+	if details[ScoreLivingArea] != nil || details[ScoreKeywords] != nil {
+		t.Errorf("Expected nil subscores for missing data, got %v", details)
+	}
+	if score != 62.5 {
+		t.Errorf("Expected unknown criteria to score 0.5, got %v", score)
+	}
+
+	// Penalized keywords don't take the subscore below 0
+	score, _ = model.Score(newScoringTestRecord(map[string]any{
+		"living_area": 1000,
+		"year_built":  1950,
+		"description": "Next to the highway",
+	}))
+	if score != 0 {
+		t.Errorf("Expected a score of 0, got %v", score)
+	}
+}
+
+func TestScoringModelDistance(t *testing.T) {
+	model := &ScoringModel{
+		Weights:       map[string]float64{ScoreDistance: 1},
+		OriginLat:     35.0456,
+		OriginLon:     -85.3097,
+		DistanceIdeal: 0,
+		DistanceMax:   20,
+	}
+
+	// About 10 miles north
+	score, _ := model.Score(newScoringTestRecord(map[string]any{"lat": 35.1904, "lon": -85.3097}))
+	if math.Abs(score-50) > 1 {
+		t.Errorf("Expected a score near 50, got %v", score)
+	}
+	if miles := distanceMiles(35.0456, -85.3097, 35.0456, -85.3097); miles != 0 {
+		t.Errorf("Expected no distance to the same point, got %v", miles)
+	}
+}
+
+func TestScoringModelValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		model ScoringModel
+		valid bool
+	}{
+		{"unweighted", ScoringModel{}, true},
+		{"ramp", ScoringModel{Weights: map[string]float64{ScoreLivingArea: 1}, LivingAreaMin: 1000, LivingAreaIdeal: 2000}, true},
+		{"equal ramp", ScoringModel{Weights: map[string]float64{ScoreLivingArea: 1}, LivingAreaMin: 1000, LivingAreaIdeal: 1000}, false},
+		{"no origin", ScoringModel{Weights: map[string]float64{ScoreDistance: 1}, DistanceMax: 20}, false},
+		{"no positive keyword", ScoringModel{Weights: map[string]float64{ScoreKeywords: 1}, Keywords: map[string]float64{"highway": -1}}, false},
+		{"empty keyword", ScoringModel{Weights: map[string]float64{ScoreKeywords: 1}, Keywords: map[string]float64{" ": 1}}, false},
+	}
+	for _, test := range tests {
+		if err := test.model.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: Validate() = %v, expected valid = %v", test.name, err, test.valid)
+		}
+	}
+}
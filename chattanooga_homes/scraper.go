@@ -2,14 +2,12 @@ package chattanooga_homes
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
 )
 
@@ -28,76 +26,69 @@ const (
 	userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
 )
 
-type Scraper struct{}
+const (
+	// Timeout for loading and reading a single results page
+	pageTimeout = 2 * time.Minute
+)
 
-func NewScraper() *Scraper {
-	return &Scraper{}
+// Scraper is the headless-browser FlexMLS listing source
+type Scraper struct {
+	browser *BrowserManager
 }
 
-// buildURL constructs the URL for a specific page
-func buildURL(page int) string {
-	return fmt.Sprintf("%s?_filter=%s&list_view=summary&page=%d&_limit=%d&sort_id=new_or_recently_changed_first",
-		baseURL, defaultFilter, page, pageLimit)
+// NewScraper creates a scraper that drives pages on the shared browser
+func NewScraper(browser *BrowserManager) *Scraper {
+	return &Scraper{browser: browser}
 }
 
-// ScrapeListings fetches all listings using a headless browser
-func (s *Scraper) ScrapeListings() ([]Home, error) {
-	log.Println("Starting headless browser scrape...")
-
-	// Create browser options to appear more like a real browser
-	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.Flag("headless", true),
-		chromedp.Flag("disable-gpu", true),
-		chromedp.Flag("no-sandbox", true),
-		chromedp.Flag("disable-dev-shm-usage", true),
-		chromedp.Flag("disable-blink-features", "AutomationControlled"),
-		chromedp.Flag("disable-infobars", true),
-		chromedp.Flag("start-maximized", true),
-		chromedp.Flag("disable-extensions", true),
-		chromedp.UserAgent(userAgent),
-		chromedp.WindowSize(1920, 1080),
-	)
+// Name implements ListingSource
+func (s *Scraper) Name() string {
+	return "flexmls"
+}
 
-	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), opts...)
-	defer allocCancel()
-
-	// Create context with logging
-	ctx, cancel := chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
-	defer cancel()
-
-	// Set overall timeout
-	ctx, cancel = context.WithTimeout(ctx, 5*time.Minute)
-	defer cancel()
-
-	// Set extra headers
-	headers := map[string]interface{}{
-		"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8",
-		"Accept-Language":           "en-US,en;q=0.9",
-		"Accept-Encoding":           "gzip, deflate, br",
-		"Connection":                "keep-alive",
-		"Upgrade-Insecure-Requests": "1",
-		"Sec-Fetch-Dest":            "document",
-		"Sec-Fetch-Mode":            "navigate",
-		"Sec-Fetch-Site":            "none",
-		"Sec-Fetch-User":            "?1",
-		"Cache-Control":             "max-age=0",
-	}
+// FetchListings implements ListingSource
+func (s *Scraper) FetchListings(ctx context.Context, search Search) ([]Home, error) {
+	return s.ScrapeListings(ctx, search)
+}
 
-	// Enable network and set headers
-	if err := chromedp.Run(ctx, network.Enable(), network.SetExtraHTTPHeaders(network.Headers(headers))); err != nil {
-		log.Printf("Warning: Could not set extra headers: %v", err)
+// buildURL constructs the URL for a specific page
+func buildURL(filter string, page int) string {
+	if filter == "" {
+		filter = defaultFilter
 	}
+	return fmt.Sprintf("%s?_filter=%s&list_view=summary&page=%d&_limit=%d&sort_id=new_or_recently_changed_first",
+		baseURL, filter, page, pageLimit)
+}
+
+// ScrapeListings fetches all listings for a search using a headless browser.
+// It stops between pages once ctx is done.
+func (s *Scraper) ScrapeListings(ctx context.Context, search Search) ([]Home, error) {
+	log.Printf("Starting headless browser scrape for search %q...", search.Name)
 
 	var allHomes []Home
+	var lastErr error
 
 	// Fetch all pages
 	for page := 1; page <= maxPages; page++ {
-		url := buildURL(page)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		url := buildURL(search.Filter, page)
 		log.Printf("Fetching page %d: %s", page, url)
 
-		homes, err := s.scrapePage(ctx, url)
+		var homes []Home
+		err := s.browser.Run(ctx, pageTimeout, func(ctx context.Context) error {
+			var err error
+			homes, err = s.scrapePage(ctx, url)
+			return err
+		})
 		if err != nil {
 			log.Printf("Error scraping page %d: %v", page, err)
+			lastErr = err
+			// A challenge applies to the whole session, so later pages would fail too
+			if errors.Is(err, ErrBotChallenge) {
+				break
+			}
 			continue
 		}
 
@@ -118,6 +109,9 @@ func (s *Scraper) ScrapeListings() ([]Home, error) {
 	}
 
 	log.Printf("Total listings scraped: %d", len(allHomes))
+	if len(allHomes) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
 	return allHomes, nil
 }
 
@@ -125,19 +119,19 @@ func (s *Scraper) ScrapeListings() ([]Home, error) {
 func (s *Scraper) scrapePage(ctx context.Context, url string) ([]Home, error) {
 	var html string
 
-	// Navigate and wait for content with longer wait times
+	// Navigate and wait for the DOM; listing cards are waited for below so a
+	// challenge page is classified instead of timing out
 	err := chromedp.Run(ctx,
 		chromedp.Navigate(url),
-		// Wait for DOM ready and at least one listing card; avoids fixed sleeps
 		chromedp.WaitReady("body", chromedp.ByQuery),
-		chromedp.WaitVisible(`div.summary-card`, chromedp.ByQuery),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to navigate: %w", err)
 	}
 
-	// Try waiting for real content to appear (not challenge page)
-	// We'll check multiple times if we're still getting challenge page
+	// Challenge pages usually resolve themselves after a few seconds, so
+	// re-read the page a few times before giving up
+	class := PageUnknown
 	maxAttempts := 5
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
 		err = chromedp.Run(ctx, chromedp.OuterHTML("html", &html))
@@ -145,187 +139,90 @@ func (s *Scraper) scrapePage(ctx context.Context, url string) ([]Home, error) {
 			return nil, fmt.Errorf("failed to get HTML: %w", err)
 		}
 
-		// Check if we got past the challenge (real content has more HTML)
-		if len(html) > 50000 || strings.Contains(html, "listing") || strings.Contains(html, "ListingId") || strings.Contains(html, "property") {
-			log.Printf("Got real content on attempt %d (HTML length: %d bytes)", attempt, len(html))
+		class = ClassifyPage(html)
+		if class == PageListings || class == PageNoResults {
+			log.Printf("Got %s page on attempt %d (HTML length: %d bytes)", class, attempt, len(html))
 			break
 		}
 
-		// Still on challenge page, wait and retry
-		log.Printf("Attempt %d: Still on challenge page (HTML length: %d bytes), waiting...", attempt, len(html))
+		log.Printf("Attempt %d: Got %s page (HTML length: %d bytes), waiting...", attempt, class, len(html))
 		if err := chromedp.Run(ctx, chromedp.Sleep(3*time.Second)); err != nil {
 			return nil, err
 		}
 	}
 
-	// Check for bot challenge page
-	if len(html) < 20000 {
-		if strings.Contains(html, "_fs-ch") || strings.Contains(html, "challenge") {
-			log.Printf("WARNING: Detected bot challenge page")
-		}
+	switch class {
+	case PageChallenge:
+		return nil, ErrBotChallenge
+	case PageNoResults:
+		return nil, nil
+	case PageUnknown:
+		return nil, fmt.Errorf("unrecognized page (HTML length: %d bytes)", len(html))
 	}
 
 	// Extract listings from HTML
-	homes := extractListingsFromHTML(html)
-
-	return homes, nil
-}
-
-// extractListingsFromHTML parses the HTML to extract listing data
-func extractListingsFromHTML(html string) []Home {
-	var homes []Home
-
-	// Find all listing cards using the summary-card pattern
-	// Each listing starts with: <div id="LISTING_KEY" data-standard-status="Active" ... class="summary-card listingListItem">
-	listingPattern := regexp.MustCompile(`<div\s+id="(\d{26})"\s+data-standard-status="([^"]*)"\s+[^>]*data-current-price="([^"]*)"[^>]*class="summary-card[^"]*"`)
-	matches := listingPattern.FindAllStringSubmatch(html, -1)
-
-	log.Printf("Found %d listing card matches", len(matches))
-
-	for _, match := range matches {
-		if len(match) < 3 {
-			continue
-		}
-
-		listingKey := match[1]
-		status := match[2]
-		priceStr := match[3]
-
-		home := Home{
-			ListingID: listingKey,
-			Status:    strings.TrimSpace(status),
-		}
-
-		// Parse price
-		if price, err := strconv.ParseFloat(priceStr, 64); err == nil {
-			home.Price = int(price)
-		}
-
-		// Find the section of HTML for this listing to extract other details
-		listingStart := strings.Index(html, `id="`+listingKey+`"`)
-		if listingStart == -1 {
-			continue
-		}
-
-		// Find next listing by looking for next <div id="26-digit-number"
-		// We need to skip past the current listing's opening tag (at least 500 chars)
-		nextListingPattern := regexp.MustCompile(`<div\s+id="\d{26}"`)
-		searchStart := listingStart + 500 // Skip past current listing's opening tag
-		if searchStart > len(html) {
-			searchStart = len(html)
-		}
-
-		nextMatch := nextListingPattern.FindStringIndex(html[searchStart:])
-		var listingHTML string
-		if nextMatch != nil {
-			listingHTML = html[listingStart : searchStart+nextMatch[0]]
-		} else {
-			// Take rest of content or a large chunk
-			endIdx := listingStart + 20000
-			if endIdx > len(html) {
-				endIdx = len(html)
-			}
-			listingHTML = html[listingStart:endIdx]
-		}
-
-		// Debug: log the chunk size
-		if len(homes) == 0 {
-			log.Printf("First listing HTML chunk size: %d bytes", len(listingHTML))
-		}
-
-		// Extract street address (line-one)
-		streetPattern := regexp.MustCompile(`<div class="line-one">([^<]+)</div>`)
-		if streetMatch := streetPattern.FindStringSubmatch(listingHTML); len(streetMatch) > 1 {
-			home.Street = strings.TrimSpace(streetMatch[1])
-		}
+	result, err := ParseListingsHTML(strings.NewReader(html))
+	if err != nil {
+		return nil, err
+	}
 
-		// Extract city, state, zip (line-two)
-		lineTwo := regexp.MustCompile(`<div class="line-two">([^<]+)</div>`)
-		if lineTwoMatch := lineTwo.FindStringSubmatch(listingHTML); len(lineTwoMatch) > 1 {
-			parts := strings.Split(strings.TrimSpace(lineTwoMatch[1]), ", ")
-			if len(parts) >= 1 {
-				home.City = parts[0]
-			}
-			if len(parts) >= 2 {
-				// State and zip are in "TN 37308" format
-				stateZip := strings.Split(parts[1], " ")
-				if len(stateZip) >= 1 {
-					home.State = stateZip[0]
-				}
-				if len(stateZip) >= 2 {
-					home.Zip = stateZip[1]
-				}
-			}
-		}
+	log.Printf("Found %d listing cards", len(result.Homes))
+	if len(result.FieldErrors) > 0 {
+		log.Printf("WARNING: %d field extraction failures (%s)", len(result.FieldErrors), result.Summary())
+	}
 
-		// Extract data fields from title/value pairs
-		home.SubType = extractDataValue(listingHTML, "Sub Type")
-		home.County = extractDataValue(listingHTML, "County")
-		home.Area = extractDataValue(listingHTML, "Area")
-		home.Subdivision = extractDataValue(listingHTML, "Subdivision")
-
-		// Living Area (numeric)
-		if livingArea := extractDataValue(listingHTML, "Living Area"); livingArea != "" {
-			cleanedLA := strings.ReplaceAll(livingArea, ",", "")
-			if la, err := strconv.Atoi(cleanedLA); err == nil {
-				home.LivingArea = la
-			}
-		}
+	return result.Homes, nil
+}
 
-		// Beds Total (numeric)
-		if beds := extractDataValue(listingHTML, "Beds Total"); beds != "" {
-			if b, err := strconv.Atoi(beds); err == nil {
-				home.BedsTotal = b
-			}
-		}
+// PageClass is the kind of page a search URL returned
+type PageClass string
 
-		// Baths Total (numeric, can be float)
-		if baths := extractDataValue(listingHTML, "Baths Total"); baths != "" {
-			if b, err := strconv.ParseFloat(baths, 64); err == nil {
-				home.BathsTotal = b
-			}
-		}
+const (
+	PageListings  PageClass = "listings"
+	PageNoResults PageClass = "no-results"
+	PageChallenge PageClass = "challenge"
+	PageUnknown   PageClass = "unknown"
+)
 
-		// Acres (float)
-		if acres := extractDataValue(listingHTML, "Acres"); acres != "" {
-			if a, err := strconv.ParseFloat(acres, 64); err == nil {
-				home.Acres = a
-			}
-		}
+// ErrBotChallenge is returned when the source served a bot challenge page
+// instead of listings
+var ErrBotChallenge = errors.New("bot challenge page")
+
+// challengeMarkers are substrings seen on bot-protection interstitials
+var challengeMarkers = []string{
+	"_fs-ch",
+	"challenge-platform",
+	"cf-chl",
+	"cf_chl",
+	"Just a moment...",
+	"Checking your browser",
+	"captcha",
+	"Access Denied",
+}
 
-		// Year Built (numeric)
-		if yearBuilt := extractDataValue(listingHTML, "Year Built"); yearBuilt != "" {
-			if yb, err := strconv.Atoi(yearBuilt); err == nil {
-				home.YearBuilt = yb
-			}
-		}
+// ClassifyPage decides whether HTML is a results page, an empty results
+// page or a bot challenge
+func ClassifyPage(html string) PageClass {
+	if strings.Contains(html, "summary-card") && strings.Contains(html, "data-standard-status") {
+		return PageListings
+	}
 
-		// Extract first image URL (main listing image)
-		// FlexMLS often uses data-src/src with sparkplatform CDN; support both and protocol-relative URLs.
-		imgPattern := regexp.MustCompile(`<img[^>]+(?:data-src|src)="([^"]*sparkplatform[^"]+)"`)
-		if imgMatch := imgPattern.FindStringSubmatch(listingHTML); len(imgMatch) > 1 {
-			imgURL := imgMatch[1]
-			if strings.HasPrefix(imgURL, "//") {
-				imgURL = "https:" + imgURL
-			}
-			home.ImageURL = imgURL
+	lower := strings.ToLower(html)
+	for _, marker := range challengeMarkers {
+		if strings.Contains(lower, strings.ToLower(marker)) {
+			return PageChallenge
 		}
-
-		// Build URL for this listing
-		home.URL = fmt.Sprintf("https://my.flexmls.com/greaterchattanooganew/search/idx_links/20240916004638701725000000/listings/%s", listingKey)
-
-		homes = append(homes, home)
 	}
 
-	return homes
-}
+	if strings.Contains(lower, "no listings found") || strings.Contains(lower, "no results") {
+		return PageNoResults
+	}
 
-// extractDataValue extracts the value for a given title from the data-row pattern
-func extractDataValue(html, title string) string {
-	// Pattern: <div class="title" title="Title">Title</div>\n<div class="value" title="Value">Value</div>
-	pattern := regexp.MustCompile(`<div class="title"[^>]*>` + regexp.QuoteMeta(title) + `</div>\s*<div class="value"[^>]*title="([^"]*)"`)
-	if match := pattern.FindStringSubmatch(html); len(match) > 1 {
-		return strings.TrimSpace(match[1])
+	// Real result pages are large; a tiny page with no recognizable content
+	// is almost always an interstitial we don't have a marker for yet
+	if len(html) < 20000 {
+		return PageChallenge
 	}
-	return ""
+
+	return PageUnknown
 }
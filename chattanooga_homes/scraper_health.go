@@ -0,0 +1,90 @@
+package chattanooga_homes
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ScraperHealth is the persisted health record for one listing source
+type ScraperHealth struct {
+	Source                string
+	LastSuccess           time.Time
+	LastFailure           time.Time
+	LastError             string
+	LastListingCount      int
+	ConsecutiveFailures   int
+	ConsecutiveChallenges int
+	ChallengeCount        int
+}
+
+// RecordScrapeResult updates the health record for a source after a scrape.
+// It returns the consecutive failure count from before this result, so
+// callers can tell when a source has recovered.
+func RecordScrapeResult(app *pocketbase.PocketBase, source string, listings int, scrapeErr error) (health *ScraperHealth, previousFailures int, err error) {
+	record, _ := app.FindFirstRecordByFilter("scraper_health", "source = {:source}", map[string]any{"source": source})
+	if record == nil {
+		collection, err := app.FindCollectionByNameOrId("scraper_health")
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to find scraper_health collection: %w", err)
+		}
+		record = core.NewRecord(collection)
+		record.Set("source", source)
+	}
+
+	previousFailures = record.GetInt("consecutive_failures")
+	now := time.Now().UTC()
+
+	if scrapeErr == nil {
+		record.Set("last_success", now)
+		record.Set("last_listing_count", listings)
+		record.Set("consecutive_failures", 0)
+		record.Set("consecutive_challenges", 0)
+	} else {
+		record.Set("last_failure", now)
+		record.Set("last_error", scrapeErr.Error())
+		record.Set("consecutive_failures", previousFailures+1)
+		if errors.Is(scrapeErr, ErrBotChallenge) {
+			record.Set("consecutive_challenges", record.GetInt("consecutive_challenges")+1)
+			record.Set("challenge_count", record.GetInt("challenge_count")+1)
+		} else {
+			record.Set("consecutive_challenges", 0)
+		}
+	}
+
+	if err := app.Save(record); err != nil {
+		return nil, previousFailures, fmt.Errorf("failed to save scraper health for %s: %w", source, err)
+	}
+
+	return scraperHealthFromRecord(record), previousFailures, nil
+}
+
+// GetScraperHealth returns the health records for all sources
+func GetScraperHealth(app *pocketbase.PocketBase) ([]*ScraperHealth, error) {
+	records, err := app.FindRecordsByFilter("scraper_health", "", "source", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*ScraperHealth, 0, len(records))
+	for _, record := range records {
+		result = append(result, scraperHealthFromRecord(record))
+	}
+	return result, nil
+}
+
+func scraperHealthFromRecord(record *core.Record) *ScraperHealth {
+	return &ScraperHealth{
+		Source:                record.GetString("source"),
+		LastSuccess:           record.GetDateTime("last_success").Time(),
+		LastFailure:           record.GetDateTime("last_failure").Time(),
+		LastError:             record.GetString("last_error"),
+		LastListingCount:      record.GetInt("last_listing_count"),
+		ConsecutiveFailures:   record.GetInt("consecutive_failures"),
+		ConsecutiveChallenges: record.GetInt("consecutive_challenges"),
+		ChallengeCount:        record.GetInt("challenge_count"),
+	}
+}
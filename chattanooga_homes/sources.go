@@ -0,0 +1,201 @@
+package chattanooga_homes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Search describes a saved search that a listing source should run
+type Search struct {
+	Name string
+	// Filter is the source-specific query; empty means the source's default
+	Filter string
+}
+
+// DefaultSearch is the Chattanooga-area search used when none is configured
+var DefaultSearch = Search{Name: "default"}
+
+// ListingSource returns listings for a search
+type ListingSource interface {
+	Name() string
+	FetchListings(ctx context.Context, search Search) ([]Home, error)
+}
+
+// HTTPSource fetches FlexMLS-style listing pages over plain HTTP, for sources
+// that don't sit behind a bot challenge and so don't need a browser
+type HTTPSource struct {
+	name   string
+	url    func(search Search) string
+	client *http.Client
+}
+
+// NewHTTPSource creates a plain HTTP source. url builds the page URL for a search.
+func NewHTTPSource(name string, url func(search Search) string) *HTTPSource {
+	return &HTTPSource{
+		name:   name,
+		url:    url,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name implements ListingSource
+func (s *HTTPSource) Name() string {
+	return s.name
+}
+
+// FetchListings implements ListingSource
+func (s *HTTPSource) FetchListings(ctx context.Context, search Search) ([]Home, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url(search), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", s.name, resp.Status)
+	}
+
+	result, err := ParseListingsHTML(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.FieldErrors) > 0 {
+		log.Printf("[%s] WARNING: %d field extraction failures (%s)", s.name, len(result.FieldErrors), result.Summary())
+	}
+
+	return result.Homes, nil
+}
+
+// FixtureSource reads saved listing pages from disk. It is used for tests and
+// for replaying captured pages without touching the network.
+type FixtureSource struct {
+	name  string
+	paths []string
+}
+
+// NewFixtureSource creates a source that parses the given HTML files
+func NewFixtureSource(name string, paths ...string) *FixtureSource {
+	return &FixtureSource{name: name, paths: paths}
+}
+
+// NewFixtureDirSource creates a source from every .html file in dir
+func NewFixtureDirSource(name, dir string) (*FixtureSource, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	return NewFixtureSource(name, paths...), nil
+}
+
+// Name implements ListingSource
+func (s *FixtureSource) Name() string {
+	return s.name
+}
+
+// FetchListings implements ListingSource. The search is ignored; every
+// fixture is returned.
+func (s *FixtureSource) FetchListings(ctx context.Context, search Search) ([]Home, error) {
+	var homes []Home
+	for _, path := range s.paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := ParseListingsHTML(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		homes = append(homes, result.Homes...)
+	}
+	return homes, nil
+}
+
+// DedupeHomes merges listings that refer to the same house, keyed by
+// normalized address. The first listing seen wins; later ones only fill in
+// fields it left empty. Listings without a usable address are kept as-is.
+func DedupeHomes(homes []Home) []Home {
+	result := make([]Home, 0, len(homes))
+	byKey := make(map[string]int)
+	byListingID := make(map[string]bool)
+
+	for _, home := range homes {
+		key := AddressKey(home.Street, home.Zip)
+		if key == "" {
+			if byListingID[home.ListingID] {
+				continue
+			}
+			byListingID[home.ListingID] = true
+			result = append(result, home)
+			continue
+		}
+
+		if i, ok := byKey[key]; ok {
+			result[i] = mergeHome(result[i], home)
+			continue
+		}
+
+		byKey[key] = len(result)
+		byListingID[home.ListingID] = true
+		result = append(result, home)
+	}
+
+	return result
+}
+
+// mergeHome fills empty fields of dst from src
+func mergeHome(dst, src Home) Home {
+	fillString := func(d *string, s string) {
+		if strings.TrimSpace(*d) == "" {
+			*d = s
+		}
+	}
+	fillInt := func(d *int, s int) {
+		if *d == 0 {
+			*d = s
+		}
+	}
+	fillFloat := func(d *float64, s float64) {
+		if *d == 0 {
+			*d = s
+		}
+	}
+
+	fillString(&dst.City, src.City)
+	fillString(&dst.State, src.State)
+	fillString(&dst.Zip, src.Zip)
+	fillInt(&dst.Price, src.Price)
+	fillString(&dst.SubType, src.SubType)
+	fillString(&dst.County, src.County)
+	fillString(&dst.Area, src.Area)
+	fillString(&dst.Subdivision, src.Subdivision)
+	fillInt(&dst.LivingArea, src.LivingArea)
+	fillInt(&dst.BedsTotal, src.BedsTotal)
+	fillFloat(&dst.BathsTotal, src.BathsTotal)
+	fillFloat(&dst.Acres, src.Acres)
+	fillInt(&dst.YearBuilt, src.YearBuilt)
+	fillString(&dst.URL, src.URL)
+	fillString(&dst.ImageURL, src.ImageURL)
+	if len(dst.PhotoURLs) == 0 {
+		dst.PhotoURLs = src.PhotoURLs
+	}
+	fillString(&dst.Status, src.Status)
+	fillString(&dst.Description, src.Description)
+
+	return dst
+}
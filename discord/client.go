@@ -0,0 +1,265 @@
+// Package discord is a small Discord REST client shared by the modules that
+// post to Discord, plus the bot configurations and channel routing rules
+// stored in PocketBase.
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// APIBase is the Discord REST API root
+const APIBase = "https://discord.com/api/v10"
+
+const (
+	// Rate limit waits up to this long are slept through inline; longer ones
+	// are returned as *RateLimitError so callers can reschedule
+	maxInlineRateLimitWait = 5 * time.Second
+	maxRateLimitAttempts   = 3
+)
+
+// Embed represents a Discord embed message
+type Embed struct {
+	Title       string       `json:"title,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Color       int          `json:"color,omitempty"`
+	Fields      []EmbedField `json:"fields,omitempty"`
+	Image       *EmbedImage  `json:"image,omitempty"`
+	Thumbnail   *EmbedImage  `json:"thumbnail,omitempty"`
+	URL         string       `json:"url,omitempty"`
+	Timestamp   string       `json:"timestamp,omitempty"`
+}
+
+type EmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type EmbedImage struct {
+	URL string `json:"url"`
+}
+
+type Message struct {
+	Content    string      `json:"content,omitempty"`
+	Embeds     []Embed     `json:"embeds,omitempty"`
+	Components []Component `json:"components,omitempty"`
+	Flags      int         `json:"flags,omitempty"`
+}
+
+// Component is an action row or button attached to a message
+type Component struct {
+	Type       int         `json:"type"`
+	Style      int         `json:"style,omitempty"`
+	Label      string      `json:"label,omitempty"`
+	CustomID   string      `json:"custom_id,omitempty"`
+	URL        string      `json:"url,omitempty"`
+	Components []Component `json:"components,omitempty"`
+}
+
+// Component types and button styles
+const (
+	ComponentActionRow = 1
+	ComponentButton    = 2
+
+	ButtonPrimary   = 1
+	ButtonSecondary = 2
+	ButtonLink      = 5
+)
+
+// FlagEphemeral makes an interaction reply visible only to the invoking user
+const FlagEphemeral = 64
+
+type messageResponse struct {
+	ID string `json:"id"`
+}
+
+// Channel is the subset of a Discord channel object we use
+type Channel struct {
+	ID             string `json:"id"`
+	ThreadMetadata *struct {
+		Archived bool `json:"archived"`
+		Locked   bool `json:"locked"`
+	} `json:"thread_metadata,omitempty"`
+}
+
+// SendMessage sends a message to a Discord channel and returns its ID
+func SendMessage(config *Config, channelID string, message Message) (string, error) {
+	url := fmt.Sprintf("%s/channels/%s/messages", APIBase, channelID)
+
+	var msgResp messageResponse
+	if err := Request(config, "POST", url, message, &msgResp); err != nil {
+		return "", err
+	}
+	return msgResp.ID, nil
+}
+
+// EditMessage replaces the content and embeds of an existing message
+func EditMessage(config *Config, channelID, messageID string, message Message) error {
+	url := fmt.Sprintf("%s/channels/%s/messages/%s", APIBase, channelID, messageID)
+	return Request(config, "PATCH", url, message, nil)
+}
+
+// CreateThread creates a thread from an existing message
+func CreateThread(config *Config, channelID, messageID, threadName string) (string, error) {
+	url := fmt.Sprintf("%s/channels/%s/messages/%s/threads", APIBase, channelID, messageID)
+
+	var thread Channel
+	err := Request(config, "POST", url, map[string]interface{}{
+		"name":                  threadName,
+		"auto_archive_duration": 1440, // 24 hours
+	}, &thread)
+	if err != nil {
+		return "", err
+	}
+
+	return thread.ID, nil
+}
+
+// UnarchiveThread fetches a thread and unarchives it if archived.
+// It returns a not-found error if the thread was deleted.
+func UnarchiveThread(config *Config, threadID string) error {
+	url := fmt.Sprintf("%s/channels/%s", APIBase, threadID)
+
+	var thread Channel
+	if err := Request(config, "GET", url, nil, &thread); err != nil {
+		return err
+	}
+
+	if thread.ThreadMetadata == nil || !thread.ThreadMetadata.Archived {
+		return nil
+	}
+
+	log.Printf("[DISCORD] Unarchiving thread %s", threadID)
+	return Request(config, "PATCH", url, map[string]interface{}{
+		"archived": false,
+	}, nil)
+}
+
+// OpenDM opens (or reuses) a DM channel with a user and returns its channel ID
+func OpenDM(config *Config, userID string) (string, error) {
+	url := fmt.Sprintf("%s/users/@me/channels", APIBase)
+
+	var channel Channel
+	if err := Request(config, "POST", url, map[string]string{"recipient_id": userID}, &channel); err != nil {
+		return "", err
+	}
+	return channel.ID, nil
+}
+
+// Discord JSON error codes we handle explicitly
+const (
+	ErrUnknownChannel       = 10003
+	ErrUnknownMessage       = 10008
+	ErrThreadAlreadyCreated = 160004
+)
+
+// APIError is a non-2xx response from the Discord API
+type APIError struct {
+	StatusCode int
+	Status     string
+	Code       int    `json:"code"`
+	Message    string `json:"message"`
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("discord API error: %s - %s", e.Status, e.Body)
+}
+
+// IsErrorCode reports whether err is a Discord API error with the given JSON code
+func IsErrorCode(err error, code int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// IsNotFound reports whether err means the channel or message no longer exists
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusNotFound ||
+		apiErr.Code == ErrUnknownChannel ||
+		apiErr.Code == ErrUnknownMessage
+}
+
+// Request sends a JSON request to the Discord API as the configured bot and
+// decodes the response into out (if non-nil). Requests are paced per rate
+// limit bucket; short 429 waits are retried inline and long ones return
+// *RateLimitError. Other non-2xx responses return *APIError. Nothing is sent
+// while the bot configs are publicly readable.
+func Request(config *Config, method, url string, payload interface{}, out interface{}) error {
+	if configExposed.Load() {
+		return ErrConfigExposed
+	}
+
+	var data []byte
+	if payload != nil {
+		var err error
+		data, err = json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	limiter := limiterFor(config.BotToken)
+	route := routeKey(method, url)
+	client := &http.Client{Timeout: 15 * time.Second}
+
+	for attempt := 1; ; attempt++ {
+		limiter.wait(route)
+
+		var body io.Reader
+		if data != nil {
+			body = bytes.NewReader(data)
+		}
+		req, err := http.NewRequest(method, url, body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bot "+config.BotToken)
+		if data != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		retryAfter, global := limiter.update(route, resp, respBody)
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			if retryAfter > maxInlineRateLimitWait || attempt >= maxRateLimitAttempts {
+				return &RateLimitError{RetryAfter: retryAfter, Global: global}
+			}
+			log.Printf("[DISCORD] Rate limited on %s (attempt %d/%d), retrying in %v", route, attempt, maxRateLimitAttempts, retryAfter)
+			time.Sleep(retryAfter)
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			apiErr := &APIError{
+				StatusCode: resp.StatusCode,
+				Status:     resp.Status,
+				Body:       string(respBody),
+			}
+			_ = json.Unmarshal(respBody, apiErr)
+			return apiErr
+		}
+
+		if out != nil && len(respBody) > 0 {
+			return json.Unmarshal(respBody, out)
+		}
+		return nil
+	}
+}
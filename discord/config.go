@@ -0,0 +1,77 @@
+package discord
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// DefaultConfigName is the bot used for DMs, alerts and unrouted messages
+const DefaultConfigName = "default"
+
+// Config holds one Discord bot's configuration
+type Config struct {
+	ID               string
+	Name             string
+	BotToken         string
+	ApplicationID    string
+	PublicKey        string
+	DefaultChannelID string
+}
+
+// GetConfig fetches a bot configuration by name
+func GetConfig(app core.App, name string) (*Config, error) {
+	record, err := app.FindFirstRecordByFilter("discord_config", "name = {:name}", map[string]any{"name": name})
+	if err != nil {
+		return nil, fmt.Errorf("discord config %q not found: %w", name, err)
+	}
+	return configFromRecord(record)
+}
+
+// GetDefaultConfig fetches the default bot configuration
+func GetDefaultConfig(app core.App) (*Config, error) {
+	return GetConfig(app, DefaultConfigName)
+}
+
+// GetConfigByID fetches a bot configuration by record ID
+func GetConfigByID(app core.App, id string) (*Config, error) {
+	record, err := app.FindRecordById("discord_config", id)
+	if err != nil {
+		return nil, fmt.Errorf("discord config %s not found: %w", id, err)
+	}
+	return configFromRecord(record)
+}
+
+// ListConfigs returns every bot configuration
+func ListConfigs(app core.App) ([]*Config, error) {
+	records, err := app.FindRecordsByFilter("discord_config", "", "name", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make([]*Config, 0, len(records))
+	for _, record := range records {
+		config, err := configFromRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+func configFromRecord(record *core.Record) (*Config, error) {
+	token, err := decryptSecret(record.GetString("bot_token"))
+	if err != nil {
+		return nil, fmt.Errorf("discord config %q: %w", record.GetString("name"), err)
+	}
+
+	return &Config{
+		ID:               record.Id,
+		Name:             record.GetString("name"),
+		BotToken:         token,
+		ApplicationID:    record.GetString("application_id"),
+		PublicKey:        record.GetString("public_key"),
+		DefaultChannelID: record.GetString("default_channel_id"),
+	}, nil
+}
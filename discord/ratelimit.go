@@ -0,0 +1,195 @@
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitError is returned when Discord responds 429 and the
+// requested wait is too long to sleep through inline
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Global     bool
+}
+
+func (e *RateLimitError) Error() string {
+	scope := "route"
+	if e.Global {
+		scope = "global"
+	}
+	return fmt.Sprintf("discord API error: %s rate limited, retry after %v", scope, e.RetryAfter)
+}
+
+// rateBucket tracks Discord's X-RateLimit-* state for one bucket
+type rateBucket struct {
+	remaining int
+	resetAt   time.Time
+}
+
+// rateLimiter paces one bot's requests per Discord rate limit bucket, using
+// the bucket headers Discord returns rather than a fixed global spacing.
+// Routes map to buckets as Discord reports them; unknown routes are not
+// delayed. A bucket is the reported hash plus the route's major parameter,
+// since Discord limits each channel, guild or webhook separately even when
+// they share a hash. Buckets and the global limit are per bot token.
+type rateLimiter struct {
+	mu          sync.Mutex
+	routes      map[string]string // route key -> bucket key
+	buckets     map[string]*rateBucket
+	globalUntil time.Time
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[string]*rateLimiter) // bot token -> limiter
+)
+
+// limiterFor returns the rate limiter for a bot token
+func limiterFor(token string) *rateLimiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	limiter, ok := limiters[token]
+	if !ok {
+		limiter = &rateLimiter{
+			routes:  make(map[string]string),
+			buckets: make(map[string]*rateBucket),
+		}
+		limiters[token] = limiter
+	}
+	return limiter
+}
+
+// wait blocks until a request on route is allowed
+func (l *rateLimiter) wait(route string) {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		var until time.Time
+		if now.Before(l.globalUntil) {
+			until = l.globalUntil
+		}
+		if bucket, ok := l.buckets[l.routes[route]]; ok && bucket.remaining <= 0 && now.Before(bucket.resetAt) {
+			if bucket.resetAt.After(until) {
+				until = bucket.resetAt
+			}
+		}
+		if until.IsZero() {
+			// Reserve a slot so concurrent callers don't all see remaining > 0
+			if bucket, ok := l.buckets[l.routes[route]]; ok && bucket.remaining > 0 {
+				bucket.remaining--
+			}
+			l.mu.Unlock()
+			return
+		}
+		l.mu.Unlock()
+		time.Sleep(time.Until(until))
+	}
+}
+
+// update records the rate limit headers from a response. For 429 responses
+// it returns how long to wait before retrying.
+func (l *rateLimiter) update(route string, resp *http.Response, body []byte) (retryAfter time.Duration, global bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	h := resp.Header
+
+	if hash := h.Get("X-RateLimit-Bucket"); hash != "" {
+		key := hash + ":" + majorParameter(route)
+		l.routes[route] = key
+		bucket, ok := l.buckets[key]
+		if !ok {
+			bucket = &rateBucket{}
+			l.buckets[key] = bucket
+		}
+		if remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining")); err == nil {
+			bucket.remaining = remaining
+		}
+		if resetAfter, err := strconv.ParseFloat(h.Get("X-RateLimit-Reset-After"), 64); err == nil {
+			bucket.resetAt = now.Add(time.Duration(resetAfter * float64(time.Second)))
+		}
+	}
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	// Prefer the precise retry_after from the body, falling back to the header
+	var payload struct {
+		RetryAfter float64 `json:"retry_after"`
+		Global     bool    `json:"global"`
+	}
+	_ = json.Unmarshal(body, &payload)
+	if payload.RetryAfter <= 0 {
+		if secs, err := strconv.ParseFloat(h.Get("Retry-After"), 64); err == nil {
+			payload.RetryAfter = secs
+		}
+	}
+	if payload.RetryAfter <= 0 {
+		payload.RetryAfter = 1
+	}
+
+	retryAfter = time.Duration(payload.RetryAfter * float64(time.Second))
+	global = payload.Global || h.Get("X-RateLimit-Global") == "true"
+	if global {
+		l.globalUntil = now.Add(retryAfter)
+	} else if bucket, ok := l.buckets[l.routes[route]]; ok {
+		bucket.remaining = 0
+		bucket.resetAt = now.Add(retryAfter)
+	}
+
+	return retryAfter, global
+}
+
+// routeKey reduces a Discord API URL to its rate limit route: the
+// method plus the path with all IDs except the major parameter replaced
+func routeKey(method, url string) string {
+	path := strings.TrimPrefix(url, APIBase)
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if part == "" || !isSnowflake(part) {
+			continue
+		}
+		// Channel, guild and webhook IDs are major parameters with their own buckets
+		if i > 0 && (parts[i-1] == "channels" || parts[i-1] == "guilds" || parts[i-1] == "webhooks") {
+			continue
+		}
+		parts[i] = ":id"
+	}
+	return method + " " + strings.Join(parts, "/")
+}
+
+// majorParameter returns the channel, guild or webhook ID in a route key,
+// or "" for routes without one
+func majorParameter(route string) string {
+	parts := strings.Split(route, "/")
+	for i := 1; i < len(parts); i++ {
+		switch parts[i-1] {
+		case "channels", "guilds", "webhooks":
+			if isSnowflake(parts[i]) {
+				return parts[i]
+			}
+		}
+	}
+	return ""
+}
+
+func isSnowflake(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
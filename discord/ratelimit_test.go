@@ -0,0 +1,62 @@
+package discord
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRouteKey(t *testing.T) {
+	tests := map[string]string{
+		APIBase + "/channels/111/messages":         "POST /channels/111/messages",
+		APIBase + "/channels/111/messages/222?x=1": "POST /channels/111/messages/:id",
+		APIBase + "/webhooks/333/tok/messages/444": "POST /webhooks/333/tok/messages/:id",
+		APIBase + "/guilds/555/members/666":        "POST /guilds/555/members/:id",
+		APIBase + "/applications/777/commands/888": "POST /applications/:id/commands/:id",
+	}
+	for url, expected := range tests {
+		if got := routeKey("POST", url); got != expected {
+			t.Errorf("routeKey(%q) = %q, expected %q", url, got, expected)
+		}
+	}
+}
+
+func TestRateLimitBucketsArePerMajorParameter(t *testing.T) {
+	limiter := &rateLimiter{
+		routes:  make(map[string]string),
+		buckets: make(map[string]*rateBucket),
+	}
+	busy := routeKey("POST", APIBase+"/channels/111/messages")
+	quiet := routeKey("POST", APIBase+"/channels/222/messages")
+
+	header := http.Header{}
+	header.Set("X-RateLimit-Bucket", "shared")
+	header.Set("X-RateLimit-Remaining", "5")
+	header.Set("X-RateLimit-Reset-After", "60")
+	limiter.update(quiet, &http.Response{StatusCode: http.StatusOK, Header: header}, nil)
+
+	header = http.Header{}
+	header.Set("X-RateLimit-Bucket", "shared")
+	header.Set("X-RateLimit-Remaining", "0")
+	header.Set("X-RateLimit-Reset-After", "60")
+	retryAfter, global := limiter.update(busy, &http.Response{StatusCode: http.StatusTooManyRequests, Header: header},
+		[]byte(`{"retry_after": 60, "global": false}`))
+	if retryAfter != 60*time.Second || global {
+		t.Fatalf("Expected a 60s route limit, got %v (global %v)", retryAfter, global)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		limiter.wait(quiet)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("A 429 on one channel delayed another channel with the same bucket hash")
+	}
+
+	if bucket := limiter.buckets[limiter.routes[busy]]; bucket == nil || bucket.remaining != 0 {
+		t.Errorf("Expected the busy channel's bucket to be exhausted, got %+v", bucket)
+	}
+}
@@ -0,0 +1,180 @@
+package discord
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Subject describes a message being routed. Modules fill in what applies
+// to them: homes use county, status and price; others can route on tags.
+type Subject struct {
+	County string
+	Status string
+	Price  int
+	Tags   []string
+}
+
+// Route is a rule sending matching messages for a module to a channel.
+// Zero-valued criteria are ignored, so a route with none matches everything.
+type Route struct {
+	ID        string
+	Name      string
+	ConfigID  string
+	Module    string
+	GuildID   string
+	ChannelID string
+	Counties  []string
+	Statuses  []string
+	MinPrice  int
+	MaxPrice  int
+	Tags      []string
+	Priority  int
+	Stop      bool
+}
+
+// Target is a resolved destination: which bot posts to which channel
+type Target struct {
+	Config    *Config
+	ChannelID string
+	RouteID   string
+}
+
+// Key identifies the bot and channel, for deduplicating targets
+func (t Target) Key() string {
+	return t.Config.ID + "|" + t.ChannelID
+}
+
+// LoadRoutes returns the enabled routes for a module in evaluation order
+func LoadRoutes(app core.App, module string) ([]*Route, error) {
+	records, err := app.FindRecordsByFilter(
+		"discord_routes",
+		"enabled = true && module = {:module}",
+		"priority,created",
+		0, 0,
+		map[string]any{"module": module},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make([]*Route, 0, len(records))
+	for _, record := range records {
+		routes = append(routes, routeFromRecord(record))
+	}
+	return routes, nil
+}
+
+func routeFromRecord(record *core.Record) *Route {
+	route := &Route{
+		ID:        record.Id,
+		Name:      record.GetString("name"),
+		ConfigID:  record.GetString("config"),
+		Module:    record.GetString("module"),
+		GuildID:   record.GetString("guild_id"),
+		ChannelID: record.GetString("channel_id"),
+		MinPrice:  record.GetInt("min_price"),
+		MaxPrice:  record.GetInt("max_price"),
+		Priority:  record.GetInt("priority"),
+		Stop:      record.GetBool("stop"),
+	}
+	for field, dest := range map[string]*[]string{"counties": &route.Counties, "statuses": &route.Statuses, "tags": &route.Tags} {
+		if err := record.UnmarshalJSONField(field, dest); err != nil {
+			log.Printf("[DISCORD] Invalid %s on route %s: %v", field, record.Id, err)
+		}
+	}
+	return route
+}
+
+// Matches reports whether the subject satisfies every criterion of the route
+func (r *Route) Matches(subject Subject) bool {
+	if r.MinPrice > 0 && subject.Price < r.MinPrice {
+		return false
+	}
+	if r.MaxPrice > 0 && subject.Price > r.MaxPrice {
+		return false
+	}
+	if len(r.Counties) > 0 && !containsFold(r.Counties, subject.County) {
+		return false
+	}
+	if len(r.Statuses) > 0 && !containsFold(r.Statuses, subject.Status) {
+		return false
+	}
+	if len(r.Tags) > 0 {
+		found := false
+		for _, tag := range subject.Tags {
+			if containsFold(r.Tags, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), strings.TrimSpace(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveTargets returns every channel a module's message should be posted
+// to. Matching routes are collected in priority order until one with stop
+// set matches. If none match, the default bot's default channel is used.
+func ResolveTargets(app core.App, module string, subject Subject) ([]Target, error) {
+	routes, err := LoadRoutes(app, module)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []Target
+	seen := map[string]bool{}
+	configs := map[string]*Config{}
+
+	for _, route := range routes {
+		if !route.Matches(subject) {
+			continue
+		}
+
+		config, ok := configs[route.ConfigID]
+		if !ok {
+			config, err = GetConfigByID(app, route.ConfigID)
+			if err != nil {
+				log.Printf("[DISCORD] Skipping route %s: %v", route.ID, err)
+				continue
+			}
+			configs[route.ConfigID] = config
+		}
+
+		target := Target{Config: config, ChannelID: route.ChannelID, RouteID: route.ID}
+		if !seen[target.Key()] {
+			seen[target.Key()] = true
+			targets = append(targets, target)
+		}
+
+		if route.Stop {
+			break
+		}
+	}
+
+	if len(targets) > 0 {
+		return targets, nil
+	}
+
+	config, err := GetDefaultConfig(app)
+	if err != nil {
+		return nil, err
+	}
+	if config.DefaultChannelID == "" {
+		return nil, fmt.Errorf("no discord route matched and the default config has no default channel")
+	}
+	return []Target{{Config: config, ChannelID: config.DefaultChannelID}}, nil
+}
@@ -0,0 +1,323 @@
+package discord
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Environment variables holding the secret encryption keys: 32 bytes,
+// base64 or hex encoded. The previous key is only used for decryption, so
+// keys can be rotated by moving the old key to DISCORD_SECRET_KEY_PREVIOUS;
+// stored secrets are re-encrypted with the new key. Each can instead be
+// read from a file named by the same variable with a _FILE suffix. Files
+// are re-read on use, so keys rotated that way apply without a restart.
+const (
+	secretKeyEnv         = "DISCORD_SECRET_KEY"
+	previousSecretKeyEnv = "DISCORD_SECRET_KEY_PREVIOUS"
+)
+
+// encryptedPrefix marks values encrypted with AES-256-GCM
+const encryptedPrefix = "enc:v1:"
+
+// secretFields are the discord_config fields encrypted at rest
+var secretFields = []string{"bot_token"}
+
+// ErrConfigExposed is returned instead of calling Discord while the
+// discord_config collection is accessible to non-superusers
+var ErrConfigExposed = errors.New("discord_config is accessible to non-superusers; refusing to use its bot tokens")
+
+// ErrNoSecretKey is returned when saving or using a secret without a key
+var ErrNoSecretKey = fmt.Errorf("%s is not set; bot tokens can't be stored or used unencrypted", secretKeyEnv)
+
+// configExposed is set by CheckConfigAccess
+var configExposed atomic.Bool
+
+var (
+	secretKeysMu  sync.Mutex
+	secretKeyRaw  [2]string // last values read, to skip decoding unchanged keys
+	secretKeys    [][]byte  // current key first
+	secretKeysErr error
+)
+
+// loadSecretKeys returns the configured keys, current first. It re-reads
+// them on every call and logs when the current key changes.
+func loadSecretKeys() ([][]byte, error) {
+	var raw [2]string
+	for i, env := range []string{secretKeyEnv, previousSecretKeyEnv} {
+		value, err := secretKeyValue(env)
+		if err != nil {
+			return nil, err
+		}
+		raw[i] = value
+	}
+
+	secretKeysMu.Lock()
+	defer secretKeysMu.Unlock()
+	if raw == secretKeyRaw && (secretKeys != nil || secretKeysErr != nil) {
+		return secretKeys, secretKeysErr
+	}
+
+	if secretKeyRaw[0] != "" && raw[0] != secretKeyRaw[0] {
+		log.Printf("[DISCORD] %s changed; new secrets use the new key", secretKeyEnv)
+	}
+	secretKeyRaw = raw
+	secretKeys, secretKeysErr = [][]byte{}, nil
+	if raw[0] == "" {
+		return secretKeys, nil
+	}
+	for i, env := range []string{secretKeyEnv, previousSecretKeyEnv} {
+		if raw[i] == "" {
+			continue
+		}
+		key, err := decodeSecretKey(raw[i])
+		if err != nil {
+			secretKeys, secretKeysErr = nil, fmt.Errorf("invalid %s: %w", env, err)
+			return nil, secretKeysErr
+		}
+		secretKeys = append(secretKeys, key)
+	}
+	return secretKeys, nil
+}
+
+// secretKeyValue reads a key from env, or from the file named by env_FILE
+func secretKeyValue(env string) (string, error) {
+	if path := strings.TrimSpace(os.Getenv(env + "_FILE")); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s_FILE: %w", env, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return strings.TrimSpace(os.Getenv(env)), nil
+}
+
+func decodeSecretKey(value string) ([]byte, error) {
+	if key, err := hex.DecodeString(value); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(value); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, errors.New("expected 32 bytes, hex or base64 encoded")
+}
+
+func isEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// encryptSecret encrypts a value with the current key
+func encryptSecret(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret returns the plaintext of a stored value. Values stored
+// unencrypted are refused; ReencryptSecrets encrypts them once a key is set.
+func decryptSecret(value string) (string, error) {
+	keys, err := loadSecretKeys()
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", ErrNoSecretKey
+	}
+	if !isEncrypted(value) {
+		return "", errors.New("secret is stored unencrypted; it is encrypted on the next key check")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted secret: %w", err)
+	}
+
+	for _, key := range keys {
+		gcm, err := newGCM(key)
+		if err != nil {
+			return "", err
+		}
+		if len(sealed) < gcm.NonceSize() {
+			return "", errors.New("invalid encrypted secret: too short")
+		}
+		plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+		if err == nil {
+			return string(plaintext), nil
+		}
+	}
+	return "", errors.New("failed to decrypt secret with any configured key")
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// RegisterHooks encrypts secrets whenever a discord_config record is saved,
+// whether from the dashboard, the API or code, and re-checks the
+// collection's API rules when they change. Tokens are read from the
+// database for every request, so rotating a bot token only needs the record
+// to be updated.
+func RegisterHooks(app *pocketbase.PocketBase) {
+	encrypt := func(e *core.RecordEvent) error {
+		if err := encryptRecordSecrets(e.Record); err != nil {
+			return err
+		}
+		return e.Next()
+	}
+	app.OnRecordCreateExecute("discord_config").BindFunc(encrypt)
+	app.OnRecordUpdateExecute("discord_config").BindFunc(encrypt)
+
+	app.OnCollectionAfterUpdateSuccess("discord_config").BindFunc(func(e *core.CollectionEvent) error {
+		checkCollectionAccess(e.Collection)
+		return e.Next()
+	})
+}
+
+// encryptRecordSecrets encrypts any plaintext secret fields on the record.
+// Without a key configured, records with secrets can't be saved.
+func encryptRecordSecrets(record *core.Record) error {
+	keys, err := loadSecretKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, field := range secretFields {
+		value := record.GetString(field)
+		if value == "" || isEncrypted(value) {
+			continue
+		}
+		if len(keys) == 0 {
+			return ErrNoSecretKey
+		}
+		encrypted, err := encryptSecret(keys[0], value)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", field, err)
+		}
+		record.Set(field, encrypted)
+	}
+	return nil
+}
+
+// ReencryptSecrets encrypts secrets stored in plaintext and re-encrypts those
+// encrypted with a previous key, so every stored secret uses the current key.
+// It returns the number of configs rewritten. Without a key it fails, since
+// no bot token can be used.
+func ReencryptSecrets(app core.App) (int, error) {
+	keys, err := loadSecretKeys()
+	if err != nil {
+		return 0, err
+	}
+	if len(keys) == 0 {
+		return 0, ErrNoSecretKey
+	}
+
+	records, err := app.FindRecordsByFilter("discord_config", "", "", 0, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, record := range records {
+		changed := false
+		for _, field := range secretFields {
+			value := record.GetString(field)
+			if value == "" {
+				continue
+			}
+			// Only rewrite values not already readable with the current key
+			if isEncrypted(value) && decryptsWith(keys[0], value) {
+				continue
+			}
+			plaintext := value
+			if isEncrypted(value) {
+				if plaintext, err = decryptSecret(value); err != nil {
+					return updated, fmt.Errorf("%s %s: %w", record.GetString("name"), field, err)
+				}
+			}
+			current, err := encryptSecret(keys[0], plaintext)
+			if err != nil {
+				return updated, err
+			}
+			record.Set(field, current)
+			changed = true
+		}
+		if changed {
+			if err := app.Save(record); err != nil {
+				return updated, fmt.Errorf("failed to save %s: %w", record.GetString("name"), err)
+			}
+			updated++
+		}
+	}
+
+	if updated > 0 {
+		log.Printf("[DISCORD] Re-encrypted secrets for %d bot configs", updated)
+	}
+	return updated, nil
+}
+
+func decryptsWith(key []byte, value string) bool {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return false
+	}
+	gcm, err := newGCM(key)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return false
+	}
+	_, err = gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	return err == nil
+}
+
+// CheckConfigAccess blocks all Discord requests while discord_config can be
+// read or changed by anyone other than superusers. A nil rule means
+// superusers only; any other rule, even a restrictive one, exposes tokens,
+// or lets whoever it admits swap in their own bot or channel.
+func CheckConfigAccess(app *pocketbase.PocketBase) error {
+	collection, err := app.FindCollectionByNameOrId("discord_config")
+	if err != nil {
+		return err
+	}
+	if !checkCollectionAccess(collection) {
+		return ErrConfigExposed
+	}
+	return nil
+}
+
+// checkCollectionAccess updates the block flag and reports whether the
+// collection is safe
+func checkCollectionAccess(collection *core.Collection) bool {
+	exposed := collection.ListRule != nil || collection.ViewRule != nil ||
+		collection.CreateRule != nil || collection.UpdateRule != nil || collection.DeleteRule != nil
+	if exposed {
+		log.Printf("[DISCORD] ERROR: %v. Clear all API rules of discord_config to resume posting.", ErrConfigExposed)
+	} else if configExposed.Load() {
+		log.Printf("[DISCORD] discord_config is restricted to superusers again; posting resumed")
+	}
+	configExposed.Store(exposed)
+	return !exposed
+}
@@ -0,0 +1,106 @@
+package discord
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	testKey      = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	testOtherKey = "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+)
+
+func TestEncryptDecryptSecret(t *testing.T) {
+	t.Setenv(secretKeyEnv, testKey)
+	t.Setenv(previousSecretKeyEnv, "")
+
+	keys, err := loadSecretKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := encryptSecret(keys[0], "bot-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncrypted(encrypted) || strings.Contains(encrypted, "bot-token") {
+		t.Fatalf("Expected an encrypted value, got %q", encrypted)
+	}
+
+	again, _ := encryptSecret(keys[0], "bot-token")
+	if again == encrypted {
+		t.Error("Expected a fresh nonce for every encryption")
+	}
+
+	plaintext, err := decryptSecret(encrypted)
+	if err != nil || plaintext != "bot-token" {
+		t.Fatalf("decryptSecret = %q, %v", plaintext, err)
+	}
+
+	if _, err := decryptSecret("bot-token"); err == nil {
+		t.Error("Expected a plaintext value to be refused")
+	}
+
+	// Rotated: the old key is only used to decrypt
+	t.Setenv(secretKeyEnv, testOtherKey)
+	t.Setenv(previousSecretKeyEnv, testKey)
+	if plaintext, err := decryptSecret(encrypted); err != nil || plaintext != "bot-token" {
+		t.Errorf("Expected the previous key to decrypt, got %q, %v", plaintext, err)
+	}
+
+	t.Setenv(previousSecretKeyEnv, "")
+	if _, err := decryptSecret(encrypted); err == nil {
+		t.Error("Expected decryption with the wrong key to fail")
+	}
+}
+
+func TestSecretsRequireKey(t *testing.T) {
+	t.Setenv(secretKeyEnv, "")
+	t.Setenv(previousSecretKeyEnv, "")
+
+	record := core.NewRecord(core.NewBaseCollection("discord_config"))
+	record.Set("bot_token", "bot-token")
+	if err := encryptRecordSecrets(record); !errors.Is(err, ErrNoSecretKey) {
+		t.Errorf("Expected ErrNoSecretKey when saving without a key, got %v", err)
+	}
+	if _, err := decryptSecret("enc:v1:abc"); !errors.Is(err, ErrNoSecretKey) {
+		t.Errorf("Expected ErrNoSecretKey when reading without a key, got %v", err)
+	}
+
+	t.Setenv(secretKeyEnv, "too-short")
+	if _, err := loadSecretKeys(); err == nil {
+		t.Error("Expected an invalid key to be rejected")
+	}
+}
+
+func TestSecretKeyFileIsReread(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte(testKey+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(secretKeyEnv, "")
+	t.Setenv(secretKeyEnv+"_FILE", path)
+	t.Setenv(previousSecretKeyEnv, "")
+
+	record := core.NewRecord(core.NewBaseCollection("discord_config"))
+	record.Set("bot_token", "bot-token")
+	if err := encryptRecordSecrets(record); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := record.GetString("bot_token")
+
+	if err := os.WriteFile(path, []byte(testOtherKey), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := loadSecretKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decryptsWith(keys[0], encrypted) {
+		t.Error("Expected the rotated key file to be picked up without a restart")
+	}
+}
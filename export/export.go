@@ -0,0 +1,338 @@
+// Package export streams collection records as CSV, JSON Lines or XLSX for
+// copying into spreadsheets. Records are read and written in batches, so
+// memory stays flat however large the export is.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/search"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Records read per query
+const batchSize = 500
+
+// Column is an exported column and how to read it from a record
+type Column struct {
+	Name  string
+	Value func(record *core.Record) any
+}
+
+// Field exports a record field as is
+func Field(name string) Column {
+	return Column{Name: name, Value: func(record *core.Record) any {
+		return record.Get(name)
+	}}
+}
+
+// ExpandedField exports a field of an expanded relation, named as
+func ExpandedField(relation, field, as string) Column {
+	return Column{Name: as, Value: func(record *core.Record) any {
+		if related := record.ExpandedOne(relation); related != nil {
+			return related.Get(field)
+		}
+		return nil
+	}}
+}
+
+// Dataset describes an exportable collection
+type Dataset struct {
+	Collection string
+	// DateField is filtered by the from and to parameters
+	DateField string
+	// Columns defaults to the id and every non-hidden field
+	Columns []Column
+	// Expand lists relations the columns read through ExpandedField
+	Expand []string
+}
+
+// Handler returns a route handler that streams the dataset. It takes:
+//
+//	format  csv (default), jsonl or xlsx
+//	filter  a PocketBase filter expression
+//	from    start date, inclusive (2006-01-02 or RFC 3339)
+//	to      end date; a plain date includes the whole day
+func Handler(dataset Dataset) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		return Stream(e, dataset)
+	}
+}
+
+// Stream writes the dataset selected by the request's parameters
+func Stream(e *core.RequestEvent, dataset Dataset) error {
+	query := e.Request.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = FormatCSV
+	}
+	if !slices.Contains(Formats, format) {
+		return e.JSON(http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("format must be one of %s", strings.Join(Formats, ", ")),
+		})
+	}
+
+	collection, err := e.App.FindCollectionByNameOrId(dataset.Collection)
+	if err != nil {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": dataset.Collection + " collection not found"})
+	}
+
+	filter, resolver, err := buildFilter(e, collection, dataset, query.Get("filter"), query.Get("from"), query.Get("to"))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	columns := dataset.Columns
+	if len(columns) == 0 {
+		columns = defaultColumns(collection)
+	}
+	next := batches(e.App, collection, dataset, filter, resolver)
+
+	// Read the first batch before writing anything, so a bad filter still
+	// gets a proper error response
+	records, err := next()
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid filter: " + err.Error()})
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", dataset.Collection, time.Now().UTC().Format("20060102-150405"), format)
+	e.Response.Header().Set("Content-Type", ContentType(format))
+	e.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	e.Response.WriteHeader(http.StatusOK)
+
+	// Headers are sent, so errors from here on can only be logged
+	if err := write(e, format, dataset.Collection, columns, records, next); err != nil {
+		log.Printf("[EXPORT] Error exporting %s: %v", dataset.Collection, err)
+	}
+	return nil
+}
+
+func write(e *core.RequestEvent, format, sheet string, columns []Column, records []*core.Record, next func() ([]*core.Record, error)) error {
+	w, err := NewRowWriter(format, e.Response, sheet)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+	if err := w.WriteHeader(names); err != nil {
+		return err
+	}
+
+	flusher := http.NewResponseController(e.Response)
+	values := make([]any, len(columns))
+	for {
+		for _, record := range records {
+			for i, column := range columns {
+				values[i] = cellValue(column.Value(record))
+			}
+			if err := w.WriteRow(values); err != nil {
+				return err
+			}
+		}
+		_ = flusher.Flush()
+
+		if len(records) < batchSize {
+			break
+		}
+		if records, err = next(); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return flusher.Flush()
+}
+
+// cellValue converts record values to plain types the writers understand
+func cellValue(value any) any {
+	switch v := value.(type) {
+	case types.DateTime:
+		if v.IsZero() {
+			return nil
+		}
+		return v.Time().UTC().Format(time.RFC3339)
+	case types.JSONRaw:
+		if len(v) == 0 || string(v) == "null" {
+			return nil
+		}
+		return json.RawMessage(v)
+	case []string:
+		return strings.Join(v, ", ")
+	}
+	return value
+}
+
+// defaultColumns exports the id and every field that isn't hidden
+func defaultColumns(collection *core.Collection) []Column {
+	columns := []Column{}
+	for _, field := range collection.Fields {
+		if field.GetHidden() || field.Type() == core.FieldTypePassword {
+			continue
+		}
+		columns = append(columns, Field(field.GetName()))
+	}
+	return columns
+}
+
+// batches returns a function reading the next batch of records on each
+// call. Records are ordered by DateField, oldest first, and then by id, and
+// each batch starts after the last record of the previous one.
+func batches(app core.App, collection *core.Collection, dataset Dataset, filter dbx.Expression, resolver *core.RecordFieldResolver) func() ([]*core.Record, error) {
+	id := column(collection, "id")
+	var last *core.Record
+
+	return func() ([]*core.Record, error) {
+		query := app.RecordQuery(collection).Limit(batchSize)
+		if filter != nil {
+			query.AndWhere(filter)
+		}
+		if dataset.DateField != "" {
+			date := column(collection, dataset.DateField)
+			query.OrderBy(date+" ASC", id+" ASC")
+			if last != nil {
+				query.AndWhere(dbx.NewExp(
+					fmt.Sprintf("%s > {:lastDate} OR (%s = {:lastDate} AND %s > {:lastId})", date, date, id),
+					dbx.Params{"lastDate": last.GetString(dataset.DateField), "lastId": last.Id},
+				))
+			}
+		} else {
+			query.OrderBy(id + " ASC")
+			if last != nil {
+				query.AndWhere(dbx.NewExp(id+" > {:lastId}", dbx.Params{"lastId": last.Id}))
+			}
+		}
+		if err := resolver.UpdateQuery(query); err != nil {
+			return nil, err
+		}
+
+		records := []*core.Record{}
+		if err := query.All(&records); err != nil {
+			return nil, err
+		}
+		if len(records) > 0 {
+			last = records[len(records)-1]
+		}
+		if len(dataset.Expand) > 0 {
+			if errs := app.ExpandRecords(records, dataset.Expand, nil); len(errs) > 0 {
+				return nil, fmt.Errorf("failed to expand records: %v", errs)
+			}
+		}
+		return records, nil
+	}
+}
+
+func column(collection *core.Collection, field string) string {
+	return fmt.Sprintf("[[%s.%s]]", collection.Name, field)
+}
+
+// buildFilter combines the user filter with the date range
+func buildFilter(e *core.RequestEvent, collection *core.Collection, dataset Dataset, filter, from, to string) (dbx.Expression, *core.RecordFieldResolver, error) {
+	expr, resolver, err := UserFilter(e, collection, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	parts := []dbx.Expression{}
+	if expr != nil {
+		parts = append(parts, expr)
+	}
+
+	if from != "" || to != "" {
+		if dataset.DateField == "" {
+			return nil, nil, fmt.Errorf("%s has no date range", dataset.Collection)
+		}
+	}
+	if from != "" {
+		start, _, err := parseDate(from)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid from: %w", err)
+		}
+		parts = append(parts, dbx.NewExp(column(collection, dataset.DateField)+" >= {:exportFrom}",
+			dbx.Params{"exportFrom": start.UTC().Format(types.DefaultDateLayout)}))
+	}
+	if to != "" {
+		end, dateOnly, err := parseDate(to)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid to: %w", err)
+		}
+		op := "<="
+		if dateOnly {
+			end = end.AddDate(0, 0, 1)
+			op = "<"
+		}
+		parts = append(parts, dbx.NewExp(fmt.Sprintf("%s %s {:exportTo}", column(collection, dataset.DateField), op),
+			dbx.Params{"exportTo": end.UTC().Format(types.DefaultDateLayout)}))
+	}
+
+	if len(parts) == 0 {
+		return nil, resolver, nil
+	}
+	return dbx.And(parts...), resolver, nil
+}
+
+// superuserOnlyFilterFields can't be used in caller supplied filters, as
+// in the records API
+var superuserOnlyFilterFields = []string{"@collection.", "@request."}
+
+// CheckUserFields fails if a caller supplied filter or sort uses
+// superuser-only identifiers, as the records API does. Routes that hand the
+// raw query to a search provider check it with this.
+func CheckUserFields(values ...string) error {
+	for _, value := range values {
+		for _, field := range superuserOnlyFilterFields {
+			if strings.Contains(value, field) {
+				return fmt.Errorf("%s fields can't be used", strings.TrimSuffix(field, "."))
+			}
+		}
+	}
+	return nil
+}
+
+// UserFilter builds a caller supplied filter the way the records API does:
+// hidden fields and superuser-only identifiers can't be used. The returned
+// resolver adds the joins the filter needs to a query and is returned even
+// when the filter is empty.
+func UserFilter(e *core.RequestEvent, collection *core.Collection, filter string) (dbx.Expression, *core.RecordFieldResolver, error) {
+	info, err := e.RequestInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	resolver := core.NewRecordFieldResolver(e.App, collection, info, false)
+	if strings.TrimSpace(filter) == "" {
+		return nil, resolver, nil
+	}
+
+	if err := CheckUserFields(filter); err != nil {
+		return nil, nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	expr, err := search.FilterData(filter).BuildExpr(resolver)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	return expr, resolver, nil
+}
+
+// parseDate accepts a plain date or an RFC 3339 timestamp
+func parseDate(value string) (t time.Time, dateOnly bool, err error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true, nil
+	}
+	t, err = time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, false, fmt.Errorf("use YYYY-MM-DD or RFC 3339")
+	}
+	return t, false, nil
+}
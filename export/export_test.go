@@ -0,0 +1,135 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func newTestApp(t *testing.T) *pocketbase.PocketBase {
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RunAllMigrations(); err != nil {
+		t.Fatal(err)
+	}
+
+	collection := core.NewBaseCollection("kills")
+	collection.Fields.Add(
+		&core.NumberField{Name: "event_id"},
+		&core.DateField{Name: "timestamp"},
+		&core.TextField{Name: "secret", Hidden: true},
+	)
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	// Few distinct timestamps, so batches end in the middle of a tie
+	base := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	err := app.RunInTransaction(func(tx core.App) error {
+		for i := range 2*batchSize + 3 {
+			record := core.NewRecord(collection)
+			record.Set("event_id", i)
+			record.Set("timestamp", base.Add(time.Duration(i%3)*24*time.Hour))
+			record.Set("secret", "s")
+			if err := tx.Save(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func stream(app core.App, url string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	e := &core.RequestEvent{App: app}
+	e.Request = httptest.NewRequest(http.MethodGet, url, nil)
+	e.Response = recorder
+	Stream(e, Dataset{Collection: "kills", DateField: "timestamp"})
+	return recorder
+}
+
+func TestStreamPagesThroughTies(t *testing.T) {
+	app := newTestApp(t)
+
+	response := stream(app, "/?format=jsonl")
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body)
+	}
+
+	seen := map[int]bool{}
+	lastTimestamp := ""
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		var row struct {
+			EventID   int    `json:"event_id"`
+			Timestamp string `json:"timestamp"`
+			Secret    string `json:"secret"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatal(err)
+		}
+		if seen[row.EventID] {
+			t.Fatalf("Event %d exported twice", row.EventID)
+		}
+		if row.Timestamp < lastTimestamp {
+			t.Fatalf("Expected rows oldest first, got %s after %s", row.Timestamp, lastTimestamp)
+		}
+		if row.Secret != "" {
+			t.Fatal("Expected hidden fields to be left out")
+		}
+		seen[row.EventID] = true
+		lastTimestamp = row.Timestamp
+	}
+	if len(seen) != 2*batchSize+3 {
+		t.Errorf("Expected %d rows, got %d", 2*batchSize+3, len(seen))
+	}
+}
+
+func TestStreamFilters(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		url    string
+		status int
+		rows   int
+	}{
+		{"/?format=jsonl&filter=event_id<10", http.StatusOK, 10},
+		{"/?format=jsonl&from=2025-06-02&to=2025-06-02", http.StatusOK, (2*batchSize + 3) / 3},
+		{"/?format=jsonl&filter=event_id<10&from=2025-06-03", http.StatusOK, 3},
+		{"/?filter=secret='s'", http.StatusBadRequest, 0},
+		{"/?filter=@collection.kills.event_id>0", http.StatusBadRequest, 0},
+		{"/?filter=@request.headers.x='y'", http.StatusBadRequest, 0},
+		{"/?filter=nope>1", http.StatusBadRequest, 0},
+		{"/?from=yesterday", http.StatusBadRequest, 0},
+		{"/?format=xml", http.StatusBadRequest, 0},
+	}
+	for _, test := range tests {
+		response := stream(app, test.url)
+		if response.Code != test.status {
+			t.Errorf("%s: expected %d, got %d: %s", test.url, test.status, response.Code, response.Body)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		rows := 0
+		for scanner := bufio.NewScanner(response.Body); scanner.Scan(); {
+			rows++
+		}
+		if rows != test.rows {
+			t.Errorf("%s: expected %d rows, got %d", test.url, test.rows, rows)
+		}
+	}
+}
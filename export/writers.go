@@ -0,0 +1,144 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Export formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	FormatXLSX  = "xlsx"
+)
+
+// Formats lists the supported export formats
+var Formats = []string{FormatCSV, FormatJSONL, FormatXLSX}
+
+// RowWriter writes rows of a table as they are produced, so an export never
+// holds more than one batch in memory
+type RowWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []any) error
+	// Close finishes the output; it does not close the underlying writer
+	Close() error
+}
+
+// NewRowWriter creates a writer for a format. sheet names the XLSX
+// worksheet and is ignored by the other formats.
+func NewRowWriter(format string, w io.Writer, sheet string) (RowWriter, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case FormatJSONL:
+		return &jsonlWriter{w: w}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w, sheet), nil
+	}
+	return nil, fmt.Errorf("unknown format %q; use %s", format, strings.Join(Formats, ", "))
+}
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSONL:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) WriteHeader(columns []string) error {
+	return c.w.Write(columns)
+}
+
+func (c *csvWriter) WriteRow(values []any) error {
+	row := make([]string, len(values))
+	for i, value := range values {
+		row[i] = formatText(value)
+	}
+	return c.w.Write(row)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonlWriter writes one object per row, keeping the column order
+type jsonlWriter struct {
+	w    io.Writer
+	keys [][]byte
+	buf  bytes.Buffer
+}
+
+func (j *jsonlWriter) WriteHeader(columns []string) error {
+	j.keys = make([][]byte, len(columns))
+	for i, column := range columns {
+		key, err := json.Marshal(column)
+		if err != nil {
+			return err
+		}
+		j.keys[i] = key
+	}
+	return nil
+}
+
+func (j *jsonlWriter) WriteRow(values []any) error {
+	j.buf.Reset()
+	enc := json.NewEncoder(&j.buf)
+	enc.SetEscapeHTML(false)
+
+	j.buf.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			j.buf.WriteByte(',')
+		}
+		j.buf.Write(j.keys[i])
+		j.buf.WriteByte(':')
+		if err := enc.Encode(value); err != nil {
+			return err
+		}
+		// Encode ends each value with a newline
+		j.buf.Truncate(j.buf.Len() - 1)
+	}
+	j.buf.WriteString("}\n")
+
+	_, err := j.w.Write(j.buf.Bytes())
+	return err
+}
+
+func (j *jsonlWriter) Close() error {
+	return nil
+}
+
+// formatText renders a value for text formats. Nil is empty, and JSON
+// values such as arrays are written as JSON.
+func formatText(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	case bool, int, int64, float64:
+		return fmt.Sprint(v)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
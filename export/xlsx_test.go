@@ -0,0 +1,89 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := newXLSXWriter(&buf, "kills")
+	if err := w.WriteHeader([]string{"name", "count", "ok"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow([]any{`<a & "b">`, 3, true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow([]any{nil, 1.5, false}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(data)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("Missing %s", name)
+		}
+	}
+	if !strings.Contains(files["xl/workbook.xml"], `<sheet name="kills"`) {
+		t.Errorf("Expected the sheet to be named kills: %s", files["xl/workbook.xml"])
+	}
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	for _, cell := range []string{
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">name</t></is></c>`,
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">&lt;a &amp; &#34;b&#34;&gt;</t></is></c>`,
+		`<c r="B2"><v>3</v></c>`,
+		`<c r="C2" t="b"><v>1</v></c>`,
+		`<row r="3"><c r="B3"><v>1.5</v></c>`,
+	} {
+		if !strings.Contains(sheet, cell) {
+			t.Errorf("Expected %s in the sheet:\n%s", cell, sheet)
+		}
+	}
+	if !strings.HasSuffix(sheet, xlsxSheetEnd) {
+		t.Error("Expected the sheet to be closed")
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	for i, expected := range map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumn(i); got != expected {
+			t.Errorf("xlsxColumn(%d) = %s, expected %s", i, got, expected)
+		}
+	}
+}
+
+func TestXLSXSheetName(t *testing.T) {
+	if got := xlsxSheetName("a/b:c"); got != "a_b_c" {
+		t.Errorf("Expected invalid characters to be replaced, got %q", got)
+	}
+	if got := xlsxSheetName(""); got != "Sheet1" {
+		t.Errorf("Expected a default name, got %q", got)
+	}
+
+	long := strings.Repeat("é", 40)
+	got := xlsxSheetName(long)
+	if got != strings.Repeat("é", xlsxMaxSheetName) {
+		t.Errorf("Expected the name truncated to %d characters, got %q", xlsxMaxSheetName, got)
+	}
+}
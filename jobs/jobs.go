@@ -0,0 +1,356 @@
+// Package jobs runs background work on PocketBase's cron. Every job gets an
+// overlap guard, a per-run timeout and jitter, and each run is recorded in
+// the job_runs collection. Superusers can list, trigger, pause and resume
+// jobs over the API.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/cron"
+)
+
+// The runner checks for due jobs every second, so intervals shorter than
+// the cron's one-minute resolution still work
+const tickInterval = time.Second
+
+// Runs without a Timeout are cancelled after this long
+const defaultTimeout = 10 * time.Minute
+
+// Run triggers
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// Errors returned by Trigger
+var (
+	ErrNotFound = errors.New("job not found")
+	ErrRunning  = errors.New("job is already running")
+	ErrDisabled = errors.New("job is disabled")
+)
+
+// Counts are the figures a run reports, such as items fetched and saved
+type Counts map[string]int
+
+// Job is a unit of background work. Set either Schedule or Every.
+type Job struct {
+	Name string
+	// Schedule is a cron expression; the job runs once in each minute it
+	// matches
+	Schedule string
+	// Every returns the pause between the end of one run and the start of
+	// the next. It is read on every tick, so settings changes apply at once.
+	Every func() time.Duration
+	// RunAtStart runs an Every job as soon as the runner starts instead of
+	// after the first interval
+	RunAtStart bool
+	// Timeout cancels the run's context; zero means ten minutes
+	Timeout time.Duration
+	// Jitter delays each scheduled run by a random amount up to this long
+	Jitter time.Duration
+	// Enabled gates scheduled and manual runs, e.g. on a module switch.
+	// Nil means always enabled.
+	Enabled func() bool
+	// Run does the work. It should stop when ctx is done.
+	Run func(ctx context.Context) (Counts, error)
+}
+
+func (j Job) enabled() bool {
+	return j.Enabled == nil || j.Enabled()
+}
+
+func (j Job) timeout() time.Duration {
+	if j.Timeout > 0 {
+		return j.Timeout
+	}
+	return defaultTimeout
+}
+
+// entry is a job and its scheduling state
+type entry struct {
+	job     Job
+	running atomic.Bool
+	paused  atomic.Bool
+	// Set by Wake; the job runs on the next tick it isn't running
+	woken atomic.Bool
+
+	mu sync.Mutex
+	// Schedule jobs: the last minute a run was started in
+	lastMinute time.Time
+	// Every jobs: when the last run ended and the jitter before the next
+	lastEnd time.Time
+	delay   time.Duration
+}
+
+// Runner schedules and runs jobs
+type Runner struct {
+	app   *pocketbase.PocketBase
+	cron  *cron.Cron
+	mu    sync.RWMutex
+	jobs  map[string]*entry
+	order []string
+}
+
+// NewRunner creates a runner. Add jobs, then call Start.
+func NewRunner(app *pocketbase.PocketBase) *Runner {
+	c := cron.New()
+	c.SetInterval(tickInterval)
+	return &Runner{
+		app:  app,
+		cron: c,
+		jobs: map[string]*entry{},
+	}
+}
+
+// Add registers a job. Names must be unique.
+func (r *Runner) Add(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return fmt.Errorf("job needs a name and a Run function")
+	}
+	if (job.Schedule == "") == (job.Every == nil) {
+		return fmt.Errorf("job %s needs exactly one of Schedule and Every", job.Name)
+	}
+
+	expr := job.Schedule
+	if expr == "" {
+		expr = "* * * * *"
+	}
+	e := &entry{job: job, lastEnd: time.Now()}
+	if job.RunAtStart {
+		e.lastEnd = time.Time{}
+	}
+	e.delay = jitter(job.Jitter)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.jobs[job.Name]; exists {
+		return fmt.Errorf("job %s is already registered", job.Name)
+	}
+	if err := r.cron.Add(job.Name, expr, func() { r.tick(e) }); err != nil {
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	r.jobs[job.Name] = e
+	r.order = append(r.order, job.Name)
+	return nil
+}
+
+// MustAdd is Add for jobs defined in code, where an error is a bug
+func (r *Runner) MustAdd(job Job) {
+	if err := r.Add(job); err != nil {
+		panic(err)
+	}
+}
+
+// Start restores paused jobs, closes runs left open by a previous process
+// and starts the schedule. The runner stops when the app terminates.
+func (r *Runner) Start() {
+	r.MustAdd(Job{
+		Name:     "job_runs_cleanup",
+		Schedule: "30 * * * *",
+		Run:      r.pruneRuns,
+	})
+
+	r.loadPaused()
+	r.closeInterruptedRuns()
+
+	r.app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+		r.cron.Stop()
+		return e.Next()
+	})
+	r.cron.Start()
+	log.Printf("[JOBS] Started %d jobs", len(r.order))
+}
+
+func (r *Runner) get(name string) *entry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.jobs[name]
+}
+
+// tick runs a job if it is due. The cron calls it every tick for Every jobs
+// and on each tick of a matching minute for Schedule jobs.
+func (r *Runner) tick(e *entry) {
+	if e.paused.Load() || e.running.Load() || !e.job.enabled() || !e.due(time.Now()) {
+		return
+	}
+	if _, err := r.start(e, TriggerSchedule, nil); err != nil && !errors.Is(err, ErrRunning) {
+		log.Printf("[JOBS] Error starting %s: %v", e.job.Name, err)
+	}
+}
+
+func (e *entry) due(now time.Time) bool {
+	if e.woken.CompareAndSwap(true, false) {
+		return true
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.job.Schedule != "" {
+		minute := now.Truncate(time.Minute)
+		if !minute.After(e.lastMinute) {
+			return false
+		}
+		e.lastMinute = minute
+		return true
+	}
+	return !now.Before(e.lastEnd.Add(e.job.Every() + e.delay))
+}
+
+// Trigger runs a job now, ignoring its schedule, pause and jitter. It
+// returns the id of the job_runs record.
+func (r *Runner) Trigger(name string) (string, error) {
+	e := r.get(name)
+	if e == nil {
+		return "", ErrNotFound
+	}
+	if !e.job.enabled() {
+		return "", ErrDisabled
+	}
+	return r.start(e, TriggerManual, nil)
+}
+
+// Wake asks for an early scheduled run of a job, e.g. when a hook has
+// queued work for it. The job runs on the next tick, or right after the
+// current run ends, unless it is paused or disabled. Wakes before that run
+// are merged into it.
+func (r *Runner) Wake(name string) error {
+	e := r.get(name)
+	if e == nil {
+		return ErrNotFound
+	}
+	e.woken.Store(true)
+	return nil
+}
+
+// TriggerWait is Trigger for callers that report the outcome, such as chat
+// commands. The channel receives the result once the run ends or times out.
+func (r *Runner) TriggerWait(name string) (<-chan Result, error) {
+	e := r.get(name)
+	if e == nil {
+		return nil, ErrNotFound
+	}
+	if !e.job.enabled() {
+		return nil, ErrDisabled
+	}
+	results := make(chan Result, 1)
+	if _, err := r.start(e, TriggerManual, results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// start claims the overlap guard, records the run and runs it in the
+// background. results, if not nil, receives the run's result.
+func (r *Runner) start(e *entry, trigger string, results chan<- Result) (string, error) {
+	if !e.running.CompareAndSwap(false, true) {
+		return "", ErrRunning
+	}
+
+	run, err := r.recordStart(e.job.Name, trigger)
+	if err != nil {
+		// Still run the job; only its history is lost
+		log.Printf("[JOBS] Error recording %s run: %v", e.job.Name, err)
+	}
+	go r.execute(e, run, trigger, results)
+
+	if run == nil {
+		return "", nil
+	}
+	return run.Id, nil
+}
+
+// Result is the outcome of a run
+type Result struct {
+	Counts Counts
+	Err    error
+}
+
+// execute runs the job with its timeout. A run that times out is recorded
+// as such right away, but the guard is held until it actually returns, so
+// a job that ignores its context never overlaps itself.
+func (r *Runner) execute(e *entry, run *core.Record, trigger string, results chan<- Result) {
+	if trigger == TriggerSchedule && e.job.Schedule != "" {
+		time.Sleep(jitter(e.job.Jitter))
+	}
+
+	started := time.Now()
+	timeout := e.job.timeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	done := make(chan Result, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- Result{Err: fmt.Errorf("panic: %v", p)}
+			}
+		}()
+		counts, err := e.job.Run(ctx)
+		done <- Result{counts, err}
+	}()
+
+	finish := func() {
+		cancel()
+		e.mu.Lock()
+		e.lastEnd = time.Now()
+		e.delay = jitter(e.job.Jitter)
+		e.mu.Unlock()
+		e.running.Store(false)
+	}
+
+	select {
+	case result := <-done:
+		r.recordEnd(run, started, result.Counts, result.Err, false)
+		if result.Err != nil {
+			log.Printf("[JOBS] %s failed: %v", e.job.Name, result.Err)
+		}
+		finish()
+		if results != nil {
+			results <- result
+		}
+	case <-ctx.Done():
+		err := fmt.Errorf("timed out after %v", timeout)
+		r.recordEnd(run, started, nil, err, true)
+		log.Printf("[JOBS] %s timed out after %v", e.job.Name, timeout)
+		if results != nil {
+			results <- Result{Err: err}
+		}
+		go func() {
+			<-done
+			log.Printf("[JOBS] %s finished %v after timing out", e.job.Name, time.Since(started).Round(time.Second))
+			finish()
+		}()
+	}
+}
+
+// SetPaused pauses or resumes a job's scheduled runs and persists the
+// choice across restarts
+func (r *Runner) SetPaused(name string, paused bool) error {
+	e := r.get(name)
+	if e == nil {
+		return ErrNotFound
+	}
+	if err := r.savePaused(name, paused); err != nil {
+		return err
+	}
+	e.paused.Store(paused)
+	log.Printf("[JOBS] %s paused: %v", name, paused)
+	return nil
+}
+
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
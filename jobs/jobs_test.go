@@ -0,0 +1,156 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"pb-backend/jobs/migrations"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func newTestRunner(t *testing.T) *Runner {
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RunAllMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := core.NewMigrationsRunner(app, migrations.List).Up(); err != nil {
+		t.Fatal(err)
+	}
+	return NewRunner(app)
+}
+
+func TestTriggerOverlapGuard(t *testing.T) {
+	r := newTestRunner(t)
+	release := make(chan struct{})
+	r.MustAdd(Job{
+		Name:  "blocking",
+		Every: func() time.Duration { return time.Hour },
+		Run: func(ctx context.Context) (Counts, error) {
+			<-release
+			return Counts{"saved": 3}, nil
+		},
+	})
+
+	results, err := r.TriggerWait("blocking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Trigger("blocking"); !errors.Is(err, ErrRunning) {
+		t.Errorf("Expected ErrRunning while the job runs, got %v", err)
+	}
+	if _, err := r.TriggerWait("blocking"); !errors.Is(err, ErrRunning) {
+		t.Errorf("Expected ErrRunning from TriggerWait while the job runs, got %v", err)
+	}
+
+	close(release)
+	result := <-results
+	if result.Err != nil || result.Counts["saved"] != 3 {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+
+	// The guard is released after the result is recorded
+	deadline := time.Now().Add(time.Second)
+	for r.get("blocking").running.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := r.Trigger("blocking"); err != nil {
+		t.Errorf("Expected the job to run again once finished, got %v", err)
+	}
+}
+
+func TestTimedOutRunKeepsGuard(t *testing.T) {
+	r := newTestRunner(t)
+	release := make(chan struct{})
+	r.MustAdd(Job{
+		Name:    "stuck",
+		Every:   func() time.Duration { return time.Hour },
+		Timeout: 20 * time.Millisecond,
+		Run: func(ctx context.Context) (Counts, error) {
+			// Ignores ctx
+			<-release
+			return nil, nil
+		},
+	})
+
+	results, err := r.TriggerWait("stuck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := <-results; result.Err == nil {
+		t.Fatal("Expected the run to time out")
+	}
+	if _, err := r.Trigger("stuck"); !errors.Is(err, ErrRunning) {
+		t.Errorf("Expected the guard to be held until the run returns, got %v", err)
+	}
+	close(release)
+}
+
+func TestTriggerDisabledAndUnknown(t *testing.T) {
+	r := newTestRunner(t)
+	r.MustAdd(Job{
+		Name:    "off",
+		Every:   func() time.Duration { return time.Hour },
+		Enabled: func() bool { return false },
+		Run:     func(ctx context.Context) (Counts, error) { return nil, nil },
+	})
+
+	if _, err := r.Trigger("off"); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Expected ErrDisabled, got %v", err)
+	}
+	if _, err := r.Trigger("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestWake(t *testing.T) {
+	r := newTestRunner(t)
+	runs := make(chan struct{}, 2)
+	r.MustAdd(Job{
+		Name:  "woken",
+		Every: func() time.Duration { return time.Hour },
+		Run: func(ctx context.Context) (Counts, error) {
+			runs <- struct{}{}
+			return nil, nil
+		},
+	})
+	e := r.get("woken")
+
+	r.tick(e)
+	select {
+	case <-runs:
+		t.Fatal("Expected the job to wait for its interval")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Several wakes make one run
+	r.Wake("woken")
+	r.Wake("woken")
+	r.tick(e)
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a woken job to run on the next tick")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for e.running.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.tick(e)
+	select {
+	case <-runs:
+		t.Error("Expected wakes to be merged into one run")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := r.Wake("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func init() {
+	List.Register(createJobCollections, func(app core.App) error {
+		for _, name := range []string{"job_runs", "jobs"} {
+			if collection, err := app.FindCollectionByNameOrId(name); err == nil {
+				if err := app.Delete(collection); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}, "1792356300_create_job_collections")
+}
+
+// createJobCollections creates job_runs, the run history, and jobs, which
+// remembers paused jobs. Only superusers can read them.
+func createJobCollections(app core.App) error {
+	runs := core.NewBaseCollection("job_runs")
+	runs.Fields.Add(&core.TextField{
+		Name:     "job",
+		Required: true,
+	})
+	// schedule or manual
+	runs.Fields.Add(&core.TextField{
+		Name: "trigger",
+	})
+	runs.Fields.Add(&core.TextField{
+		Name:     "status",
+		Required: true,
+	})
+	runs.Fields.Add(&core.DateField{
+		Name: "started",
+	})
+	runs.Fields.Add(&core.DateField{
+		Name: "finished",
+	})
+	runs.Fields.Add(&core.NumberField{
+		Name: "duration_ms",
+	})
+	runs.Fields.Add(&core.TextField{
+		Name: "error",
+	})
+	// Figures reported by the job, e.g. {"fetched": 51, "saved": 12}
+	runs.Fields.Add(&core.JSONField{
+		Name: "counts",
+	})
+	runs.Indexes = []string{
+		"CREATE INDEX idx_job_runs_job ON job_runs (job, started)",
+		"CREATE INDEX idx_job_runs_started ON job_runs (started)",
+		"CREATE INDEX idx_job_runs_status ON job_runs (status)",
+	}
+	if err := app.Save(runs); err != nil {
+		return err
+	}
+
+	jobs := core.NewBaseCollection("jobs")
+	jobs.Fields.Add(&core.TextField{
+		Name:     "name",
+		Required: true,
+	})
+	jobs.Fields.Add(&core.BoolField{
+		Name: "paused",
+	})
+	jobs.Fields.Add(&core.AutodateField{
+		Name:     "updated",
+		OnCreate: true,
+		OnUpdate: true,
+	})
+	jobs.Indexes = []string{
+		"CREATE UNIQUE INDEX idx_jobs_name ON jobs (name)",
+	}
+	return app.Save(jobs)
+}
@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Status is a job's entry in GET /api/jobs
+type Status struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule,omitempty"`
+	// Every is the current interval in seconds
+	Every   float64 `json:"every,omitempty"`
+	Enabled bool    `json:"enabled"`
+	Paused  bool    `json:"paused"`
+	Running bool    `json:"running"`
+	LastRun any     `json:"last_run"`
+}
+
+// RegisterRoutes mounts the superuser job endpoints. Runs started with
+// /run ignore the job's pause and jitter; their history is in job_runs.
+//
+//	GET  /api/jobs
+//	POST /api/jobs/{name}/run
+//	POST /api/jobs/{name}/pause
+//	POST /api/jobs/{name}/resume
+func (r *Runner) RegisterRoutes(se *core.ServeEvent) {
+	group := se.Router.Group("/api/jobs")
+	group.Bind(apis.RequireSuperuserAuth())
+	group.GET("", r.handleList)
+	group.POST("/{name}/run", r.handleRun)
+	group.POST("/{name}/pause", func(e *core.RequestEvent) error {
+		return r.handlePause(e, true)
+	})
+	group.POST("/{name}/resume", func(e *core.RequestEvent) error {
+		return r.handlePause(e, false)
+	})
+}
+
+func (r *Runner) handleList(e *core.RequestEvent) error {
+	r.mu.RLock()
+	names := append([]string(nil), r.order...)
+	r.mu.RUnlock()
+
+	statuses := make([]Status, 0, len(names))
+	for _, name := range names {
+		entry := r.get(name)
+		status := Status{
+			Name:     name,
+			Schedule: entry.job.Schedule,
+			Enabled:  entry.job.enabled(),
+			Paused:   entry.paused.Load(),
+			Running:  entry.running.Load(),
+		}
+		if entry.job.Every != nil {
+			status.Every = entry.job.Every().Seconds()
+		}
+		if run := r.lastRun(name); run != nil {
+			status.LastRun = run
+		}
+		statuses = append(statuses, status)
+	}
+	return e.JSON(http.StatusOK, map[string]any{"jobs": statuses})
+}
+
+func (r *Runner) handleRun(e *core.RequestEvent) error {
+	runID, err := r.Trigger(e.Request.PathValue("name"))
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return e.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrRunning), errors.Is(err, ErrDisabled):
+		return e.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case err != nil:
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return e.JSON(http.StatusAccepted, map[string]string{"run": runID})
+}
+
+func (r *Runner) handlePause(e *core.RequestEvent, paused bool) error {
+	name := e.Request.PathValue("name")
+	err := r.SetPaused(name, paused)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return e.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case err != nil:
+		return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return e.JSON(http.StatusOK, map[string]any{"name": name, "paused": paused})
+}
@@ -0,0 +1,144 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Run statuses
+const (
+	StatusRunning     = "running"
+	StatusSuccess     = "success"
+	StatusError       = "error"
+	StatusTimeout     = "timeout"
+	StatusInterrupted = "interrupted"
+)
+
+// Run history older than this is deleted by the job_runs_cleanup job
+const runRetention = 7 * 24 * time.Hour
+
+func (r *Runner) recordStart(job, trigger string) (*core.Record, error) {
+	collection, err := r.app.FindCollectionByNameOrId("job_runs")
+	if err != nil {
+		return nil, err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("job", job)
+	record.Set("trigger", trigger)
+	record.Set("status", StatusRunning)
+	record.Set("started", time.Now().UTC())
+	if err := r.app.Save(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (r *Runner) recordEnd(record *core.Record, started time.Time, counts Counts, runErr error, timedOut bool) {
+	if record == nil {
+		return
+	}
+
+	status := StatusSuccess
+	switch {
+	case timedOut:
+		status = StatusTimeout
+	case runErr != nil:
+		status = StatusError
+	}
+
+	record.Set("status", status)
+	record.Set("finished", time.Now().UTC())
+	record.Set("duration_ms", time.Since(started).Milliseconds())
+	if runErr != nil {
+		record.Set("error", runErr.Error())
+	}
+	if counts != nil {
+		record.Set("counts", counts)
+	}
+	if err := r.app.Save(record); err != nil {
+		log.Printf("[JOBS] Error recording %s run: %v", record.GetString("job"), err)
+	}
+}
+
+// closeInterruptedRuns marks runs still open from a previous process
+func (r *Runner) closeInterruptedRuns() {
+	records, err := r.app.FindRecordsByFilter("job_runs", "status = {:status}", "", 0, 0,
+		map[string]any{"status": StatusRunning})
+	if err != nil {
+		log.Printf("[JOBS] Error finding interrupted runs: %v", err)
+		return
+	}
+
+	for _, record := range records {
+		record.Set("status", StatusInterrupted)
+		record.Set("error", "the process stopped during the run")
+		if err := r.app.Save(record); err != nil {
+			log.Printf("[JOBS] Error closing run %s: %v", record.Id, err)
+		}
+	}
+	if len(records) > 0 {
+		log.Printf("[JOBS] Marked %d runs as interrupted", len(records))
+	}
+}
+
+// pruneRuns deletes run history past the retention period. It deletes with
+// one statement, skipping record hooks, since runs have no files or
+// relations to clean up.
+func (r *Runner) pruneRuns(ctx context.Context) (Counts, error) {
+	cutoff := time.Now().UTC().Add(-runRetention).Format(types.DefaultDateLayout)
+	result, err := r.app.DB().
+		NewQuery("DELETE FROM job_runs WHERE started < {:cutoff} AND status != {:running}").
+		Bind(map[string]any{"cutoff": cutoff, "running": StatusRunning}).
+		WithContext(ctx).
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, _ := result.RowsAffected()
+	return Counts{"deleted": int(deleted)}, nil
+}
+
+func (r *Runner) loadPaused() {
+	records, err := r.app.FindRecordsByFilter("jobs", "paused = true", "", 0, 0)
+	if err != nil {
+		log.Printf("[JOBS] Error loading paused jobs: %v", err)
+		return
+	}
+
+	for _, record := range records {
+		if e := r.get(record.GetString("name")); e != nil {
+			e.paused.Store(true)
+			log.Printf("[JOBS] %s is paused", record.GetString("name"))
+		}
+	}
+}
+
+func (r *Runner) savePaused(name string, paused bool) error {
+	record, _ := r.app.FindFirstRecordByFilter("jobs", "name = {:name}", map[string]any{"name": name})
+	if record == nil {
+		collection, err := r.app.FindCollectionByNameOrId("jobs")
+		if err != nil {
+			return err
+		}
+		record = core.NewRecord(collection)
+		record.Set("name", name)
+	}
+	record.Set("paused", paused)
+	return r.app.Save(record)
+}
+
+// lastRun returns the job's most recent run, or nil
+func (r *Runner) lastRun(name string) *core.Record {
+	records, err := r.app.FindRecordsByFilter("job_runs", "job = {:job}", "-started", 1, 0,
+		map[string]any{"job": name})
+	if err != nil || len(records) == 0 {
+		return nil
+	}
+	return records[0]
+}
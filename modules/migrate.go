@@ -0,0 +1,72 @@
+package modules
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	jobsmigrations "pb-backend/jobs/migrations"
+	settingsmigrations "pb-backend/settings/migrations"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// Migrate applies a module's pending migrations. Applied migrations are
+// recorded in PocketBase's _migrations table, so each runs once.
+func Migrate(app core.App, module Module) error {
+	applied, err := core.NewMigrationsRunner(app, module.Migrations()).Up()
+	for _, file := range applied {
+		log.Printf("[MODULES] %s: applied migration %s", module.Name(), file)
+	}
+	return err
+}
+
+// sharedMigrations are the schema histories of the collections every
+// module relies on: the settings and the job runner's
+var sharedMigrations = []struct {
+	name string
+	list core.MigrationsList
+}{
+	{"settings", settingsmigrations.List},
+	{"jobs", jobsmigrations.List},
+}
+
+// MigrateShared applies the pending migrations of the shared collections.
+// It runs before the settings are loaded and any module starts.
+func MigrateShared(app core.App) error {
+	for _, shared := range sharedMigrations {
+		applied, err := core.NewMigrationsRunner(app, shared.list).Up()
+		for _, file := range applied {
+			log.Printf("[MODULES] %s: applied migration %s", shared.name, file)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", shared.name, err)
+		}
+	}
+	return nil
+}
+
+// newMigrateCommand adds "module-migrate <module> up|down [n]", which
+// applies or reverts a module's migrations whether or not it is enabled
+func newMigrateCommand(app *pocketbase.PocketBase) *cobra.Command {
+	return &cobra.Command{
+		Use:          "module-migrate <module> up|down [n]",
+		Short:        "Applies or reverts a module's migrations",
+		Args:         cobra.RangeArgs(2, 3),
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			index := slices.IndexFunc(registry, func(m Module) bool { return m.Name() == args[0] })
+			if index < 0 {
+				return fmt.Errorf("unknown module %q", args[0])
+			}
+			// The runner's other commands rewrite the whole _migrations
+			// table, which the modules share
+			if args[1] != "up" && args[1] != "down" {
+				return fmt.Errorf("unsupported command %q; use up or down", args[1])
+			}
+			return core.NewMigrationsRunner(app, registry[index].Migrations()).Run(args[1:]...)
+		},
+	}
+}
@@ -0,0 +1,136 @@
+// Package modules wires side projects into the app. Each project is a
+// Module registered once in main; Setup applies its migrations and starts
+// its hooks, jobs and routes when its enable_<name> setting is on, so adding
+// a project means writing one package rather than editing main.
+package modules
+
+import (
+	"log"
+	"net/http"
+
+	"pb-backend/jobs"
+	"pb-backend/settings"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Module is a self-contained side project
+type Module interface {
+	// Name is used in logs, the health report and the enable_<name> setting
+	Name() string
+	// Migrations lists the versioned schema changes for the module's
+	// collections, oldest first. File names must be unique across modules.
+	Migrations() core.MigrationsList
+	// RegisterHooks binds record hooks. It runs before the migrations, so
+	// hooks also see records written while migrating.
+	RegisterHooks(app *pocketbase.PocketBase)
+	// StartJobs adds the module's scheduled jobs to the runner and starts
+	// its workers
+	StartJobs(app *pocketbase.PocketBase, runner *jobs.Runner)
+	// RegisterRoutes adds the module's API routes. It runs after StartJobs.
+	RegisterRoutes(app *pocketbase.PocketBase, se *core.ServeEvent)
+	// Health reports whether the module is working
+	Health(app *pocketbase.PocketBase) Health
+}
+
+// Health statuses
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+	StatusDisabled = "disabled"
+)
+
+// Health is a module's self-reported state
+type Health struct {
+	Status  string         `json:"status"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+var registry []Module
+
+// Register adds a module. Call it before Setup.
+func Register(module Module, enabledByDefault bool) {
+	settings.RegisterModule(module.Name(), enabledByDefault)
+	registry = append(registry, module)
+}
+
+// Setup loads the settings and starts every enabled module when the app
+// serves
+func Setup(app *pocketbase.PocketBase) {
+	// Runtime settings, editable in the app_settings collection
+	settings.RegisterHooks(app)
+
+	app.RootCmd.AddCommand(newMigrateCommand(app))
+
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		if err := MigrateShared(app); err != nil {
+			log.Printf("[MODULES] Error migrating shared collections: %v", err)
+		}
+		if err := settings.AddModuleSwitches(app); err != nil {
+			log.Printf("Error adding module switches to app settings: %v", err)
+		}
+		if err := settings.Load(app); err != nil {
+			log.Printf("Error loading app settings: %v", err)
+		}
+		config := settings.Current()
+
+		runner := jobs.NewRunner(app)
+		started := map[string]bool{}
+		for _, module := range registry {
+			name := module.Name()
+			if !config.ModuleEnabled(name) {
+				log.Printf("[MODULES] %s is disabled", name)
+				continue
+			}
+
+			module.RegisterHooks(app)
+			if err := Migrate(app, module); err != nil {
+				// Jobs and routes would only fail against a broken schema
+				log.Printf("[MODULES] Error migrating %s, not starting it: %v", name, err)
+				continue
+			}
+			module.StartJobs(app, runner)
+			module.RegisterRoutes(app, se)
+			started[name] = true
+			log.Printf("[MODULES] Started %s", name)
+		}
+
+		runner.Start()
+		runner.RegisterRoutes(se)
+
+		se.Router.GET("/api/modules/health", func(e *core.RequestEvent) error {
+			return handleHealth(e, app, started)
+		}).Bind(apis.RequireSuperuserAuth())
+
+		return se.Next()
+	})
+}
+
+// ModuleHealth is one module's entry in the health report
+type ModuleHealth struct {
+	Name string `json:"name"`
+	Health
+}
+
+// handleHealth reports every registered module. It answers 503 when a
+// started module is down, so uptime checks can alert on it.
+func handleHealth(e *core.RequestEvent, app *pocketbase.PocketBase, started map[string]bool) error {
+	report := make([]ModuleHealth, 0, len(registry))
+	status := http.StatusOK
+	config := settings.Current()
+	for _, module := range registry {
+		entry := ModuleHealth{Name: module.Name(), Health: Health{Status: StatusDisabled}}
+		// A module switched off since startup has its jobs paused
+		if started[module.Name()] && config.ModuleEnabled(module.Name()) {
+			entry.Health = module.Health(app)
+			if entry.Status == StatusDown {
+				status = http.StatusServiceUnavailable
+			}
+		}
+		report = append(report, entry)
+	}
+	return e.JSON(status, map[string]any{"modules": report})
+}
@@ -0,0 +1,117 @@
+package modules
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/dbutils"
+)
+
+// EnsureCollection saves a new collection, or brings an existing one of the
+// same name up to it. Existing databases predate the migrations, so their
+// collections may have been created by older code or imported by hand:
+// missing fields and indexes are added and select fields gain missing
+// values, while other changes to existing fields, rules and data are left
+// to numbered migrations. It returns the saved collection.
+func EnsureCollection(app core.App, collection *core.Collection) (*core.Collection, error) {
+	existing, _ := app.FindCollectionByNameOrId(collection.Name)
+	if existing == nil {
+		return collection, app.Save(collection)
+	}
+
+	changed := false
+	for _, field := range collection.Fields {
+		if field.GetSystem() {
+			continue
+		}
+		current := existing.Fields.GetByName(field.GetName())
+		if current == nil {
+			existing.Fields.Add(field)
+			changed = true
+			continue
+		}
+		if addSelectValues(current, field) {
+			changed = true
+		}
+	}
+	for _, index := range collection.Indexes {
+		if hasIndex(existing, index) {
+			continue
+		}
+		existing.Indexes = append(existing.Indexes, index)
+		changed = true
+	}
+
+	if !changed {
+		return existing, nil
+	}
+	return existing, app.Save(existing)
+}
+
+// addSelectValues adds the values of want missing from current when both
+// are select fields, and reports whether any were added
+func addSelectValues(current, want core.Field) bool {
+	have, ok := current.(*core.SelectField)
+	if !ok {
+		return false
+	}
+	values, ok := want.(*core.SelectField)
+	if !ok {
+		return false
+	}
+
+	added := false
+	for _, value := range values.Values {
+		if !slices.Contains(have.Values, value) {
+			have.Values = append(have.Values, value)
+			added = true
+		}
+	}
+	return added
+}
+
+// hasIndex reports whether the collection has the index, by name or by an
+// index over the same columns
+func hasIndex(collection *core.Collection, expr string) bool {
+	want := dbutils.ParseIndex(expr)
+	for _, existing := range collection.Indexes {
+		have := dbutils.ParseIndex(existing)
+		if strings.EqualFold(have.IndexName, want.IndexName) {
+			return true
+		}
+		if have.Unique == want.Unique && slices.EqualFunc(have.Columns, want.Columns, func(a, b dbutils.IndexColumn) bool {
+			return strings.EqualFold(a.Name, b.Name)
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteCollections deletes collections and their records, skipping any that
+// don't exist. List collections before the ones they reference.
+func DeleteCollections(app core.App, names ...string) error {
+	for _, name := range names {
+		collection, err := app.FindCollectionByNameOrId(name)
+		if err != nil {
+			continue
+		}
+		if err := app.Delete(collection); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveFields drops fields from a collection, skipping any it doesn't have
+func RemoveFields(app core.App, collectionName string, fields ...string) error {
+	collection, err := app.FindCollectionByNameOrId(collectionName)
+	if err != nil {
+		return err
+	}
+	for _, name := range fields {
+		collection.Fields.RemoveByName(name)
+	}
+	return app.Save(collection)
+}
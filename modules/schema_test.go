@@ -0,0 +1,106 @@
+package modules
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func newTestApp(t *testing.T) *pocketbase.PocketBase {
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RunAllMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func alertsCollection() *core.Collection {
+	collection := core.NewBaseCollection("alerts")
+	collection.Fields.Add(&core.TextField{Name: "name", Required: true})
+	collection.Fields.Add(&core.SelectField{Name: "delivery", MaxSelect: 1, Values: []string{"email", "webhook"}})
+	collection.Fields.Add(&core.NumberField{Name: "min_price"})
+	collection.Indexes = []string{
+		"CREATE INDEX idx_alerts_name ON alerts (name)",
+		"CREATE UNIQUE INDEX idx_alerts_delivery ON alerts (delivery, min_price)",
+	}
+	return collection
+}
+
+func TestEnsureCollectionCreates(t *testing.T) {
+	app := newTestApp(t)
+
+	if _, err := EnsureCollection(app, alertsCollection()); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := app.FindCollectionByNameOrId("alerts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Fields.GetByName("min_price") == nil || len(saved.Indexes) != 2 {
+		t.Errorf("Expected the collection as defined, got fields %v and indexes %v", saved.Fields.FieldNames(), saved.Indexes)
+	}
+
+	// Running it again changes nothing
+	if _, err := EnsureCollection(app, alertsCollection()); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := app.FindCollectionByNameOrId("alerts")
+	if len(again.Fields) != len(saved.Fields) || len(again.Indexes) != len(saved.Indexes) {
+		t.Errorf("Expected no changes, got fields %v and indexes %v", again.Fields.FieldNames(), again.Indexes)
+	}
+}
+
+func TestEnsureCollectionUpgrades(t *testing.T) {
+	app := newTestApp(t)
+
+	// An older version: fewer fields and select values, an index under
+	// another name and a field since made required
+	old := core.NewBaseCollection("alerts")
+	old.Fields.Add(&core.TextField{Name: "name"})
+	old.Fields.Add(&core.SelectField{Name: "delivery", MaxSelect: 1, Values: []string{"email", "discord"}})
+	old.Indexes = []string{"CREATE INDEX idx_old_name ON alerts (name)"}
+	if err := app.Save(old); err != nil {
+		t.Fatal(err)
+	}
+	record := core.NewRecord(old)
+	record.Set("name", "kept")
+	record.Set("delivery", "discord")
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+
+	collection, err := EnsureCollection(app, alertsCollection())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if collection.Id != old.Id {
+		t.Error("Expected the existing collection to be returned")
+	}
+
+	if collection.Fields.GetByName("min_price") == nil {
+		t.Error("Expected the missing field to be added")
+	}
+	if collection.Fields.GetByName("name").(*core.TextField).Required {
+		t.Error("Expected existing fields to be left alone")
+	}
+	delivery := collection.Fields.GetByName("delivery").(*core.SelectField)
+	if !slices.Equal(delivery.Values, []string{"email", "discord", "webhook"}) {
+		t.Errorf("Expected the missing select value to be added, got %v", delivery.Values)
+	}
+	if !slices.Equal(collection.Indexes, []string{
+		"CREATE INDEX idx_old_name ON alerts (name)",
+		"CREATE UNIQUE INDEX idx_alerts_delivery ON alerts (delivery, min_price)",
+	}) {
+		t.Errorf("Expected only the missing index to be added, got %v", collection.Indexes)
+	}
+
+	kept, err := app.FindFirstRecordByData("alerts", "name", "kept")
+	if err != nil || kept.GetString("delivery") != "discord" {
+		t.Errorf("Expected existing records to be kept, got %v, %v", kept, err)
+	}
+}
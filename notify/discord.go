@@ -0,0 +1,159 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"pb-backend/discord"
+)
+
+// Discord limits
+const (
+	discordMaxEmbeds        = 10
+	discordMaxButtonsPerRow = 5
+)
+
+// DiscordBot posts to a channel as a bot
+type DiscordBot struct {
+	Config    *discord.Config
+	ChannelID string
+}
+
+func (n *DiscordBot) Send(msg Message) (Receipt, error) {
+	id, err := discord.SendMessage(n.Config, n.ChannelID, DiscordMessage(msg))
+	if err != nil {
+		return Receipt{}, err
+	}
+	return Receipt{ID: id}, nil
+}
+
+// DiscordDM sends a direct message to a user as a bot
+type DiscordDM struct {
+	Config *discord.Config
+	UserID string
+}
+
+func (n *DiscordDM) Send(msg Message) (Receipt, error) {
+	channelID, err := discord.OpenDM(n.Config, n.UserID)
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	id, err := discord.SendMessage(n.Config, channelID, DiscordMessage(msg))
+	if err != nil {
+		return Receipt{}, err
+	}
+	return Receipt{ID: id}, nil
+}
+
+// DiscordWebhook posts through a channel webhook URL
+type DiscordWebhook struct {
+	URL string
+}
+
+func (n *DiscordWebhook) Send(msg Message) (Receipt, error) {
+	dm := DiscordMessage(msg)
+	// Webhooks not owned by an application can only send link buttons
+	dm.Components = discordComponents(linkActions(msg.Actions))
+
+	url := n.URL
+	if strings.Contains(url, "?") {
+		url += "&wait=true"
+	} else {
+		url += "?wait=true"
+	}
+
+	body, err := postJSON(url, dm, nil)
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return Receipt{}, fmt.Errorf("invalid webhook response: %w", err)
+	}
+	return Receipt{ID: resp.ID}, nil
+}
+
+// DiscordMessage converts a message to a Discord message: the main content
+// and each section become embeds and actions become buttons
+func DiscordMessage(msg Message) discord.Message {
+	embeds := []discord.Embed{DiscordEmbed(msg)}
+	for _, section := range msg.Sections {
+		if len(embeds) == discordMaxEmbeds {
+			break
+		}
+		embeds = append(embeds, DiscordEmbed(section))
+	}
+
+	return discord.Message{
+		Content:    msg.Summary,
+		Embeds:     embeds,
+		Components: discordComponents(msg.Actions),
+	}
+}
+
+// DiscordEmbed converts a message's main content to a single embed
+func DiscordEmbed(msg Message) discord.Embed {
+	embed := discord.Embed{
+		Title:       msg.Title,
+		Description: msg.Text,
+		URL:         msg.URL,
+		Color:       msg.Color,
+	}
+	if !msg.Timestamp.IsZero() {
+		embed.Timestamp = msg.Timestamp.UTC().Format(time.RFC3339)
+	}
+	for _, field := range msg.Fields {
+		embed.Fields = append(embed.Fields, discord.EmbedField{
+			Name:   field.Name,
+			Value:  field.Value,
+			Inline: field.Inline,
+		})
+	}
+	if msg.ImageURL != "" {
+		embed.Image = &discord.EmbedImage{URL: msg.ImageURL}
+	}
+	return embed
+}
+
+func discordComponents(actions []Action) []discord.Component {
+	var rows []discord.Component
+	for i, action := range actions {
+		if i%discordMaxButtonsPerRow == 0 {
+			rows = append(rows, discord.Component{Type: discord.ComponentActionRow})
+		}
+
+		button := discord.Component{Type: discord.ComponentButton, Label: action.Label}
+		switch {
+		case action.URL != "":
+			button.Style = discord.ButtonLink
+			button.URL = action.URL
+		case action.Primary:
+			button.Style = discord.ButtonPrimary
+			button.CustomID = action.ID
+		default:
+			button.Style = discord.ButtonSecondary
+			button.CustomID = action.ID
+		}
+
+		row := &rows[len(rows)-1]
+		row.Components = append(row.Components, button)
+	}
+	return rows
+}
+
+// linkActions returns only the actions that open a URL
+func linkActions(actions []Action) []Action {
+	var links []Action
+	for _, action := range actions {
+		if action.URL != "" {
+			links = append(links, action)
+		}
+	}
+	return links
+}
@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/mail"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+)
+
+// Email sends HTML email through PocketBase's configured mailer
+type Email struct {
+	App core.App
+	To  []string
+}
+
+func (n *Email) Send(msg Message) (Receipt, error) {
+	to := make([]mail.Address, 0, len(n.To))
+	for _, addr := range n.To {
+		to = append(to, mail.Address{Address: addr})
+	}
+
+	subject := msg.Title
+	if msg.Summary != "" {
+		subject = fmt.Sprintf("%s - %s", msg.Summary, msg.Title)
+	}
+
+	settings := n.App.Settings()
+	messageID := newMessageID(settings.Meta.SenderAddress)
+	headers := map[string]string{"Message-ID": messageID}
+
+	message := &mailer.Message{
+		From: mail.Address{
+			Address: settings.Meta.SenderAddress,
+			Name:    settings.Meta.SenderName,
+		},
+		To:      to,
+		Subject: subject,
+		HTML:    EmailHTML(msg),
+		Headers: headers,
+	}
+
+	if err := n.App.NewMailClient().Send(message); err != nil {
+		return Receipt{}, err
+	}
+	return Receipt{ID: messageID}, nil
+}
+
+// EmailHTML renders a message as a simple HTML email body
+func EmailHTML(msg Message) string {
+	var body strings.Builder
+	if msg.Summary != "" {
+		fmt.Fprintf(&body, "<h2>%s</h2>", html.EscapeString(msg.Summary))
+	}
+	writeEmailSection(&body, msg)
+	for _, section := range msg.Sections {
+		writeEmailSection(&body, section)
+	}
+
+	if links := linkActions(msg.Actions); len(links) > 0 {
+		body.WriteString("<p>")
+		for i, link := range links {
+			if i > 0 {
+				body.WriteString(" · ")
+			}
+			fmt.Fprintf(&body, `<a href="%s">%s</a>`, html.EscapeString(link.URL), html.EscapeString(link.Label))
+		}
+		body.WriteString("</p>")
+	}
+	return body.String()
+}
+
+func writeEmailSection(body *strings.Builder, msg Message) {
+	if msg.Title != "" {
+		if msg.URL != "" {
+			fmt.Fprintf(body, `<h3><a href="%s">%s</a></h3>`, html.EscapeString(msg.URL), html.EscapeString(msg.Title))
+		} else {
+			fmt.Fprintf(body, "<h3>%s</h3>", html.EscapeString(msg.Title))
+		}
+	}
+	if msg.Text != "" {
+		fmt.Fprintf(body, "<p>%s</p>", strings.ReplaceAll(html.EscapeString(msg.Text), "\n", "<br>"))
+	}
+	if len(msg.Fields) > 0 {
+		body.WriteString("<ul>")
+		for _, field := range msg.Fields {
+			fmt.Fprintf(body, "<li><b>%s:</b> %s</li>", html.EscapeString(field.Name), emailMarkup(field.Value))
+		}
+		body.WriteString("</ul>")
+	}
+	if msg.ImageURL != "" {
+		fmt.Fprintf(body, `<p><img src="%s" width="480"></p>`, html.EscapeString(msg.ImageURL))
+	}
+}
+
+// emailMarkup escapes a value and renders Discord-style ~~strikethrough~~
+func emailMarkup(s string) string {
+	s = html.EscapeString(s)
+	for strings.Count(s, "~~") >= 2 {
+		s = strings.Replace(s, "~~", "<s>", 1)
+		s = strings.Replace(s, "~~", "</s>", 1)
+	}
+	return s
+}
+
+func newMessageID(sender string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(sender, "@"); at >= 0 {
+		domain = sender[at+1:]
+	}
+
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain)
+}
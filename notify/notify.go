@@ -0,0 +1,149 @@
+// Package notify delivers notifications through pluggable backends (Discord,
+// Slack, email, ntfy and JSON webhooks) using a neutral message model, so
+// modules describe what to say once and users pick where it goes.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Message is a backend-neutral notification
+type Message struct {
+	// Summary is a one-line lead shown above the content, e.g. "New listing"
+	Summary  string
+	Title    string
+	Text     string
+	URL      string
+	ImageURL string
+	// Color is an RGB accent color; backends without colors ignore it
+	Color     int
+	Fields    []Field
+	Timestamp time.Time
+
+	// Sections are rendered after the main content, e.g. as extra Discord
+	// embeds or email headings
+	Sections []Message
+
+	// Actions are buttons. Link actions render everywhere; callback actions
+	// (with an ID) only on backends that support interactions.
+	Actions []Action
+
+	// Data is included as-is in JSON webhook payloads
+	Data map[string]any
+}
+
+// Field is a labeled value
+type Field struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// Action is a button on a message
+type Action struct {
+	Label   string `json:"label"`
+	URL     string `json:"url,omitempty"`
+	ID      string `json:"id,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// Receipt identifies a sent message
+type Receipt struct {
+	ID string
+}
+
+// Notifier sends messages to one destination
+type Notifier interface {
+	Send(msg Message) (Receipt, error)
+}
+
+// postJSON posts a JSON payload and returns the response body, failing on
+// non-2xx responses
+func postJSON(url string, payload any, headers map[string]string) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	return doRequest(req)
+}
+
+// ErrPrivateAddress is returned for URLs that point at the local network
+var ErrPrivateAddress = errors.New("private and loopback addresses are not allowed")
+
+// cgnat is the carrier-grade NAT range, which net.IP.IsPrivate leaves out
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// httpClient checks every address it connects to, after DNS resolution and
+// on redirects, so a webhook URL can't reach services on the local network
+var httpClient = &http.Client{
+	Timeout: 15 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+					return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || cgnat.Contains(ip)
+}
+
+// checkHost rejects hosts that are obviously local before a URL is saved.
+// Names that resolve to private addresses are caught when connecting.
+func checkHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") ||
+		strings.HasSuffix(host, ".local") || strings.HasSuffix(host, ".internal") {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+func doRequest(req *http.Request) ([]byte, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, body)
+	}
+	return body, nil
+}
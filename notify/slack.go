@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// slackMaxSectionFields is Slack's limit on fields in a section block
+const slackMaxSectionFields = 10
+
+// SlackWebhook posts through a Slack incoming webhook
+type SlackWebhook struct {
+	URL string
+}
+
+func (n *SlackWebhook) Send(msg Message) (Receipt, error) {
+	blocks := []map[string]any{}
+	if msg.Summary != "" {
+		blocks = append(blocks, slackText(msg.Summary))
+	}
+	blocks = append(blocks, slackBlocks(msg)...)
+	for _, section := range msg.Sections {
+		blocks = append(blocks, map[string]any{"type": "divider"})
+		blocks = append(blocks, slackBlocks(section)...)
+	}
+
+	if links := linkActions(msg.Actions); len(links) > 0 {
+		var elements []map[string]any
+		for _, link := range links {
+			elements = append(elements, map[string]any{
+				"type": "button",
+				"text": map[string]any{"type": "plain_text", "text": link.Label},
+				"url":  link.URL,
+			})
+		}
+		blocks = append(blocks, map[string]any{"type": "actions", "elements": elements})
+	}
+
+	// text is the fallback shown in notifications
+	fallback := msg.Summary
+	if fallback == "" {
+		fallback = msg.Title
+	}
+
+	_, err := postJSON(n.URL, map[string]any{"text": fallback, "blocks": blocks}, nil)
+	return Receipt{}, err
+}
+
+func slackBlocks(msg Message) []map[string]any {
+	var blocks []map[string]any
+
+	var text strings.Builder
+	if msg.Title != "" {
+		if msg.URL != "" {
+			fmt.Fprintf(&text, "*<%s|%s>*", msg.URL, slackEscape(msg.Title))
+		} else {
+			fmt.Fprintf(&text, "*%s*", slackEscape(msg.Title))
+		}
+	}
+	if msg.Text != "" {
+		if text.Len() > 0 {
+			text.WriteString("\n")
+		}
+		text.WriteString(slackEscape(msg.Text))
+	}
+	if text.Len() > 0 {
+		blocks = append(blocks, slackText(text.String()))
+	}
+
+	for i := 0; i < len(msg.Fields); i += slackMaxSectionFields {
+		end := i + slackMaxSectionFields
+		if end > len(msg.Fields) {
+			end = len(msg.Fields)
+		}
+		var fields []map[string]any
+		for _, field := range msg.Fields[i:end] {
+			fields = append(fields, map[string]any{
+				"type": "mrkdwn",
+				"text": fmt.Sprintf("*%s*\n%s", slackEscape(field.Name), slackEscape(field.Value)),
+			})
+		}
+		blocks = append(blocks, map[string]any{"type": "section", "fields": fields})
+	}
+
+	if msg.ImageURL != "" {
+		blocks = append(blocks, map[string]any{
+			"type":      "image",
+			"image_url": msg.ImageURL,
+			"alt_text":  msg.Title,
+		})
+	}
+	return blocks
+}
+
+func slackText(text string) map[string]any {
+	return map[string]any{
+		"type": "section",
+		"text": map[string]any{"type": "mrkdwn", "text": text},
+	}
+}
+
+// slackEscape escapes the characters Slack treats as markup. Discord-style
+// ~~strikethrough~~ is converted to Slack's ~strikethrough~.
+func slackEscape(s string) string {
+	s = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+	return strings.ReplaceAll(s, "~~", "~")
+}
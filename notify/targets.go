@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"pb-backend/discord"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Destination kinds, as stored in delivery select fields
+const (
+	KindDiscordChannel = "discord_channel"
+	KindDiscordDM      = "discord_dm"
+	KindDiscordWebhook = "discord_webhook"
+	KindSlack          = "slack"
+	KindEmail          = "email"
+	KindNtfy           = "ntfy"
+	KindWebhook        = "webhook"
+)
+
+// Kinds lists every destination kind
+var Kinds = []string{KindDiscordChannel, KindDiscordDM, KindEmail, KindWebhook, KindDiscordWebhook, KindSlack, KindNtfy}
+
+// ForTarget builds the notifier for a destination kind and target string:
+// a channel ID, Discord user ID, email address (comma separated for several)
+// or URL. Discord bot destinations use the default bot. URLs on the local
+// network are rejected.
+func ForTarget(app core.App, kind, target string) (Notifier, error) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return nil, fmt.Errorf("%s target is empty", kind)
+	}
+
+	switch kind {
+	case KindDiscordChannel, KindDiscordDM:
+		config, err := discord.GetDefaultConfig(app)
+		if err != nil {
+			return nil, err
+		}
+		if kind == KindDiscordDM {
+			return &DiscordDM{Config: config, UserID: target}, nil
+		}
+		return &DiscordBot{Config: config, ChannelID: target}, nil
+
+	case KindEmail:
+		var to []string
+		for _, addr := range strings.Split(target, ",") {
+			parsed, err := mail.ParseAddress(strings.TrimSpace(addr))
+			if err != nil {
+				return nil, fmt.Errorf("invalid email address %q: %w", addr, err)
+			}
+			to = append(to, parsed.Address)
+		}
+		return &Email{App: app, To: to}, nil
+
+	case KindDiscordWebhook, KindSlack, KindNtfy, KindWebhook:
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("invalid %s URL %q", kind, target)
+		}
+		if err := checkHost(u.Hostname()); err != nil {
+			return nil, err
+		}
+		switch kind {
+		case KindDiscordWebhook:
+			return &DiscordWebhook{URL: target}, nil
+		case KindSlack:
+			return &SlackWebhook{URL: target}, nil
+		case KindNtfy:
+			return &Ntfy{URL: target}, nil
+		}
+		return &Webhook{URL: target}, nil
+	}
+
+	return nil, fmt.Errorf("unknown delivery method %q", kind)
+}
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForTargetRejectsLocalURLs(t *testing.T) {
+	for _, target := range []string{
+		"http://localhost:8090/api",
+		"http://127.0.0.1/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.10/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://printer.local/hook",
+	} {
+		if _, err := ForTarget(nil, KindWebhook, target); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("ForTarget(%q) = %v, expected ErrPrivateAddress", target, err)
+		}
+	}
+
+	if _, err := ForTarget(nil, KindWebhook, "https://hooks.example.com/abc"); err != nil {
+		t.Errorf("Expected a public URL to be accepted, got %v", err)
+	}
+}
+
+func TestSendRefusesPrivateAddresses(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	// Built directly, as if the name had resolved to a loopback address
+	n := &Webhook{URL: srv.URL}
+	if _, err := n.Send(Message{Title: "test"}); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Expected ErrPrivateAddress, got %v", err)
+	}
+	if called {
+		t.Error("Expected the request not to reach the server")
+	}
+}
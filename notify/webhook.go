@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"time"
+)
+
+// Webhook posts the message as JSON to an arbitrary URL
+type Webhook struct {
+	URL     string
+	Headers map[string]string
+}
+
+// webhookPayload is the JSON body posted by Webhook
+type webhookPayload struct {
+	Summary   string           `json:"summary,omitempty"`
+	Title     string           `json:"title,omitempty"`
+	Text      string           `json:"text,omitempty"`
+	URL       string           `json:"url,omitempty"`
+	ImageURL  string           `json:"image_url,omitempty"`
+	Fields    []Field          `json:"fields,omitempty"`
+	Sections  []webhookPayload `json:"sections,omitempty"`
+	Actions   []Action         `json:"actions,omitempty"`
+	Timestamp string           `json:"timestamp,omitempty"`
+	Data      map[string]any   `json:"data,omitempty"`
+}
+
+func (n *Webhook) Send(msg Message) (Receipt, error) {
+	_, err := postJSON(n.URL, newWebhookPayload(msg), n.Headers)
+	return Receipt{}, err
+}
+
+func newWebhookPayload(msg Message) webhookPayload {
+	payload := webhookPayload{
+		Summary:  msg.Summary,
+		Title:    msg.Title,
+		Text:     msg.Text,
+		URL:      msg.URL,
+		ImageURL: msg.ImageURL,
+		Fields:   msg.Fields,
+		Actions:  linkActions(msg.Actions),
+		Data:     msg.Data,
+	}
+	if !msg.Timestamp.IsZero() {
+		payload.Timestamp = msg.Timestamp.UTC().Format(time.RFC3339)
+	}
+	for _, section := range msg.Sections {
+		payload.Sections = append(payload.Sections, newWebhookPayload(section))
+	}
+	return payload
+}
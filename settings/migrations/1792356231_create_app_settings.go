@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func init() {
+	List.Register(createAppSettings, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("app_settings")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(collection)
+	}, "1792356231_create_app_settings")
+}
+
+// createAppSettings creates the app_settings collection with a record
+// holding the defaults. Only superusers can read or edit it. Installs that
+// predate the migrations already have it and are left alone.
+func createAppSettings(app core.App) error {
+	if existing, _ := app.FindCollectionByNameOrId("app_settings"); existing != nil {
+		return nil
+	}
+
+	collection := core.NewBaseCollection("app_settings")
+	// Durations use Go syntax, e.g. 10s, 5m, 1h; empty means the default
+	collection.Fields.Add(&core.TextField{Name: "fetch_interval"})
+	collection.Fields.Add(&core.TextField{Name: "cleanup_interval"})
+	collection.Fields.Add(&core.NumberField{Name: "kills_retention_days", OnlyInt: true})
+	collection.Fields.Add(&core.NumberField{Name: "max_pages_to_fetch", OnlyInt: true})
+	collection.Fields.Add(&core.NumberField{Name: "min_iterations", OnlyInt: true})
+	collection.Fields.Add(&core.NumberField{Name: "max_iterations", OnlyInt: true})
+	collection.Fields.Add(&core.TextField{Name: "scrape_interval"})
+	collection.Fields.Add(&core.AutodateField{
+		Name:     "updated",
+		OnCreate: true,
+		OnUpdate: true,
+	})
+	if err := app.Save(collection); err != nil {
+		return err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("fetch_interval", "10s")
+	record.Set("cleanup_interval", "1h0m0s")
+	record.Set("kills_retention_days", 14)
+	record.Set("max_pages_to_fetch", 5)
+	record.Set("min_iterations", 10)
+	record.Set("max_iterations", 20)
+	record.Set("scrape_interval", "1m0s")
+	return app.Save(record)
+}
@@ -0,0 +1,9 @@
+// Package migrations holds the schema history of the app_settings
+// collection, one numbered file per migration. Add changes as new numbered
+// files; never edit one that has shipped.
+package migrations
+
+import "github.com/pocketbase/pocketbase/core"
+
+// List is the settings migrations, applied in file name order
+var List core.MigrationsList
@@ -0,0 +1,352 @@
+// Package settings holds the runtime configuration that used to be code
+// constants. Values live in a single app_settings record that superusers
+// edit in the dashboard; environment variables override it. Jobs read
+// Current each time they are scheduled or run, so edits apply without a
+// restart.
+package settings
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const collectionName = "app_settings"
+
+// Settings is the effective runtime configuration. Treat it as read-only;
+// Modules is shared with every caller of Current.
+type Settings struct {
+	// Modules switches each registered module on or off. Switches apply on
+	// restart since they decide which hooks and routes are registered;
+	// disabling a module also pauses its schedulers right away.
+	Modules map[string]bool
+
+	// Albion kills
+	FetchInterval      time.Duration
+	CleanupInterval    time.Duration
+	KillsRetentionDays int
+	MaxPagesToFetch    int
+
+	// Albion battleboards: pages of battles fetched per run
+	MinIterations int
+	MaxIterations int
+
+	// Chattanooga homes
+	ScrapeInterval time.Duration
+}
+
+// Defaults are the values used when neither the record nor the environment
+// sets them. Module defaults come from RegisterModule.
+var Defaults = Settings{
+	FetchInterval:      10 * time.Second,
+	CleanupInterval:    1 * time.Hour,
+	KillsRetentionDays: 14,
+	MaxPagesToFetch:    5,
+	MinIterations:      10,
+	MaxIterations:      20,
+	ScrapeInterval:     1 * time.Minute,
+}
+
+// setting describes one field: its record field, environment variable and
+// how to read and validate it
+type setting struct {
+	field string
+	env   string
+	set   func(s *Settings, value string) error
+}
+
+var fields = []setting{
+	{"fetch_interval", "ALBION_FETCH_INTERVAL", durationSetting(time.Second, func(s *Settings) *time.Duration { return &s.FetchInterval })},
+	{"cleanup_interval", "ALBION_CLEANUP_INTERVAL", durationSetting(time.Minute, func(s *Settings) *time.Duration { return &s.CleanupInterval })},
+	{"kills_retention_days", "KILLS_RETENTION_DAYS", intSetting(1, func(s *Settings) *int { return &s.KillsRetentionDays })},
+	{"max_pages_to_fetch", "ALBION_MAX_PAGES_TO_FETCH", intSetting(1, func(s *Settings) *int { return &s.MaxPagesToFetch })},
+	{"min_iterations", "BATTLES_MIN_ITERATIONS", intSetting(1, func(s *Settings) *int { return &s.MinIterations })},
+	{"max_iterations", "BATTLES_MAX_ITERATIONS", intSetting(1, func(s *Settings) *int { return &s.MaxIterations })},
+	{"scrape_interval", "HOMES_SCRAPE_INTERVAL", durationSetting(10*time.Second, func(s *Settings) *time.Duration { return &s.ScrapeInterval })},
+}
+
+// moduleDefaults holds whether each registered module is enabled when
+// nothing says otherwise
+var moduleDefaults = map[string]bool{}
+
+// RegisterModule adds the enable_<name> setting and ENABLE_<NAME>
+// environment variable for a module. Call it before AddModuleSwitches and Load.
+func RegisterModule(name string, enabledByDefault bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	moduleDefaults[name] = enabledByDefault
+}
+
+// ModuleEnabled reports whether a module is switched on
+func (s Settings) ModuleEnabled(name string) bool {
+	return s.Modules[name]
+}
+
+// allFields returns the fixed settings followed by each module's switch
+func allFields() []setting {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	result := slices.Clone(fields)
+	for _, name := range slices.Sorted(maps.Keys(moduleDefaults)) {
+		result = append(result, setting{
+			field: moduleField(name),
+			env:   "ENABLE_" + strings.ToUpper(name),
+			set: func(s *Settings, value string) error {
+				b, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("must be true or false")
+				}
+				// Copy on write, since the map may be shared with Current
+				s.Modules = maps.Clone(s.Modules)
+				s.Modules[name] = b
+				return nil
+			},
+		})
+	}
+	return result
+}
+
+func moduleField(name string) string {
+	return "enable_" + name
+}
+
+// defaults returns Defaults with the registered modules' switches
+func defaults() Settings {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	s := Defaults
+	s.Modules = maps.Clone(moduleDefaults)
+	return s
+}
+
+func durationSetting(min time.Duration, ptr func(s *Settings) *time.Duration) func(s *Settings, value string) error {
+	return func(s *Settings, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as 30s, 5m or 1h")
+		}
+		if d < min {
+			return fmt.Errorf("must be at least %v", min)
+		}
+		*ptr(s) = d
+		return nil
+	}
+}
+
+func intSetting(min int, ptr func(s *Settings) *int) func(s *Settings, value string) error {
+	return func(s *Settings, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("must be a whole number")
+		}
+		if n < min {
+			return fmt.Errorf("must be at least %d", min)
+		}
+		*ptr(s) = n
+		return nil
+	}
+}
+
+// Validate checks rules that span fields
+func (s Settings) Validate() error {
+	if s.MinIterations > s.MaxIterations {
+		return fmt.Errorf("min_iterations must not exceed max_iterations")
+	}
+	return nil
+}
+
+var (
+	mu      sync.RWMutex
+	current = Defaults
+)
+
+// Current returns the effective settings
+func Current() Settings {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+func store(s Settings) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = s
+}
+
+// AddModuleSwitches adds an enable_<name> switch to app_settings for each
+// registered module that lacks one, set to the module's default on the
+// existing record. The switches follow the registered modules rather than
+// a fixed schema, so this runs on every start after the settings
+// migrations instead of being one of them.
+func AddModuleSwitches(app core.App) error {
+	collection, err := app.FindCollectionByNameOrId(collectionName)
+	if err != nil {
+		return err
+	}
+
+	added := map[string]bool{}
+	for name, enabled := range defaults().Modules {
+		field := moduleField(name)
+		if collection.Fields.GetByName(field) != nil {
+			continue
+		}
+		collection.Fields.Add(&core.BoolField{Name: field})
+		added[field] = enabled
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	if err := app.Save(collection); err != nil {
+		return err
+	}
+
+	records, err := app.FindAllRecords(collectionName)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		for field, enabled := range added {
+			record.Set(field, enabled)
+		}
+		if err := app.Save(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fromRecord reads the settings record over the defaults. Empty text and
+// zero numbers keep the default.
+func fromRecord(record *core.Record) (Settings, error) {
+	s := defaults()
+	if record == nil {
+		return s, nil
+	}
+
+	for _, f := range allFields() {
+		if record.Collection().Fields.GetByName(f.field) == nil {
+			continue
+		}
+		var value string
+		switch v := record.Get(f.field).(type) {
+		case bool:
+			value = strconv.FormatBool(v)
+		case float64:
+			if v == 0 {
+				continue
+			}
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			value = strings.TrimSpace(record.GetString(f.field))
+			if value == "" {
+				continue
+			}
+		}
+		if err := f.set(&s, value); err != nil {
+			return s, fmt.Errorf("%s %w", f.field, err)
+		}
+	}
+	return s, s.Validate()
+}
+
+// applyEnv overrides settings from the environment. Invalid values are
+// logged and ignored. It returns the names of the variables applied.
+func applyEnv(s *Settings) []string {
+	var applied []string
+	for _, f := range allFields() {
+		value := strings.TrimSpace(os.Getenv(f.env))
+		if value == "" {
+			continue
+		}
+		next := *s
+		if err := f.set(&next, value); err != nil {
+			log.Printf("[SETTINGS] Ignoring %s: %v", f.env, err)
+			continue
+		}
+		*s = next
+		applied = append(applied, f.env)
+	}
+	if err := s.Validate(); err != nil {
+		log.Printf("[SETTINGS] Environment overrides are inconsistent (%v); using defaults for iterations", err)
+		s.MinIterations, s.MaxIterations = Defaults.MinIterations, Defaults.MaxIterations
+	}
+	return applied
+}
+
+// Load reads the settings record, applies environment overrides and makes
+// the result current
+func Load(app core.App) error {
+	records, err := app.FindRecordsByFilter(collectionName, "", "-updated", 1, 0)
+	if err != nil {
+		return err
+	}
+	var record *core.Record
+	if len(records) > 0 {
+		record = records[0]
+	}
+
+	s, err := fromRecord(record)
+	if err != nil {
+		// Saves are validated, so this only happens for records written
+		// around the hooks; fall back rather than half-apply them
+		log.Printf("[SETTINGS] Invalid app_settings record, using defaults: %v", err)
+		s = defaults()
+	}
+	applied := applyEnv(&s)
+
+	previous := Current()
+	store(s)
+
+	if len(applied) > 0 {
+		log.Printf("[SETTINGS] Loaded settings (environment overrides: %s)", strings.Join(applied, ", "))
+	} else {
+		log.Printf("[SETTINGS] Loaded settings")
+	}
+	if previous.Modules != nil && !maps.Equal(previous.Modules, s.Modules) {
+		log.Printf("[SETTINGS] Module switches changed; restart to register or remove their routes and hooks")
+	}
+	return nil
+}
+
+// RegisterHooks validates app_settings saves, keeps the collection to a
+// single record and reloads the settings after every change
+func RegisterHooks(app *pocketbase.PocketBase) {
+	app.OnRecordValidate(collectionName).BindFunc(func(e *core.RecordEvent) error {
+		if _, err := fromRecord(e.Record); err != nil {
+			return fmt.Errorf("invalid settings: %w", err)
+		}
+		return e.Next()
+	})
+
+	app.OnRecordCreate(collectionName).BindFunc(func(e *core.RecordEvent) error {
+		existing, err := e.App.CountRecords(collectionName)
+		if err != nil {
+			return err
+		}
+		if existing > 0 {
+			return fmt.Errorf("%s already has a record; edit it instead", collectionName)
+		}
+		return e.Next()
+	})
+
+	reload := func(e *core.RecordEvent) error {
+		if err := Load(app); err != nil {
+			log.Printf("[SETTINGS] Error reloading settings: %v", err)
+		}
+		return e.Next()
+	}
+	app.OnRecordAfterCreateSuccess(collectionName).BindFunc(reload)
+	app.OnRecordAfterUpdateSuccess(collectionName).BindFunc(reload)
+	app.OnRecordAfterDeleteSuccess(collectionName).BindFunc(reload)
+}